@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/jasonbronson/kwikportal-api/jobs"
 	"github.com/jasonbronson/kwikportal-api/transport"
 
 	"github.com/jasonbronson/kwikportal-api/config"
@@ -17,6 +18,10 @@ func main() {
 	newRelicApp := config.NewRelicApp()
 	r := transport.Router(newRelicApp)
 
+	// Imports run in the background so uploads return before the write timeout
+	jobs.StartImportWorkers(config.Cfg.ImportWorkers)
+	jobs.StartBulkWorkers(config.Cfg.BulkWorkers)
+
 	log.Printf("Listening to http://0.0.0.0:%v/", strconv.Itoa(config.Cfg.Port))
 
 	port := "0.0.0.0:" + strconv.Itoa(config.Cfg.Port)
@@ -6,6 +6,7 @@ import (
 	"os/signal"
 
 	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/jobs"
 
 	"github.com/robfig/cron/v3"
 )
@@ -14,9 +15,18 @@ func main() {
 
 	config.Cfg.NewRelicApp = config.NewRelicApp()
 	log.Println("=====cron job ======")
-	c := cron.New()
+	// Link checks can outlast their interval, so runs never overlap
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
 	// Add the jobs here and please keep the consistency of naming convention, filename in snake case, and interval and job function in camel case
 	//c.AddFunc(jobs.DoSomething, jobs.DoSomething)
+	c.AddFunc(jobs.CanonicalURLsInterval, jobs.CanonicalURLs)
+	c.AddFunc(jobs.LinkCheckInterval, jobs.LinkCheck)
+	c.AddFunc(jobs.MetadataInterval, jobs.Metadata)
+	c.AddFunc(jobs.IconsInterval, jobs.Icons)
+	c.AddFunc(jobs.ArchivesInterval, jobs.Archives)
+	c.AddFunc(jobs.TrashInterval, jobs.Trash)
+	c.AddFunc(jobs.VisitsInterval, jobs.Visits)
+	c.AddFunc(jobs.ReadLaterInterval, jobs.ReadLater)
 	c.Start()
 	log.Println("=====cron system started======")
 
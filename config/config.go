@@ -4,13 +4,16 @@ import (
 	"crypto/tls"
 	"database/sql"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v7"
+	"github.com/jasonbronson/kwikportal-api/library"
 	"github.com/joho/godotenv"
 	"github.com/newrelic/go-agent/v3/integrations/nrredis-v7"
 	_ "github.com/newrelic/go-agent/v3/integrations/nrsqlite3"
@@ -40,10 +43,22 @@ type Config struct {
 	NewRelicLicenseKey string
 	NewRelicAppName    string
 	NewRelicApp        *newrelic.Application
+	ImportWorkers      int
+	BulkWorkers        int
+	TrashRetention     time.Duration
+	FrecencyHalfLife   time.Duration
+	QueueArchiveAfter  time.Duration
+	TrackingParams     []string
+	LinkCheck          *LinkCheckConfig
+	Archive            *ArchiveConfig
 }
 
 func init() {
 	initEnv()
+	// Tests of code that does not use the database run without one configured
+	if Cfg.DatabaseURL == "" && strings.HasSuffix(os.Args[0], ".test") {
+		return
+	}
 	initDB()
 	initRedis()
 }
@@ -65,6 +80,50 @@ func initEnv() {
 	Cfg.NewRelicEnabled, _ = strconv.ParseBool(os.Getenv("NEW_RELIC_ENABLED"))
 	Cfg.NewRelicLicenseKey = os.Getenv("NEW_RELIC_LICENSE_KEY")
 	Cfg.NewRelicAppName = os.Getenv("NEW_RELIC_APP_NAME")
+	Cfg.ImportWorkers, _ = strconv.Atoi(os.Getenv("IMPORT_WORKERS"))
+	if Cfg.ImportWorkers <= 0 {
+		Cfg.ImportWorkers = 2
+	}
+	Cfg.BulkWorkers, _ = strconv.Atoi(os.Getenv("BULK_WORKERS"))
+	if Cfg.BulkWorkers <= 0 {
+		Cfg.BulkWorkers = 1
+	}
+	Cfg.TrashRetention = 30 * 24 * time.Hour
+	if v, err := time.ParseDuration(os.Getenv("TRASH_RETENTION")); err == nil && v > 0 {
+		Cfg.TrashRetention = v
+	}
+	Cfg.FrecencyHalfLife = 30 * 24 * time.Hour
+	if v, err := time.ParseDuration(os.Getenv("FRECENCY_HALF_LIFE")); err == nil && v > 0 {
+		Cfg.FrecencyHalfLife = v
+	}
+	// Zero keeps read items in the queue until they are archived by hand
+	Cfg.QueueArchiveAfter = 14 * 24 * time.Hour
+	if v, err := time.ParseDuration(os.Getenv("QUEUE_ARCHIVE_AFTER")); err == nil && v >= 0 {
+		Cfg.QueueArchiveAfter = v
+	}
+	linkCheck := LinkCheckConfig{
+		Concurrency:     8,
+		HostInterval:    time.Second,
+		RecheckAfter:    24 * time.Hour,
+		Timeout:         15 * time.Second,
+		UpdateRedirects: false,
+	}
+	if v, err := strconv.Atoi(os.Getenv("LINK_CHECK_CONCURRENCY")); err == nil && v > 0 {
+		linkCheck.Concurrency = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("LINK_CHECK_HOST_INTERVAL")); err == nil {
+		linkCheck.HostInterval = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("LINK_CHECK_RECHECK_AFTER")); err == nil {
+		linkCheck.RecheckAfter = v
+	}
+	linkCheck.UpdateRedirects, _ = strconv.ParseBool(os.Getenv("LINK_CHECK_UPDATE_REDIRECTS"))
+	Cfg.LinkCheck = &linkCheck
+	Cfg.Archive = initArchive()
+	Cfg.TrackingParams = library.DefaultTrackingParams
+	if params := os.Getenv("TRACKING_PARAMS"); params != "" {
+		Cfg.TrackingParams = strings.Split(params, ",")
+	}
 }
 
 // initDB initializes the database connection.
@@ -141,3 +200,56 @@ type JWTConfig struct {
 	Issuer   string
 	Audience string
 }
+
+// initArchive reads the page archive settings. Archives are kept on local disk, in
+// ARCHIVE_DIR or else the archives directory of the working directory at startup, unless
+// ARCHIVE_STORAGE is set to http.
+func initArchive() *ArchiveConfig {
+	archive := ArchiveConfig{
+		QuotaBytes:   100 << 20,
+		MaxPageBytes: 5 << 20,
+	}
+	if v, err := strconv.ParseInt(os.Getenv("ARCHIVE_QUOTA_MB"), 10, 64); err == nil && v > 0 {
+		archive.QuotaBytes = v << 20
+	}
+	archive.Retention, _ = time.ParseDuration(os.Getenv("ARCHIVE_RETENTION"))
+
+	switch os.Getenv("ARCHIVE_STORAGE") {
+	case "http":
+		client := &http.Client{Timeout: time.Minute}
+		archive.Storage = library.NewHTTPStorage(client, os.Getenv("ARCHIVE_STORAGE_URL"), os.Getenv("ARCHIVE_STORAGE_TOKEN"))
+	case "", "local":
+		dir := os.Getenv("ARCHIVE_DIR")
+		if dir == "" {
+			dir = "archives"
+		}
+		// Resolved once, so files do not move with the working directory of the process
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatalf("invalid ARCHIVE_DIR %q: %v", dir, err)
+		}
+		log.Printf("Storing archives in %v", abs)
+		archive.Storage = library.NewLocalStorage(abs)
+	default:
+		log.Fatalf("unknown ARCHIVE_STORAGE %q", os.Getenv("ARCHIVE_STORAGE"))
+	}
+	return &archive
+}
+
+// LinkCheckConfig holds the settings of the link check cron job.
+type LinkCheckConfig struct {
+	Concurrency     int
+	HostInterval    time.Duration
+	RecheckAfter    time.Duration
+	Timeout         time.Duration
+	UpdateRedirects bool
+}
+
+// ArchiveConfig holds the settings of page archives.
+type ArchiveConfig struct {
+	Storage      library.Storage
+	QuotaBytes   int64
+	MaxPageBytes int64
+	// Retention is how long archives are kept, zero keeps them until the bookmark is deleted
+	Retention time.Duration
+}
@@ -0,0 +1,141 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// chromeEpochOffset is the number of seconds between 1601-01-01, the epoch of Chrome
+// timestamps, and the unix epoch.
+const chromeEpochOffset = 11644473600
+
+// chromeRoots are the Chrome root folders in the order they are shown by the browser.
+var chromeRoots = []string{"bookmark_bar", "other", "synced"}
+
+// chromeImporter reads the Bookmarks JSON file from a Chrome or Chromium profile.
+type chromeImporter struct{}
+
+type chromeNode struct {
+	Name         string       `json:"name"`
+	Type         string       `json:"type"`
+	URL          string       `json:"url"`
+	DateAdded    string       `json:"date_added"`
+	DateModified string       `json:"date_modified"`
+	Children     []chromeNode `json:"children"`
+}
+
+func (chromeImporter) Name() string { return "chrome" }
+
+func (chromeImporter) Detect(head []byte) bool {
+	return isJSONObject(head) && bytes.Contains(head, []byte(`"roots"`)) &&
+		bytes.Contains(head, []byte(`"bookmark_bar"`))
+}
+
+func (chromeImporter) Parse(r io.Reader) (*Result, error) {
+	var file struct {
+		Roots map[string]json.RawMessage `json:"roots"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	// Known roots first, then anything newer browser versions add
+	names := append([]string{}, chromeRoots...)
+	var extra []string
+	for name := range file.Roots {
+		if !contains(chromeRoots, name) {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	names = append(names, extra...)
+
+	result := &Result{}
+	for _, name := range names {
+		raw, ok := file.Roots[name]
+		if !ok {
+			continue
+		}
+		var root chromeNode
+		if err := json.Unmarshal(raw, &root); err != nil || root.Type != "folder" {
+			continue
+		}
+		walkChrome(result, root, nil, name == "bookmark_bar")
+	}
+
+	return result, nil
+}
+
+func walkChrome(result *Result, node chromeNode, parent []string, toolbar bool) {
+	switch node.Type {
+	case "folder":
+		name := node.Name
+		if name == "" {
+			name = untitledFolder
+		}
+		path := append(append([]string{}, parent...), name)
+		result.addFolder(models.Folder{
+			Path:         models.JoinFolderPath(path...),
+			AddDate:      chromeTime(result, node.Name, node.DateAdded),
+			LastModified: chromeTime(result, node.Name, node.DateModified),
+			Toolbar:      toolbar,
+		})
+		for _, child := range node.Children {
+			walkChrome(result, child, path, false)
+		}
+	case "url":
+		if node.URL == "" {
+			result.warn(0, node.Name, "bookmark without url skipped")
+			return
+		}
+		result.Bookmarks = append(result.Bookmarks, models.Bookmark{
+			URL:          node.URL,
+			Name:         node.Name,
+			Folder:       models.JoinFolderPath(parent...),
+			AddDate:      chromeTime(result, node.Name, node.DateAdded),
+			LastModified: chromeTime(result, node.Name, node.DateModified),
+		})
+	default:
+		result.warn(0, node.Name, fmt.Sprintf("entry of unknown type %q skipped", node.Type))
+	}
+}
+
+// chromeTime converts a Chrome timestamp, microseconds since 1601-01-01, to unix seconds.
+func chromeTime(result *Result, entry, val string) int64 {
+	if val == "" || val == "0" {
+		return 0
+	}
+	micros, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		result.warn(0, entry, fmt.Sprintf("invalid date %q ignored", val))
+		return 0
+	}
+	return micros/1000000 - chromeEpochOffset
+}
+
+// isJSONObject reports whether data starts with a JSON object.
+func isJSONObject(data []byte) bool {
+	data = bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	return len(data) > 0 && data[0] == '{'
+}
+
+// isJSONArray reports whether data starts with a JSON array.
+func isJSONArray(data []byte) bool {
+	data = bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	return len(data) > 0 && data[0] == '['
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
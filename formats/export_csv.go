@@ -0,0 +1,90 @@
+package formats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// csvColumnValues are the columns the CSV export can contain.
+var csvColumnValues = map[string]func(models.Bookmark) string{
+	"id":            func(b models.Bookmark) string { return b.ID },
+	"name":          func(b models.Bookmark) string { return b.Name },
+	"url":           func(b models.Bookmark) string { return b.URL },
+	"folder":        func(b models.Bookmark) string { return b.Folder },
+	"tags":          func(b models.Bookmark) string { return b.Tags },
+	"keyword":       func(b models.Bookmark) string { return b.Keyword },
+	"icon":          func(b models.Bookmark) string { return b.Icon },
+	"notes":         func(b models.Bookmark) string { return b.Notes },
+	"add_date":      func(b models.Bookmark) string { return formatUnix(b.AddDate) },
+	"last_modified": func(b models.Bookmark) string { return formatUnix(b.LastModified) },
+	"created_at":    func(b models.Bookmark) string { return b.CreatedAt.UTC().Format(time.RFC3339) },
+	"updated_at":    func(b models.Bookmark) string { return b.UpdatedAt.UTC().Format(time.RFC3339) },
+}
+
+// csvDefaultColumns are exported when no columns are requested.
+var csvDefaultColumns = []string{"name", "url", "folder", "tags", "add_date"}
+
+// csvExporter writes one bookmark per row with a header row naming the columns.
+type csvExporter struct{}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	started bool
+}
+
+func (csvExporter) Name() string        { return "csv" }
+func (csvExporter) ContentType() string { return "text/csv" }
+func (csvExporter) Extension() string   { return "csv" }
+
+func (csvExporter) NewWriter(w io.Writer, folders []models.Folder, options ExportOptions) (BookmarkWriter, error) {
+	columns := options.Columns
+	if len(columns) == 0 {
+		columns = csvDefaultColumns
+	}
+	for _, c := range columns {
+		if _, ok := csvColumnValues[c]; !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", c)
+		}
+	}
+	return &csvWriter{w: csv.NewWriter(w), columns: columns}, nil
+}
+
+func (c *csvWriter) Write(b models.Bookmark) error {
+	if err := c.start(); err != nil {
+		return err
+	}
+	record := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		record[i] = csvColumnValues[column](b)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.start(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) start() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	return c.w.Write(c.columns)
+}
+
+// formatUnix formats a unix timestamp as RFC 3339, or an empty string when it is not set.
+func formatUnix(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
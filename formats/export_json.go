@@ -0,0 +1,82 @@
+package formats
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// jsonExporter writes every stored field of the folders and bookmarks as one JSON document:
+// {"folders": [...], "bookmarks": [...]}. Records use the same shape as the API responses.
+type jsonExporter struct{}
+
+type jsonWriter struct {
+	w       *bufio.Writer
+	folders []models.Folder
+	count   int
+	started bool
+}
+
+func (jsonExporter) Name() string        { return "json" }
+func (jsonExporter) ContentType() string { return "application/json" }
+func (jsonExporter) Extension() string   { return "json" }
+
+func (jsonExporter) NewWriter(w io.Writer, folders []models.Folder, options ExportOptions) (BookmarkWriter, error) {
+	return &jsonWriter{w: bufio.NewWriter(w), folders: folders}, nil
+}
+
+func (j *jsonWriter) Write(b models.Bookmark) error {
+	if err := j.start(); err != nil {
+		return err
+	}
+	if j.count > 0 {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.count++
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(j.w, "\n"); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if err := j.start(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(j.w, "\n]}\n"); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+func (j *jsonWriter) start() error {
+	if j.started {
+		return nil
+	}
+	j.started = true
+	folders := j.folders
+	if folders == nil {
+		folders = []models.Folder{}
+	}
+	data, err := json.Marshal(folders)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(j.w, `{"folders":`); err != nil {
+		return err
+	}
+	if _, err := j.w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(j.w, `,"bookmarks":[`)
+	return err
+}
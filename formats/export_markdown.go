@@ -0,0 +1,88 @@
+package formats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// markdownExporter writes a Markdown document with a nested list per folder.
+type markdownExporter struct{}
+
+type markdownWriter struct {
+	w       *bufio.Writer
+	walker  *folderWalker
+	started bool
+}
+
+// markdownEscaper escapes the characters that would turn link text into markup.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`", "<", `\<`,
+)
+
+func (markdownExporter) Name() string        { return "markdown" }
+func (markdownExporter) ContentType() string { return "text/markdown" }
+func (markdownExporter) Extension() string   { return "md" }
+
+func (markdownExporter) NewWriter(w io.Writer, folders []models.Folder, options ExportOptions) (BookmarkWriter, error) {
+	m := &markdownWriter{w: bufio.NewWriter(w), walker: newFolderWalker(folders)}
+	m.walker.openFolder = m.openFolder
+	m.walker.closeFolder = func() error { return nil }
+	return m, nil
+}
+
+func (m *markdownWriter) Write(b models.Bookmark) error {
+	if err := m.start(); err != nil {
+		return err
+	}
+	if err := m.walker.moveTo(b.Folder); err != nil {
+		return err
+	}
+
+	name := b.Name
+	if name == "" {
+		name = b.URL
+	}
+	line := fmt.Sprintf("%v- [%v](<%v>)", m.indent(m.walker.depth()), markdownEscaper.Replace(name), markdownURL(b.URL))
+	for _, tag := range b.TagList() {
+		line += " `" + strings.ReplaceAll(tag, "`", "'") + "`"
+	}
+	_, err := io.WriteString(m.w, line+"\n")
+	return err
+}
+
+func (m *markdownWriter) Close() error {
+	if err := m.start(); err != nil {
+		return err
+	}
+	if err := m.walker.finish(); err != nil {
+		return err
+	}
+	return m.w.Flush()
+}
+
+func (m *markdownWriter) start() error {
+	if m.started {
+		return nil
+	}
+	m.started = true
+	_, err := io.WriteString(m.w, "# Bookmarks\n\n")
+	return err
+}
+
+func (m *markdownWriter) openFolder(name string, folder models.Folder) error {
+	_, err := fmt.Fprintf(m.w, "%v- **%v**\n", m.indent(m.walker.depth()-1), markdownEscaper.Replace(name))
+	return err
+}
+
+func (m *markdownWriter) indent(depth int) string {
+	return strings.Repeat("  ", depth)
+}
+
+// markdownURL escapes a URL for use inside an angle bracket link destination.
+func markdownURL(u string) string {
+	return strings.NewReplacer("<", "%3C", ">", "%3E", "\n", "", "\r", "").Replace(u)
+}
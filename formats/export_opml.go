@@ -0,0 +1,101 @@
+package formats
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// opmlExporter writes an OPML 2.0 outline with folders as nested outlines and
+// bookmarks as link outlines.
+type opmlExporter struct{}
+
+type opmlWriter struct {
+	w       *bufio.Writer
+	walker  *folderWalker
+	started bool
+}
+
+func (opmlExporter) Name() string        { return "opml" }
+func (opmlExporter) ContentType() string { return "text/x-opml" }
+func (opmlExporter) Extension() string   { return "opml" }
+
+func (opmlExporter) NewWriter(w io.Writer, folders []models.Folder, options ExportOptions) (BookmarkWriter, error) {
+	o := &opmlWriter{w: bufio.NewWriter(w), walker: newFolderWalker(folders)}
+	o.walker.openFolder = o.openFolder
+	o.walker.closeFolder = o.closeFolder
+	return o, nil
+}
+
+func (o *opmlWriter) Write(b models.Bookmark) error {
+	if err := o.start(); err != nil {
+		return err
+	}
+	if err := o.walker.moveTo(b.Folder); err != nil {
+		return err
+	}
+
+	var attrs strings.Builder
+	writeXMLAttr(&attrs, "text", b.Name)
+	writeXMLAttr(&attrs, "type", "link")
+	writeXMLAttr(&attrs, "url", b.URL)
+	if b.AddDate != 0 {
+		writeXMLAttr(&attrs, "created", time.Unix(b.AddDate, 0).UTC().Format(time.RFC1123Z))
+	}
+	writeXMLAttr(&attrs, "category", b.Tags)
+	_, err := fmt.Fprintf(o.w, "%v<outline%v/>\n", o.indent(o.walker.depth()), attrs.String())
+	return err
+}
+
+func (o *opmlWriter) Close() error {
+	if err := o.start(); err != nil {
+		return err
+	}
+	if err := o.walker.finish(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(o.w, "  </body>\n</opml>\n"); err != nil {
+		return err
+	}
+	return o.w.Flush()
+}
+
+func (o *opmlWriter) start() error {
+	if o.started {
+		return nil
+	}
+	o.started = true
+	_, err := fmt.Fprintf(o.w, "%v<opml version=\"2.0\">\n  <head>\n    <title>Bookmarks</title>\n    <dateCreated>%v</dateCreated>\n  </head>\n  <body>\n",
+		xml.Header, time.Now().UTC().Format(time.RFC1123Z))
+	return err
+}
+
+func (o *opmlWriter) openFolder(name string, folder models.Folder) error {
+	var attrs strings.Builder
+	writeXMLAttr(&attrs, "text", name)
+	_, err := fmt.Fprintf(o.w, "%v<outline%v>\n", o.indent(o.walker.depth()-1), attrs.String())
+	return err
+}
+
+func (o *opmlWriter) closeFolder() error {
+	_, err := fmt.Fprintf(o.w, "%v</outline>\n", o.indent(o.walker.depth()))
+	return err
+}
+
+func (o *opmlWriter) indent(depth int) string {
+	return strings.Repeat("  ", depth+2)
+}
+
+func writeXMLAttr(b *strings.Builder, key, val string) {
+	if val == "" {
+		return
+	}
+	b.WriteString(" " + key + `="`)
+	xml.EscapeText(b, []byte(val))
+	b.WriteString(`"`)
+}
@@ -0,0 +1,88 @@
+package formats
+
+import (
+	"fmt"
+	"io"
+	"mime"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// Exporter writes bookmarks in one file format.
+type Exporter interface {
+	// Name is the format name used to select the exporter.
+	Name() string
+	// ContentType is the media type of the export.
+	ContentType() string
+	// Extension is the file extension used for downloads, without the dot.
+	Extension() string
+	// NewWriter starts an export to w. Folders are used for folder attributes and for
+	// folders that hold no bookmarks.
+	NewWriter(w io.Writer, folders []models.Folder, options ExportOptions) (BookmarkWriter, error)
+}
+
+// BookmarkWriter streams bookmarks into an export.
+//
+// Bookmarks must be written in folder order (see models.CompareFolderPaths) for the nested
+// formats to group them correctly. Close must be called to complete the export.
+type BookmarkWriter interface {
+	Write(models.Bookmark) error
+	Close() error
+}
+
+// ExportOptions tune the output of exporters that support them.
+type ExportOptions struct {
+	// Columns selects the CSV columns, in order. Empty means the default columns.
+	Columns []string
+}
+
+// exporters are the known exporters. The first one is used when a client accepts anything.
+var exporters = []Exporter{
+	netscapeExporter{},
+	jsonExporter{},
+	csvExporter{},
+	markdownExporter{},
+	opmlExporter{},
+}
+
+// ExporterNames returns the names of all supported export formats.
+func ExporterNames() []string {
+	names := make([]string, 0, len(exporters))
+	for _, e := range exporters {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// ExporterContentTypes returns the media types of all exporters, in order of preference.
+func ExporterContentTypes() []string {
+	types := make([]string, 0, len(exporters))
+	for _, e := range exporters {
+		types = append(types, e.ContentType())
+	}
+	return types
+}
+
+// ExporterFor returns the exporter registered under the given format name.
+func ExporterFor(format string) (Exporter, error) {
+	for _, e := range exporters {
+		if e.Name() == format {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
+
+// ExporterForContentType returns the exporter producing the given media type.
+func ExporterForContentType(contentType string) (Exporter, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, contentType)
+	}
+	for _, e := range exporters {
+		if e.ContentType() == mediaType {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, contentType)
+}
@@ -0,0 +1,264 @@
+package formats
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Feed is a syndication feed of bookmarks, newest first.
+type Feed struct {
+	// ID is a URI identifying the feed for as long as it exists.
+	ID    string
+	Title string
+	// Link is the page the feed belongs to, if any, and FeedURL the address of the feed.
+	Link    string
+	FeedURL string
+	Updated time.Time
+	Items   []FeedItem
+}
+
+// FeedItem is a bookmark in a feed.
+type FeedItem struct {
+	ID        string
+	Title     string
+	URL       string
+	Summary   string
+	Tags      []string
+	Published time.Time
+	Updated   time.Time
+}
+
+// FeedWriter writes a feed in one syndication format.
+type FeedWriter interface {
+	// Name is the format name used to select the writer.
+	Name() string
+	// ContentType is the media type of the feed.
+	ContentType() string
+	Write(w io.Writer, feed Feed) error
+}
+
+// feedWriters are the known feed writers.
+var feedWriters = []FeedWriter{
+	atomWriter{},
+	rssWriter{},
+	jsonFeedWriter{},
+}
+
+// FeedWriterNames returns the names of all supported feed formats.
+func FeedWriterNames() []string {
+	names := make([]string, 0, len(feedWriters))
+	for _, f := range feedWriters {
+		names = append(names, f.Name())
+	}
+	return names
+}
+
+// FeedWriterFor returns the feed writer registered under the given format name.
+func FeedWriterFor(format string) (FeedWriter, error) {
+	for _, f := range feedWriters {
+		if f.Name() == format {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
+
+// atomWriter writes an Atom 1.0 feed (RFC 4287).
+type atomWriter struct{}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    string         `xml:"summary,omitempty"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+func (atomWriter) Name() string        { return "atom" }
+func (atomWriter) ContentType() string { return "application/atom+xml" }
+
+func (atomWriter) Write(w io.Writer, feed Feed) error {
+	out := atomFeed{
+		ID:      feed.ID,
+		Title:   feed.Title,
+		Updated: feed.Updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: feed.Title},
+		Links:   []atomLink{{Href: feed.FeedURL, Rel: "self", Type: "application/atom+xml"}},
+	}
+	if feed.Link != "" {
+		out.Links = append(out.Links, atomLink{Href: feed.Link, Rel: "alternate", Type: "text/html"})
+	}
+	for _, item := range feed.Items {
+		entry := atomEntry{
+			ID:        item.ID,
+			Title:     item.Title,
+			Link:      atomLink{Href: item.URL},
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated:   item.Updated.UTC().Format(time.RFC3339),
+			Summary:   item.Summary,
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+	return writeXML(w, out)
+}
+
+// rssWriter writes an RSS 2.0 feed.
+type rssWriter struct{}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	Description string   `xml:"description,omitempty"`
+	Categories  []string `xml:"category"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (rssWriter) Name() string        { return "rss" }
+func (rssWriter) ContentType() string { return "application/rss+xml" }
+
+func (rssWriter) Write(w io.Writer, feed Feed) error {
+	link := feed.Link
+	if link == "" {
+		link = feed.FeedURL
+	}
+	out := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         feed.Title,
+			Link:          link,
+			Description:   feed.Title,
+			LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+			Self:          atomLink{Href: feed.FeedURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	for _, item := range feed.Items {
+		out.Channel.Items = append(out.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			GUID:        rssGUID{Value: item.ID},
+			Description: item.Summary,
+			Categories:  item.Tags,
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return writeXML(w, out)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// jsonFeedWriter writes a JSON Feed 1.1.
+type jsonFeedWriter struct{}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentText   string   `json:"content_text"`
+	Summary       string   `json:"summary,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	DatePublished string   `json:"date_published"`
+	DateModified  string   `json:"date_modified"`
+}
+
+func (jsonFeedWriter) Name() string        { return "json" }
+func (jsonFeedWriter) ContentType() string { return "application/feed+json" }
+
+func (jsonFeedWriter) Write(w io.Writer, feed Feed) error {
+	out := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.Link,
+		FeedURL:     feed.FeedURL,
+		Items:       make([]jsonFeedItem, 0, len(feed.Items)),
+	}
+	for _, item := range feed.Items {
+		out.Items = append(out.Items, jsonFeedItem{
+			ID:            item.ID,
+			URL:           item.URL,
+			Title:         item.Title,
+			ContentText:   item.Summary,
+			Summary:       item.Summary,
+			Tags:          item.Tags,
+			DatePublished: item.Published.UTC().Format(time.RFC3339),
+			DateModified:  item.Updated.UTC().Format(time.RFC3339),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(out)
+}
@@ -0,0 +1,106 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// Firefox place types, as written in the "type" field of a bookmark backup.
+const (
+	firefoxPlace     = "text/x-moz-place"
+	firefoxContainer = "text/x-moz-place-container"
+	firefoxSeparator = "text/x-moz-place-separator"
+)
+
+// firefoxRootNames are the display names of the Firefox root folders.
+var firefoxRootNames = map[string]string{
+	"bookmarksMenuFolder":    "Bookmarks Menu",
+	"toolbarFolder":          "Bookmarks Toolbar",
+	"unfiledBookmarksFolder": "Other Bookmarks",
+	"mobileFolder":           "Mobile Bookmarks",
+}
+
+// firefoxImporter reads the JSON bookmark backups made by Firefox.
+type firefoxImporter struct{}
+
+type firefoxNode struct {
+	Title        string        `json:"title"`
+	Type         string        `json:"type"`
+	Root         string        `json:"root"`
+	URI          string        `json:"uri"`
+	DateAdded    int64         `json:"dateAdded"`
+	LastModified int64         `json:"lastModified"`
+	Tags         string        `json:"tags"`
+	Keyword      string        `json:"keyword"`
+	Children     []firefoxNode `json:"children"`
+}
+
+func (firefoxImporter) Name() string { return "firefox" }
+
+func (firefoxImporter) Detect(head []byte) bool {
+	return isJSONObject(head) && bytes.Contains(head, []byte(firefoxContainer))
+}
+
+func (firefoxImporter) Parse(r io.Reader) (*Result, error) {
+	var root firefoxNode
+	if err := json.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	// The places root itself is not a folder users see
+	for _, child := range root.Children {
+		walkFirefox(result, child, nil)
+	}
+
+	return result, nil
+}
+
+func walkFirefox(result *Result, node firefoxNode, parent []string) {
+	switch node.Type {
+	case firefoxContainer:
+		name := node.Title
+		if display, ok := firefoxRootNames[node.Root]; ok {
+			name = display
+		}
+		if name == "" {
+			name = untitledFolder
+		}
+		path := append(append([]string{}, parent...), name)
+		result.addFolder(models.Folder{
+			Path:         models.JoinFolderPath(path...),
+			AddDate:      node.DateAdded / 1000000,
+			LastModified: node.LastModified / 1000000,
+			Toolbar:      node.Root == "toolbarFolder",
+		})
+		for _, child := range node.Children {
+			walkFirefox(result, child, path)
+		}
+	case firefoxPlace:
+		if node.URI == "" {
+			result.warn(0, node.Title, "bookmark without uri skipped")
+			return
+		}
+		if strings.HasPrefix(node.URI, "place:") {
+			result.warn(0, node.Title, "smart bookmark query skipped")
+			return
+		}
+		result.Bookmarks = append(result.Bookmarks, models.Bookmark{
+			URL:          node.URI,
+			Name:         node.Title,
+			Folder:       models.JoinFolderPath(parent...),
+			AddDate:      node.DateAdded / 1000000,
+			LastModified: node.LastModified / 1000000,
+			Tags:         models.JoinTags(strings.Split(node.Tags, ",")),
+			Keyword:      node.Keyword,
+		})
+	case firefoxSeparator:
+	default:
+		result.warn(0, node.Title, fmt.Sprintf("entry of unknown type %q skipped", node.Type))
+	}
+}
@@ -0,0 +1,92 @@
+package formats
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// sniffLength is how much of a file is looked at to detect its format.
+const sniffLength = 64 * 1024
+
+var (
+	// ErrUnknownFormat is returned when an import format is requested that has no importer.
+	ErrUnknownFormat = errors.New("unknown bookmark file format")
+	// ErrUndetectedFormat is returned when no importer recognizes the file contents.
+	ErrUndetectedFormat = errors.New("unrecognized bookmark file format")
+)
+
+// Importer reads bookmarks from one file format.
+type Importer interface {
+	// Name is the format name used to select the importer.
+	Name() string
+	// Detect reports whether the start of a file looks like this format.
+	Detect(head []byte) bool
+	// Parse reads a whole file into bookmarks, folders and warnings.
+	Parse(r io.Reader) (*Result, error)
+}
+
+// importers are the known importers, in the order they are tried when detecting a format.
+// More specific formats come before the ones they could be mistaken for.
+var importers = []Importer{
+	netscapeImporter{},
+	pocketImporter{},
+	chromeImporter{},
+	firefoxImporter{},
+	pinboardImporter{},
+	raindropImporter{},
+	urlListImporter{},
+}
+
+// ImporterNames returns the names of all supported import formats.
+func ImporterNames() []string {
+	names := make([]string, 0, len(importers))
+	for _, i := range importers {
+		names = append(names, i.Name())
+	}
+	return names
+}
+
+// ImporterFor returns the importer registered under the given format name.
+func ImporterFor(format string) (Importer, error) {
+	for _, i := range importers {
+		if i.Name() == format {
+			return i, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
+
+// DetectImporter returns the first importer that recognizes the start of a file.
+func DetectImporter(head []byte) (Importer, error) {
+	for _, i := range importers {
+		if i.Detect(head) {
+			return i, nil
+		}
+	}
+	return nil, ErrUndetectedFormat
+}
+
+// Parse reads a bookmark file in the given format. When format is empty the format
+// is detected from the file contents.
+func Parse(r io.Reader, format string) (*Result, error) {
+	if format != "" {
+		importer, err := ImporterFor(format)
+		if err != nil {
+			return nil, err
+		}
+		return importer.Parse(r)
+	}
+
+	br := bufio.NewReaderSize(r, sniffLength)
+	head, err := br.Peek(sniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	importer, err := DetectImporter(head)
+	if err != nil {
+		return nil, err
+	}
+	return importer.Parse(br)
+}
@@ -0,0 +1,168 @@
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+func TestImporters(t *testing.T) {
+	tests := []struct {
+		file      string
+		format    string
+		bookmarks []models.Bookmark
+		folders   []models.Folder
+		warnings  []string
+	}{
+		{
+			file:   "chrome.json",
+			format: "chrome",
+			bookmarks: []models.Bookmark{
+				{URL: "https://go.dev/", Name: "Go", Folder: "Bookmarks bar", AddDate: 1609452000},
+				{URL: "https://pkg.go.dev/", Name: "Docs", Folder: "Bookmarks bar/Reference", AddDate: 1609452000},
+				{URL: "https://example.com/", Name: "Example", Folder: "Other bookmarks"},
+			},
+			folders: []models.Folder{
+				{Path: "Bookmarks bar", AddDate: 1609452000, Toolbar: true},
+				{Path: "Bookmarks bar/Reference", AddDate: 1609452000, LastModified: 1609452100},
+				{Path: "Other bookmarks"},
+				{Path: "Mobile bookmarks"},
+			},
+			warnings: []string{"bookmark without url skipped"},
+		},
+		{
+			file:   "firefox.json",
+			format: "firefox",
+			bookmarks: []models.Bookmark{
+				{URL: "https://go.dev/", Name: "Go", Folder: "Bookmarks Menu/Reading", AddDate: 1609452000, LastModified: 1609452100, Tags: "go,lang", Keyword: "go"},
+				{URL: "https://example.com/", Name: "Example", Folder: "Bookmarks Toolbar", AddDate: 1609452000, LastModified: 1609452000},
+			},
+			folders: []models.Folder{
+				{Path: "Bookmarks Menu", AddDate: 1609452000, LastModified: 1609452100},
+				{Path: "Bookmarks Menu/Reading", AddDate: 1609452000, LastModified: 1609452000},
+				{Path: "Bookmarks Toolbar", AddDate: 1609452000, LastModified: 1609452000, Toolbar: true},
+			},
+			warnings: []string{"smart bookmark query skipped"},
+		},
+		{
+			file:   "pocket.html",
+			format: "pocket",
+			bookmarks: []models.Bookmark{
+				{URL: "https://go.dev/blog/", Name: "The Go Blog", Folder: "Unread", AddDate: 1609452000, Tags: "go,blog"},
+				{URL: "https://example.com/", Name: "Example", Folder: "Unread"},
+				{URL: "https://example.org/", Name: "https://example.org/", Folder: "Read Archive", AddDate: 1609452100},
+			},
+			folders:  []models.Folder{{Path: "Unread"}, {Path: "Read Archive"}},
+			warnings: []string{`invalid time_added "soon" ignored`, "bookmark without href skipped"},
+		},
+		{
+			file:   "pinboard.json",
+			format: "pinboard",
+			bookmarks: []models.Bookmark{
+				{URL: "https://go.dev/", Name: "Go", Notes: "The Go programming language", AddDate: 1609459200, Tags: "go,lang"},
+				{URL: "https://example.com/", Name: "Example"},
+			},
+			warnings: []string{`invalid time "yesterday" ignored`, "bookmark without href skipped"},
+		},
+		{
+			file:   "raindrop.csv",
+			format: "raindrop",
+			bookmarks: []models.Bookmark{
+				{URL: "https://go.dev/", Name: "Go", Notes: "Read the tour", Folder: "Programming/Go", AddDate: 1609459200, Tags: "go,lang"},
+				{URL: "https://example.com/", Name: "Example", Folder: "Unsorted"},
+			},
+			folders:  []models.Folder{{Path: "Programming/Go"}, {Path: "Unsorted"}},
+			warnings: []string{`invalid created date "not a date" ignored`, "bookmark without url skipped"},
+		},
+		{
+			file:   "urls.txt",
+			format: "urls",
+			bookmarks: []models.Bookmark{
+				{URL: "https://go.dev/", Name: "The Go website"},
+				{URL: "http://example.com/"},
+			},
+			warnings: []string{"line is not a URL, skipped"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			importer, err := DetectImporter(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if importer.Name() != tt.format {
+				t.Errorf("detected format %q, want %q", importer.Name(), tt.format)
+			}
+
+			result, err := Parse(bytes.NewReader(data), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Bookmarks, tt.bookmarks) {
+				t.Errorf("Bookmarks = %+v, want %+v", result.Bookmarks, tt.bookmarks)
+			}
+			if !reflect.DeepEqual(result.Folders, tt.folders) {
+				t.Errorf("Folders = %+v, want %+v", result.Folders, tt.folders)
+			}
+			var warnings []string
+			for _, w := range result.Warnings {
+				warnings = append(warnings, w.Message)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("Warnings = %q, want %q", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestImporterWarningLines(t *testing.T) {
+	tests := []struct {
+		file   string
+		format string
+		lines  []int
+	}{
+		{"pocket.html", "pocket", []int{11, 17}},
+		{"raindrop.csv", "raindrop", []int{3, 4}},
+		{"urls.txt", "urls", []int{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			result, err := Parse(f, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var lines []int
+			for _, w := range result.Warnings {
+				lines = append(lines, w.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("warning lines = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestRaindropReadError(t *testing.T) {
+	failure := errors.New("connection reset")
+	r := io.MultiReader(strings.NewReader("title,url\nGo,https://go.dev/\n"), iotest.ErrReader(failure))
+	if _, err := (raindropImporter{}).Parse(r); !errors.Is(err, failure) {
+		t.Errorf("Parse of a failing reader returned %v, want %v", err, failure)
+	}
+}
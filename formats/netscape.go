@@ -0,0 +1,249 @@
+package formats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+	"golang.org/x/net/html"
+)
+
+// untitledFolder is used for folders exported without a name.
+const untitledFolder = "Untitled folder"
+
+// netscapeImporter reads NETSCAPE-Bookmark-file-1 documents.
+type netscapeImporter struct{}
+
+func (netscapeImporter) Name() string { return "netscape" }
+
+func (netscapeImporter) Detect(head []byte) bool {
+	lower := bytes.ToLower(head)
+	return bytes.Contains(lower, []byte("netscape-bookmark-file-1")) ||
+		(bytes.Contains(lower, []byte("<dl")) && bytes.Contains(lower, []byte("<dt>")))
+}
+
+func (netscapeImporter) Parse(r io.Reader) (*Result, error) { return ParseNetscape(r) }
+
+// netscapeParser walks the tokens of a NETSCAPE-Bookmark-file-1 document.
+//
+// The format is not well formed HTML (<DT> and <p> are never closed), so the document
+// is tokenized rather than parsed into a tree. Every <DL> opens a nesting level, which
+// is named after the <H3> heading that precedes it. A <DD> after a bookmark holds its
+// description, which is imported as the bookmark notes.
+type netscapeParser struct {
+	result *Result
+	line   int
+
+	// stack holds the folder names of the open <DL> levels, nil for unnamed levels.
+	stack []*string
+	// pending is the folder named by the last <H3>, waiting for its <DL>.
+	pending *string
+
+	folder     *models.Folder
+	folderLine int
+	bookmark   *models.Bookmark
+	linkLine   int
+	text       strings.Builder
+
+	// lastLink is the index of the last bookmark read, which a <DD> describes, or -1.
+	lastLink int
+	// notes is set while reading the <DD> description of the last bookmark.
+	notes bool
+}
+
+// ParseNetscape parses a NETSCAPE-Bookmark-file-1 document, as exported by every major browser.
+//
+// Folder nesting is rebuilt into the bookmark Folder path. Entries that cannot be imported,
+// or attributes that cannot be read, are reported as warnings instead of failing the whole file.
+func ParseNetscape(r io.Reader) (*Result, error) {
+	p := &netscapeParser{result: &Result{}, line: 1, lastLink: -1}
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return nil, z.Err()
+			}
+			break
+		}
+		line := p.line
+		p.line += bytes.Count(z.Raw(), []byte("\n"))
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			p.startTag(string(name), readAttributes(z), line)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			p.endTag(string(name), line)
+		case html.TextToken:
+			if p.folder != nil || p.bookmark != nil || p.notes {
+				p.text.Write(z.Text())
+			}
+		}
+	}
+
+	p.finishFolder()
+	p.finishLink()
+	p.finishNotes()
+	return p.result, nil
+}
+
+// readAttributes collects the attributes of the current tag with lower case keys.
+func readAttributes(z *html.Tokenizer) map[string]string {
+	attrs := map[string]string{}
+	for {
+		key, val, more := z.TagAttr()
+		if len(key) > 0 {
+			attrs[strings.ToLower(string(key))] = string(val)
+		}
+		if !more {
+			return attrs
+		}
+	}
+}
+
+func (p *netscapeParser) startTag(name string, attrs map[string]string, line int) {
+	switch name {
+	case "h3":
+		p.finishLink()
+		p.finishFolder()
+		p.finishNotes()
+		p.lastLink = -1
+		p.folder = &models.Folder{
+			AddDate:      p.timestamp(attrs, "add_date", line),
+			LastModified: p.timestamp(attrs, "last_modified", line),
+			Toolbar:      strings.EqualFold(attrs["personal_toolbar_folder"], "true"),
+		}
+		p.folderLine = line
+		p.text.Reset()
+	case "a":
+		p.finishLink()
+		p.finishFolder()
+		p.finishNotes()
+		p.bookmark = &models.Bookmark{
+			URL:          strings.TrimSpace(attrs["href"]),
+			AddDate:      p.timestamp(attrs, "add_date", line),
+			LastModified: p.timestamp(attrs, "last_modified", line),
+			Icon:         attrs["icon"],
+			Tags:         models.JoinTags(strings.Split(attrs["tags"], ",")),
+			Keyword:      strings.TrimSpace(attrs["shortcuturl"]),
+		}
+		p.linkLine = line
+		p.text.Reset()
+	case "dl":
+		p.finishLink()
+		p.finishFolder()
+		p.finishNotes()
+		p.lastLink = -1
+		p.stack = append(p.stack, p.pending)
+		p.pending = nil
+	case "dt":
+		p.finishLink()
+		p.finishFolder()
+		p.finishNotes()
+		p.lastLink = -1
+		p.pending = nil
+	case "dd":
+		// Descriptions of folders are not kept, only those of bookmarks
+		p.finishLink()
+		p.finishFolder()
+		p.finishNotes()
+		if p.lastLink >= 0 {
+			p.notes = true
+			p.text.Reset()
+		}
+	}
+}
+
+func (p *netscapeParser) endTag(name string, line int) {
+	switch name {
+	case "h3":
+		p.finishFolder()
+	case "a":
+		p.finishLink()
+	case "dl":
+		p.finishLink()
+		p.finishFolder()
+		p.finishNotes()
+		p.lastLink = -1
+		p.pending = nil
+		if len(p.stack) == 0 {
+			p.result.warn(line, "", "unexpected </DL> without a matching <DL>")
+			return
+		}
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+}
+
+// path returns the folder path of the current nesting level.
+func (p *netscapeParser) path() []string {
+	var parts []string
+	for _, name := range p.stack {
+		if name != nil {
+			parts = append(parts, *name)
+		}
+	}
+	return parts
+}
+
+// finishFolder completes the folder heading being read, if any.
+func (p *netscapeParser) finishFolder() {
+	if p.folder == nil {
+		return
+	}
+	name := strings.TrimSpace(p.text.String())
+	if name == "" {
+		p.result.warn(p.folderLine, "", fmt.Sprintf("folder without a name imported as %q", untitledFolder))
+		name = untitledFolder
+	}
+	p.folder.Path = models.JoinFolderPath(append(p.path(), name)...)
+	p.result.addFolder(*p.folder)
+	p.pending = &name
+	p.folder = nil
+}
+
+// finishLink completes the bookmark being read, if any.
+func (p *netscapeParser) finishLink() {
+	if p.bookmark == nil {
+		return
+	}
+	bookmark := *p.bookmark
+	p.bookmark = nil
+	bookmark.Name = strings.TrimSpace(p.text.String())
+	if bookmark.URL == "" {
+		p.result.warn(p.linkLine, bookmark.Name, "bookmark without HREF skipped")
+		return
+	}
+	bookmark.Folder = models.JoinFolderPath(p.path()...)
+	p.result.Bookmarks = append(p.result.Bookmarks, bookmark)
+	p.lastLink = len(p.result.Bookmarks) - 1
+}
+
+// finishNotes completes the <DD> description being read, if any, as the notes of the
+// bookmark it follows.
+func (p *netscapeParser) finishNotes() {
+	if !p.notes {
+		return
+	}
+	p.notes = false
+	p.result.Bookmarks[p.lastLink].Notes = strings.TrimSpace(p.text.String())
+	p.lastLink = -1
+}
+
+// timestamp reads a unix timestamp attribute, reporting values that cannot be parsed.
+func (p *netscapeParser) timestamp(attrs map[string]string, key string, line int) int64 {
+	val, ok := attrs[key]
+	if !ok || strings.TrimSpace(val) == "" {
+		return 0
+	}
+	ts, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+	if err != nil {
+		p.result.warn(line, "", fmt.Sprintf("invalid %v %q ignored", strings.ToUpper(key), val))
+		return 0
+	}
+	return ts
+}
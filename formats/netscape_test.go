@@ -0,0 +1,170 @@
+package formats
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+const netscapeDocument = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><A HREF="https://example.com/" ADD_DATE="1600000000">Example</A>
+    <DT><H3 ADD_DATE="1500000000" LAST_MODIFIED="1500000100" PERSONAL_TOOLBAR_FOLDER="true">Toolbar</H3>
+    <DL><p>
+        <DT><A HREF="https://go.dev/" TAGS="go, lang,go" SHORTCUTURL="go">Go</A>
+        <DD>The Go website
+        <DT><H3>A/B</H3>
+        <DL><p>
+            <DT><A HREF="https://example.org/deep" ICON="data:image/png;base64,AA==">Deep &amp; nested</A>
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="https://example.net/">Last</A>
+</DL><p>
+`
+
+func TestParseNetscape(t *testing.T) {
+	result, err := ParseNetscape(strings.NewReader(netscapeDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Warnings = %+v, want none", result.Warnings)
+	}
+
+	nested := models.JoinFolderPath("Toolbar", "A/B")
+	wantFolders := []models.Folder{
+		{Path: "Toolbar", AddDate: 1500000000, LastModified: 1500000100, Toolbar: true},
+		{Path: nested},
+	}
+	if !reflect.DeepEqual(result.Folders, wantFolders) {
+		t.Errorf("Folders = %+v, want %+v", result.Folders, wantFolders)
+	}
+
+	wantBookmarks := []models.Bookmark{
+		{URL: "https://example.com/", Name: "Example", AddDate: 1600000000},
+		{URL: "https://go.dev/", Name: "Go", Folder: "Toolbar", Tags: "go,lang", Keyword: "go", Notes: "The Go website"},
+		{URL: "https://example.org/deep", Name: "Deep & nested", Folder: nested, Icon: "data:image/png;base64,AA=="},
+		{URL: "https://example.net/", Name: "Last"},
+	}
+	if !reflect.DeepEqual(result.Bookmarks, wantBookmarks) {
+		t.Errorf("Bookmarks = %+v, want %+v", result.Bookmarks, wantBookmarks)
+	}
+}
+
+func TestParseNetscapeWarnings(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       string
+		bookmarks int
+		line      int
+		message   string
+	}{
+		{
+			name:      "bookmark without href",
+			doc:       "<DL><p>\n<DT><A>No link</A>\n<DT><A HREF=\"https://example.com/\">Kept</A>\n</DL>",
+			bookmarks: 1,
+			line:      2,
+			message:   "bookmark without HREF skipped",
+		},
+		{
+			name:      "invalid timestamp",
+			doc:       "<DL><p>\n\n<DT><A HREF=\"https://example.com/\" ADD_DATE=\"yesterday\">Kept</A>\n</DL>",
+			bookmarks: 1,
+			line:      3,
+			message:   `invalid ADD_DATE "yesterday" ignored`,
+		},
+		{
+			name:      "folder without a name",
+			doc:       "<DL><p>\n<DT><H3></H3>\n<DL><p>\n<DT><A HREF=\"https://example.com/\">Kept</A>\n</DL>\n</DL>",
+			bookmarks: 1,
+			line:      2,
+			message:   `folder without a name imported as "Untitled folder"`,
+		},
+		{
+			name:      "unbalanced list",
+			doc:       "<DL><p>\n<DT><A HREF=\"https://example.com/\">Kept</A>\n</DL>\n</DL>",
+			bookmarks: 1,
+			line:      4,
+			message:   "unexpected </DL> without a matching <DL>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseNetscape(strings.NewReader(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Bookmarks) != tt.bookmarks {
+				t.Errorf("got %d bookmarks, want %d", len(result.Bookmarks), tt.bookmarks)
+			}
+			if len(result.Warnings) != 1 {
+				t.Fatalf("Warnings = %+v, want one", result.Warnings)
+			}
+			if w := result.Warnings[0]; w.Line != tt.line || w.Message != tt.message {
+				t.Errorf("warning = line %d %q, want line %d %q", w.Line, w.Message, tt.line, tt.message)
+			}
+		})
+	}
+}
+
+func TestUntitledFolderBookmarks(t *testing.T) {
+	doc := "<DL><p>\n<DT><H3> </H3>\n<DL><p>\n<DT><A HREF=\"https://example.com/\">Kept</A>\n</DL>\n</DL>"
+	result, err := ParseNetscape(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Bookmarks) != 1 || result.Bookmarks[0].Folder != untitledFolder {
+		t.Errorf("Bookmarks = %+v, want one in %q", result.Bookmarks, untitledFolder)
+	}
+}
+
+func TestNetscapeRoundTrip(t *testing.T) {
+	first, err := ParseNetscape(strings.NewReader(netscapeDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An empty folder is written from the folder list alone
+	first.Folders = append(first.Folders, models.Folder{Path: models.JoinFolderPath("Empty <folder>"), AddDate: 1400000000})
+	first.Bookmarks[3].Notes = "Multi\nline <notes> & more"
+
+	bookmarks := append([]models.Bookmark(nil), first.Bookmarks...)
+	sort.SliceStable(bookmarks, func(i, j int) bool {
+		return models.CompareFolderPaths(bookmarks[i].Folder, bookmarks[j].Folder) < 0
+	})
+	var buf bytes.Buffer
+	w := NewNetscapeWriter(&buf, first.Folders)
+	for _, b := range bookmarks {
+		if err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := ParseNetscape(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Warnings) != 0 {
+		t.Errorf("Warnings = %+v, want none", second.Warnings)
+	}
+	if !reflect.DeepEqual(second.Bookmarks, bookmarks) {
+		t.Errorf("Bookmarks after a round trip = %+v, want %+v", second.Bookmarks, bookmarks)
+	}
+	folders := append([]models.Folder(nil), first.Folders...)
+	sort.Slice(folders, func(i, j int) bool { return models.CompareFolderPaths(folders[i].Path, folders[j].Path) < 0 })
+	sort.Slice(second.Folders, func(i, j int) bool {
+		return models.CompareFolderPaths(second.Folders[i].Path, second.Folders[j].Path) < 0
+	})
+	if !reflect.DeepEqual(second.Folders, folders) {
+		t.Errorf("Folders after a round trip = %+v, want %+v", second.Folders, folders)
+	}
+}
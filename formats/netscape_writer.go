@@ -0,0 +1,134 @@
+package formats
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+const netscapeHeader = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`
+
+// netscapeExporter writes NETSCAPE-Bookmark-file-1 documents that browsers can import.
+type netscapeExporter struct{}
+
+func (netscapeExporter) Name() string        { return "netscape" }
+func (netscapeExporter) ContentType() string { return "text/html" }
+func (netscapeExporter) Extension() string   { return "html" }
+
+func (netscapeExporter) NewWriter(w io.Writer, folders []models.Folder, options ExportOptions) (BookmarkWriter, error) {
+	return NewNetscapeWriter(w, folders), nil
+}
+
+// NetscapeWriter streams bookmarks as a NETSCAPE-Bookmark-file-1 document.
+//
+// Bookmarks must be written in folder order (see models.CompareFolderPaths) for the
+// folders to nest correctly. The output can be read back with ParseNetscape.
+type NetscapeWriter struct {
+	w       *bufio.Writer
+	walker  *folderWalker
+	started bool
+}
+
+// NewNetscapeWriter returns a writer for the given output. The folders are used for
+// folder attributes and to write folders that hold no bookmarks.
+func NewNetscapeWriter(w io.Writer, folders []models.Folder) *NetscapeWriter {
+	n := &NetscapeWriter{w: bufio.NewWriter(w), walker: newFolderWalker(folders)}
+	n.walker.openFolder = n.openFolder
+	n.walker.closeFolder = n.closeFolder
+	return n
+}
+
+// Write adds a bookmark to the document.
+func (n *NetscapeWriter) Write(b models.Bookmark) error {
+	if err := n.start(); err != nil {
+		return err
+	}
+	if err := n.walker.moveTo(b.Folder); err != nil {
+		return err
+	}
+
+	var attrs strings.Builder
+	writeAttr(&attrs, "HREF", b.URL)
+	writeTimestampAttr(&attrs, "ADD_DATE", b.AddDate)
+	writeTimestampAttr(&attrs, "LAST_MODIFIED", b.LastModified)
+	writeAttr(&attrs, "ICON", b.Icon)
+	writeAttr(&attrs, "SHORTCUTURL", b.Keyword)
+	writeAttr(&attrs, "TAGS", b.Tags)
+	_, err := fmt.Fprintf(n.w, "%v<DT><A%v>%v</A>\n", n.indent(), attrs.String(), html.EscapeString(b.Name))
+	if err != nil || b.Notes == "" {
+		return err
+	}
+	_, err = fmt.Fprintf(n.w, "%v<DD>%v\n", n.indent(), html.EscapeString(b.Notes))
+	return err
+}
+
+// Close writes the remaining folders, ends the document and flushes the output.
+func (n *NetscapeWriter) Close() error {
+	if err := n.start(); err != nil {
+		return err
+	}
+	if err := n.walker.finish(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(n.w, "</DL><p>\n"); err != nil {
+		return err
+	}
+	return n.w.Flush()
+}
+
+func (n *NetscapeWriter) start() error {
+	if n.started {
+		return nil
+	}
+	n.started = true
+	_, err := io.WriteString(n.w, netscapeHeader)
+	return err
+}
+
+func (n *NetscapeWriter) openFolder(name string, folder models.Folder) error {
+	var attrs strings.Builder
+	writeTimestampAttr(&attrs, "ADD_DATE", folder.AddDate)
+	writeTimestampAttr(&attrs, "LAST_MODIFIED", folder.LastModified)
+	if folder.Toolbar {
+		writeAttr(&attrs, "PERSONAL_TOOLBAR_FOLDER", "true")
+	}
+	// The walker has already entered the folder, so its heading sits one level up.
+	indent := strings.Repeat("    ", n.walker.depth())
+	_, err := fmt.Fprintf(n.w, "%v<DT><H3%v>%v</H3>\n%v<DL><p>\n", indent, attrs.String(), html.EscapeString(name), indent)
+	return err
+}
+
+func (n *NetscapeWriter) closeFolder() error {
+	_, err := fmt.Fprintf(n.w, "%v</DL><p>\n", strings.Repeat("    ", n.walker.depth()+1))
+	return err
+}
+
+func (n *NetscapeWriter) indent() string {
+	return strings.Repeat("    ", n.walker.depth()+1)
+}
+
+func writeAttr(b *strings.Builder, key, val string) {
+	if val == "" {
+		return
+	}
+	fmt.Fprintf(b, ` %v="%v"`, key, html.EscapeString(val))
+}
+
+func writeTimestampAttr(b *strings.Builder, key string, ts int64) {
+	if ts == 0 {
+		return
+	}
+	fmt.Fprintf(b, ` %v="%d"`, key, ts)
+}
@@ -0,0 +1,64 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// pinboardImporter reads the JSON export of Pinboard.
+type pinboardImporter struct{}
+
+type pinboardPost struct {
+	Href        string `json:"href"`
+	Description string `json:"description"`
+	Extended    string `json:"extended"`
+	Time        string `json:"time"`
+	Shared      string `json:"shared"`
+	ToRead      string `json:"toread"`
+	Tags        string `json:"tags"`
+}
+
+func (pinboardImporter) Name() string { return "pinboard" }
+
+func (pinboardImporter) Detect(head []byte) bool {
+	return isJSONArray(head) && bytes.Contains(head, []byte(`"href"`))
+}
+
+func (pinboardImporter) Parse(r io.Reader) (*Result, error) {
+	var posts []pinboardPost
+	if err := json.NewDecoder(r).Decode(&posts); err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for _, post := range posts {
+		if post.Href == "" {
+			result.warn(0, post.Description, "bookmark without href skipped")
+			continue
+		}
+		bookmark := models.Bookmark{
+			URL:   post.Href,
+			Name:  post.Description,
+			Notes: strings.TrimSpace(post.Extended),
+			// Pinboard tags are separated by spaces
+			Tags: models.JoinTags(strings.Fields(post.Tags)),
+		}
+		if post.Time != "" {
+			added, err := time.Parse(time.RFC3339, post.Time)
+			if err != nil {
+				result.warn(0, post.Href, fmt.Sprintf("invalid time %q ignored", post.Time))
+			} else {
+				bookmark.AddDate = added.Unix()
+			}
+		}
+		result.Bookmarks = append(result.Bookmarks, bookmark)
+	}
+
+	return result, nil
+}
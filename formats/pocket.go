@@ -0,0 +1,110 @@
+package formats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+	"golang.org/x/net/html"
+)
+
+// pocketImporter reads the HTML export of Pocket.
+//
+// The export is a list of links per section ("Unread", "Read Archive"). Sections are
+// imported as folders.
+type pocketImporter struct{}
+
+func (pocketImporter) Name() string { return "pocket" }
+
+func (pocketImporter) Detect(head []byte) bool {
+	lower := bytes.ToLower(head)
+	return bytes.Contains(lower, []byte("<title>pocket export</title>")) ||
+		(bytes.Contains(lower, []byte("<ul")) && bytes.Contains(lower, []byte("time_added=")))
+}
+
+func (pocketImporter) Parse(r io.Reader) (*Result, error) {
+	result := &Result{}
+	z := html.NewTokenizer(r)
+	line := 1
+
+	var section string
+	var inSection bool
+	var bookmark *models.Bookmark
+	var linkLine int
+	var text strings.Builder
+
+	finish := func() {
+		if bookmark == nil {
+			return
+		}
+		bookmark.Name = strings.TrimSpace(text.String())
+		if bookmark.URL == "" {
+			result.warn(linkLine, bookmark.Name, "bookmark without href skipped")
+		} else {
+			result.Bookmarks = append(result.Bookmarks, *bookmark)
+		}
+		bookmark = nil
+	}
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return nil, z.Err()
+			}
+			break
+		}
+		tokenLine := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+
+		switch tt {
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "h1":
+				finish()
+				inSection = true
+				text.Reset()
+			case "a":
+				finish()
+				attrs := readAttributes(z)
+				bookmark = &models.Bookmark{
+					URL:    strings.TrimSpace(attrs["href"]),
+					Folder: models.JoinFolderPath(section),
+					Tags:   models.JoinTags(strings.Split(attrs["tags"], ",")),
+				}
+				if added := strings.TrimSpace(attrs["time_added"]); added != "" {
+					ts, err := strconv.ParseInt(added, 10, 64)
+					if err != nil {
+						result.warn(tokenLine, "", fmt.Sprintf("invalid time_added %q ignored", added))
+					}
+					bookmark.AddDate = ts
+				}
+				linkLine = tokenLine
+				text.Reset()
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "h1":
+				section = strings.TrimSpace(text.String())
+				inSection = false
+				if section != "" {
+					result.addFolder(models.Folder{Path: models.JoinFolderPath(section)})
+				}
+			case "a":
+				finish()
+			}
+		case html.TextToken:
+			if inSection || bookmark != nil {
+				text.Write(z.Text())
+			}
+		}
+	}
+	finish()
+
+	return result, nil
+}
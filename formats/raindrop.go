@@ -0,0 +1,120 @@
+package formats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// raindropImporter reads the CSV export of Raindrop.io.
+//
+// Columns are looked up by their header name, so only url is required.
+type raindropImporter struct{}
+
+func (raindropImporter) Name() string { return "raindrop" }
+
+func (raindropImporter) Detect(head []byte) bool {
+	line, _, _ := bytes.Cut(head, []byte("\n"))
+	header, err := csv.NewReader(bytes.NewReader(line)).Read()
+	if err != nil {
+		return false
+	}
+	columns := csvColumns(header)
+	_, hasURL := columns["url"]
+	_, hasTitle := columns["title"]
+	return hasURL && hasTitle
+}
+
+func (raindropImporter) Parse(r io.Reader) (*Result, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := csvColumns(header)
+	if _, ok := columns["url"]; !ok {
+		return nil, fmt.Errorf("raindrop export has no url column")
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	result := &Result{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.warn(parseErr.StartLine, "", fmt.Sprintf("unreadable row skipped: %v", parseErr.Err))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		bookmark := models.Bookmark{
+			URL:   field(record, "url"),
+			Name:  field(record, "title"),
+			Notes: field(record, "note"),
+			Tags:  models.JoinTags(strings.Split(field(record, "tags"), ",")),
+		}
+		if bookmark.URL == "" {
+			result.warn(line, bookmark.Name, "bookmark without url skipped")
+			continue
+		}
+		if folder := field(record, "folder"); folder != "" {
+			// Nested collections are exported as "Parent/Child"
+			bookmark.Folder = models.JoinFolderPath(splitTrimmed(folder, "/")...)
+			result.addFolder(models.Folder{Path: bookmark.Folder})
+		}
+		if created := field(record, "created"); created != "" {
+			added, err := time.Parse(time.RFC3339, created)
+			if err != nil {
+				result.warn(line, bookmark.URL, fmt.Sprintf("invalid created date %q ignored", created))
+			} else {
+				bookmark.AddDate = added.Unix()
+			}
+		}
+		result.Bookmarks = append(result.Bookmarks, bookmark)
+	}
+
+	return result, nil
+}
+
+// csvColumns maps lower case header names to their column index.
+func csvColumns(header []string) map[string]int {
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	return columns
+}
+
+// splitTrimmed splits s and drops blank parts.
+func splitTrimmed(s, sep string) []string {
+	var parts []string
+	for _, p := range strings.Split(s, sep) {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
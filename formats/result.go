@@ -0,0 +1,34 @@
+package formats
+
+import (
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// Result holds everything extracted from a bookmark file.
+type Result struct {
+	Bookmarks []models.Bookmark
+	Folders   []models.Folder
+	Warnings  []Warning
+}
+
+// Warning describes an entry that was skipped or only partially imported.
+type Warning struct {
+	Line    int    `json:"line,omitempty"`
+	Entry   string `json:"entry,omitempty"`
+	Message string `json:"message"`
+}
+
+// warn records a warning against the given entry.
+func (r *Result) warn(line int, entry, message string) {
+	r.Warnings = append(r.Warnings, Warning{Line: line, Entry: entry, Message: message})
+}
+
+// addFolder records a folder unless a folder with the same path was already seen.
+func (r *Result) addFolder(folder models.Folder) {
+	for _, f := range r.Folders {
+		if f.Path == folder.Path {
+			return
+		}
+	}
+	r.Folders = append(r.Folders, folder)
+}
@@ -0,0 +1,86 @@
+package formats
+
+import (
+	"sort"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// folderWalker turns a stream of bookmarks in folder order into folder open and close events,
+// which is what the nested export formats need.
+//
+// Known folders are visited in order as well, so folders without bookmarks are still written.
+type folderWalker struct {
+	open    []string
+	folders []models.Folder
+	byPath  map[string]models.Folder
+
+	openFolder  func(name string, folder models.Folder) error
+	closeFolder func() error
+}
+
+func newFolderWalker(folders []models.Folder) *folderWalker {
+	w := &folderWalker{byPath: map[string]models.Folder{}}
+	for _, f := range folders {
+		if f.Path == "" {
+			continue
+		}
+		w.folders = append(w.folders, f)
+		w.byPath[f.Path] = f
+	}
+	sort.Slice(w.folders, func(i, j int) bool {
+		return models.CompareFolderPaths(w.folders[i].Path, w.folders[j].Path) < 0
+	})
+	return w
+}
+
+// moveTo opens the given folder path, visiting any known folders that sort before it.
+func (w *folderWalker) moveTo(path string) error {
+	for len(w.folders) > 0 && models.CompareFolderPaths(w.folders[0].Path, path) <= 0 {
+		next := w.folders[0]
+		w.folders = w.folders[1:]
+		if err := w.enter(next.Path); err != nil {
+			return err
+		}
+	}
+	return w.enter(path)
+}
+
+// finish visits the remaining known folders and closes every open folder.
+func (w *folderWalker) finish() error {
+	for _, f := range w.folders {
+		if err := w.enter(f.Path); err != nil {
+			return err
+		}
+	}
+	w.folders = nil
+	return w.enter("")
+}
+
+// enter closes the open folders that are not part of path and opens the missing ones.
+func (w *folderWalker) enter(path string) error {
+	target := models.SplitFolderPath(path)
+	common := 0
+	for common < len(w.open) && common < len(target) && w.open[common] == target[common] {
+		common++
+	}
+	for len(w.open) > common {
+		w.open = w.open[:len(w.open)-1]
+		if err := w.closeFolder(); err != nil {
+			return err
+		}
+	}
+	for _, name := range target[common:] {
+		w.open = append(w.open, name)
+		folder := w.byPath[models.JoinFolderPath(w.open...)]
+		if err := w.openFolder(name, folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// depth returns the number of open folders.
+func (w *folderWalker) depth() int {
+	return len(w.open)
+}
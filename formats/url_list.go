@@ -0,0 +1,71 @@
+package formats
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// urlListImporter reads plain text files with one URL per line.
+//
+// Text after the URL, separated by whitespace, is used as the bookmark name.
+// Blank lines and lines starting with # are ignored.
+type urlListImporter struct{}
+
+func (urlListImporter) Name() string { return "urls" }
+
+func (urlListImporter) Detect(head []byte) bool {
+	// Most lines have to be URLs, a few stray lines are reported as warnings on import
+	var urls, other int
+	scanner := bufio.NewScanner(bytes.NewReader(head))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if isWebURL(strings.Fields(line)[0]) {
+			urls++
+		} else {
+			other++
+		}
+	}
+	return urls > 0 && urls >= other*2
+}
+
+func (urlListImporter) Parse(r io.Reader) (*Result, error) {
+	result := &Result{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		link := strings.Fields(text)[0]
+		name := strings.TrimPrefix(text, link)
+		if !isWebURL(link) {
+			result.warn(line, text, "line is not a URL, skipped")
+			continue
+		}
+		result.Bookmarks = append(result.Bookmarks, models.Bookmark{
+			URL:  link,
+			Name: strings.TrimSpace(name),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// isWebURL reports whether s is an absolute http or https URL.
+func isWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,156 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// ArchivesInterval is how often requested page archives are fetched and expired ones removed.
+const ArchivesInterval = "@every 1m"
+
+// archivesBatch is the number of archives fetched or removed per run.
+const archivesBatch = 50
+
+// ErrArchiveQuota is returned when an archive does not fit in the user's archive quota.
+var ErrArchiveQuota = errors.New("archive quota exceeded")
+
+// archiveClient fetches the pages to archive, refusing internal addresses like metadataClient.
+var archiveClient = library.NewPublicClient(30 * time.Second)
+
+// Archives fetches the pages of requested archives, then removes the archives past the
+// retention period or whose bookmark was permanently deleted.
+func Archives() {
+	ctx := context.Background()
+
+	pending, err := repositories.GetPendingArchives(archivesBatch)
+	if err != nil {
+		log.Printf("Archives: %v", err)
+		return
+	}
+	for _, archive := range pending {
+		if err := ArchivePage(ctx, archive); err != nil {
+			log.Printf("Archives: failed to archive %v %v", archive.URL, err)
+		}
+	}
+
+	var archivedBefore time.Time
+	if retention := config.Cfg.Archive.Retention; retention > 0 {
+		archivedBefore = time.Now().Add(-retention)
+	}
+	expired, err := repositories.GetExpiredArchives(archivedBefore, archivesBatch)
+	if err != nil {
+		log.Printf("Archives: %v", err)
+		return
+	}
+	for _, archive := range expired {
+		if err := RemoveArchive(ctx, archive); err != nil {
+			log.Printf("Archives: failed to remove archive %v %v", archive.ID, err)
+		}
+	}
+
+	if len(pending) > 0 || len(expired) > 0 {
+		log.Printf("Archives: archived %v pages, removed %v archives", len(pending), len(expired))
+	}
+}
+
+// ArchivePage fetches the page of an archive, extracts its readable content and stores the
+// HTML snapshot and plain text. Failures are recorded on the archive and returned.
+func ArchivePage(ctx context.Context, archive models.Archive) error {
+	cfg := config.Cfg.Archive
+
+	err := storeArchive(ctx, cfg, &archive)
+	if err != nil {
+		archive.Status = models.ArchiveFailed
+		archive.Error = err.Error()
+	}
+	if err := repositories.SaveArchive(archive); err != nil {
+		return err
+	}
+	return err
+}
+
+func storeArchive(ctx context.Context, cfg *config.ArchiveConfig, archive *models.Archive) error {
+	readable, err := library.FetchReadable(ctx, archiveClient, archive.URL, cfg.MaxPageBytes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	document := []byte(readable.Document(archive.URL, now))
+	text := []byte(readable.Text)
+	size := int64(len(document) + len(text))
+
+	// A refreshed archive replaces the previous snapshot, so its size is not counted twice
+	usage, err := repositories.GetArchiveUsage(archive.UserID)
+	if err != nil {
+		return err
+	}
+	if usage.Bytes-archive.Size+size > cfg.QuotaBytes {
+		return fmt.Errorf("%w: %v of %v bytes used", ErrArchiveQuota, usage.Bytes, cfg.QuotaBytes)
+	}
+
+	htmlKey := fmt.Sprintf("archives/%v/%v.html", archive.UserID, archive.ID)
+	textKey := fmt.Sprintf("archives/%v/%v.txt", archive.UserID, archive.ID)
+	if err := cfg.Storage.Put(ctx, htmlKey, document, "text/html; charset=utf-8"); err != nil {
+		return err
+	}
+	if err := cfg.Storage.Put(ctx, textKey, text, "text/plain; charset=utf-8"); err != nil {
+		return err
+	}
+	if err := repositories.SetReadingTime(archive.BookmarkID, readable.ReadingMinutes()); err != nil {
+		return err
+	}
+
+	archive.Status = models.ArchiveCompleted
+	archive.Title = readable.Title
+	archive.Error = ""
+	archive.HTMLKey = htmlKey
+	archive.TextKey = textKey
+	archive.Size = size
+	archive.ArchivedAt = &now
+	return nil
+}
+
+// RemoveOrphanedArchives removes the archives, and their stored snapshots, of the bookmarks
+// of a user that were permanently deleted, or those of every user when userID is empty.
+// Archives that could not be removed are left for the next run of Archives.
+func RemoveOrphanedArchives(ctx context.Context, userID string) (int, error) {
+	removed := 0
+	for {
+		archives, err := repositories.GetOrphanedArchives(userID, archivesBatch)
+		if err != nil {
+			return removed, err
+		}
+		for _, archive := range archives {
+			if err := RemoveArchive(ctx, archive); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if len(archives) < archivesBatch {
+			return removed, nil
+		}
+	}
+}
+
+// RemoveArchive deletes the stored snapshot of an archive and the archive itself.
+func RemoveArchive(ctx context.Context, archive models.Archive) error {
+	storage := config.Cfg.Archive.Storage
+	for _, key := range []string{archive.HTMLKey, archive.TextKey} {
+		if key == "" {
+			continue
+		}
+		if err := storage.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return repositories.DeleteArchive(archive.ID)
+}
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// bulkQueue is the Redis list holding the IDs of bulk jobs waiting for a worker.
+const bulkQueue = "jobs:bulk"
+
+// BulkParams are the inputs of a bulk job, stored as the job params.
+type BulkParams struct {
+	IDs []string `json:"ids"`
+	repositories.BulkOperation
+}
+
+// EnqueueBulk hands a bulk job to the workers.
+func EnqueueBulk(jobID string) error {
+	return config.Cfg.RedisClient.LPush(bulkQueue, jobID).Err()
+}
+
+// StartBulkWorkers queues bulk jobs that were interrupted by a restart, or whose worker
+// stopped, again and starts the given number of workers processing the bulk queue.
+func StartBulkWorkers(workers int) {
+	go startJobQueue(models.JobKindBulk, EnqueueBulk)
+	for i := 0; i < workers; i++ {
+		go queueWorker(bulkQueue, RunBulk)
+	}
+}
+
+// RunBulk applies the operation of a bulk job to its bookmarks.
+// Jobs that are not queued, for example because another worker took them, are left alone.
+func RunBulk(jobID string) {
+	claimed, err := repositories.ClaimJob(jobID)
+	if err != nil {
+		log.Printf("RunBulk: failed to claim bulk job %v %v", jobID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	stopLease := holdJobLease(jobID)
+
+	job, err := repositories.GetJob(jobID)
+	if err != nil {
+		stopLease()
+		log.Printf("RunBulk: failed to load bulk job %v %v", jobID, err)
+		return
+	}
+
+	result, err := runBulk(&job)
+	if err != nil {
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = models.JobCompleted
+		data, _ := json.Marshal(result)
+		job.Result = string(data)
+	}
+	stopLease()
+	if err := repositories.FinishJob(&job); err != nil {
+		log.Printf("RunBulk: failed to save bulk job %v %v", jobID, err)
+	}
+}
+
+func runBulk(job *models.Job) (*repositories.BulkResult, error) {
+	var params BulkParams
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		return nil, fmt.Errorf("invalid bulk parameters: %v", err)
+	}
+
+	progress := func(processed, total int) {
+		job.Processed, job.Total = processed, total
+		if err := repositories.SetJobProgress(job.ID, processed, total); err != nil {
+			log.Printf("runBulk: failed to record progress %v", err)
+		}
+	}
+	return repositories.ApplyBulk(job.UserID, params.IDs, params.BulkOperation, progress)
+}
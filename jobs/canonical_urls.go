@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"log"
+
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// CanonicalURLsInterval is how often bookmarks without a canonical URL are filled in.
+const CanonicalURLsInterval = "@every 10m"
+
+// canonicalURLsBatch is the number of bookmarks updated per query.
+const canonicalURLsBatch = 500
+
+// CanonicalURLs stores the canonical URL of bookmarks saved before duplicate detection
+// existed, so they show up in the duplicates listing.
+func CanonicalURLs() {
+	total := 0
+	for {
+		updated, err := repositories.BackfillCanonicalURLs(canonicalURLsBatch)
+		if err != nil {
+			log.Printf("CanonicalURLs: failed to update bookmarks %v", err)
+			return
+		}
+		total += updated
+		if updated < canonicalURLsBatch {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("CanonicalURLs: stored canonical URLs for %v bookmarks", total)
+	}
+}
@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"log"
+
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// IconsInterval is how often inline bookmark icons are moved into the icon store.
+const IconsInterval = "@every 10m"
+
+// iconsBatch is the number of bookmarks updated per query.
+const iconsBatch = 500
+
+// Icons moves the data URI icons of bookmarks saved before the icon store existed into the
+// store, so they are served from /icons/:hash instead of with every bookmark.
+func Icons() {
+	total := 0
+	for {
+		updated, err := repositories.BackfillIcons(iconsBatch)
+		if err != nil {
+			log.Printf("Icons: failed to update bookmarks %v", err)
+			return
+		}
+		total += updated
+		if updated < iconsBatch {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Icons: stored icons for %v bookmarks", total)
+	}
+}
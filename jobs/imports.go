@@ -0,0 +1,160 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/formats"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// importQueue is the Redis list holding the IDs of import jobs waiting for a worker.
+const importQueue = "jobs:imports"
+
+// importKeyPrefix prefixes the storage keys of uploaded import files.
+const importKeyPrefix = "imports/"
+
+// ImportParams are the inputs of an import job, stored as the job params.
+// FileKey is the storage key of the uploaded file, see SaveImportFile.
+type ImportParams struct {
+	Format   string `json:"format"`
+	FileName string `json:"file_name"`
+	FileKey  string `json:"file_key"`
+	repositories.ImportOptions
+}
+
+// SaveImportFile stores an uploaded bookmark file under the given name until its import job
+// has read it, and returns its storage key. Files are kept in the archive storage, so the
+// worker running the import can read them whichever instance received the upload.
+func SaveImportFile(ctx context.Context, name string, data []byte) (string, error) {
+	key := importKeyPrefix + name
+	if err := config.Cfg.Archive.Storage.Put(ctx, key, data, "application/octet-stream"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// RemoveImportFile deletes an uploaded bookmark file that is no longer needed.
+func RemoveImportFile(ctx context.Context, key string) error {
+	return config.Cfg.Archive.Storage.Delete(ctx, key)
+}
+
+// EnqueueImport hands an import job to the workers.
+func EnqueueImport(jobID string) error {
+	return config.Cfg.RedisClient.LPush(importQueue, jobID).Err()
+}
+
+// StartImportWorkers queues imports that were interrupted by a restart, or whose worker
+// stopped, again and starts the given number of workers processing the import queue.
+func StartImportWorkers(workers int) {
+	go startJobQueue(models.JobKindImport, EnqueueImport)
+	for i := 0; i < workers; i++ {
+		go queueWorker(importQueue, RunImport)
+	}
+}
+
+// RunImport parses the uploaded file of an import job and saves its bookmarks.
+// Jobs that are not queued, for example because another worker took them, are left alone.
+func RunImport(jobID string) {
+	claimed, err := repositories.ClaimJob(jobID)
+	if err != nil {
+		log.Printf("RunImport: failed to claim import %v %v", jobID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	stopLease := holdJobLease(jobID)
+
+	job, err := repositories.GetJob(jobID)
+	if err != nil {
+		stopLease()
+		log.Printf("RunImport: failed to load import %v %v", jobID, err)
+		return
+	}
+
+	report, err := runImport(&job)
+	if err != nil {
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = models.JobCompleted
+		data, _ := json.Marshal(report)
+		job.Result = string(data)
+	}
+	stopLease()
+	if err := repositories.FinishJob(&job); err != nil {
+		log.Printf("RunImport: failed to save import %v %v", jobID, err)
+	}
+}
+
+func runImport(job *models.Job) (*repositories.ImportReport, error) {
+	var params ImportParams
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		return nil, fmt.Errorf("invalid import parameters: %v", err)
+	}
+	ctx := context.Background()
+	data, err := config.Cfg.Archive.Storage.Get(ctx, params.FileKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the uploaded file: %v", err)
+	}
+	// The upload is only needed again if the job is interrupted before it finishes
+	defer func() {
+		if err := RemoveImportFile(ctx, params.FileKey); err != nil {
+			log.Printf("runImport: failed to remove upload %v %v", params.FileKey, err)
+		}
+	}()
+
+	result, err := ParseBookmarks(job.UserID, bytes.NewReader(data), params.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	options := params.ImportOptions
+	options.Progress = func(processed, total int) {
+		job.Processed, job.Total = processed, total
+		if err := repositories.SetJobProgress(job.ID, processed, total); err != nil {
+			log.Printf("runImport: failed to record progress %v", err)
+		}
+	}
+	report, err := repositories.ImportBookmarks(job.UserID, result, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save bookmarks: %v", err)
+	}
+
+	return report, nil
+}
+
+// ParseBookmarks parses bookmark data and returns the bookmarks and folders it contains.
+//
+// The data is read with the importer for the given format, or the detected format when format is empty.
+// Every bookmark and folder is assigned to the given user, and every bookmark is filed by the
+// user's rules.
+//
+// Entries that cannot be imported are reported in the result warnings. An error is only returned
+// when the data itself cannot be read.
+func ParseBookmarks(userID string, r io.Reader, format string) (*formats.Result, error) {
+	result, err := formats.Parse(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range result.Bookmarks {
+		result.Bookmarks[i].UserID = userID
+	}
+	for i := range result.Folders {
+		result.Folders[i].UserID = userID
+	}
+
+	if err := repositories.ApplyUsersRules(userID, result.Bookmarks); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// LinkCheckInterval is how often bookmark links are checked.
+const LinkCheckInterval = "@every 30m"
+
+// linkCheckBatch is the number of bookmarks checked per run.
+const linkCheckBatch = 1000
+
+// LinkCheck checks the links of the bookmarks that are due for a check and records
+// their HTTP status, redirects and consecutive failures.
+func LinkCheck() {
+	cfg := config.Cfg.LinkCheck
+	checker := library.NewLinkChecker(library.NewPublicClient(cfg.Timeout), cfg.Concurrency, cfg.HostInterval)
+
+	checked, err := CheckLinks(context.Background(), checker, time.Now().Add(-cfg.RecheckAfter), linkCheckBatch, cfg.UpdateRedirects)
+	if err != nil {
+		log.Printf("LinkCheck: %v", err)
+	}
+	if checked > 0 {
+		log.Printf("LinkCheck: checked %v links", checked)
+	}
+}
+
+// CheckLinks checks up to limit bookmarks last checked before checkedBefore with the given
+// checker and returns how many were checked.
+func CheckLinks(ctx context.Context, checker *library.LinkChecker, checkedBefore time.Time, limit int, updateRedirects bool) (int, error) {
+	bookmarks, err := repositories.GetBookmarksToCheck(checkedBefore, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	// The same URL can be saved by many users, so every URL is only fetched once
+	byURL := map[string][]models.Bookmark{}
+	var urls []string
+	for _, b := range bookmarks {
+		if _, ok := byURL[b.URL]; !ok {
+			urls = append(urls, b.URL)
+		}
+		byURL[b.URL] = append(byURL[b.URL], b)
+	}
+
+	checked := 0
+	checker.CheckAll(ctx, urls, func(check library.LinkCheck) {
+		for _, b := range byURL[check.URL] {
+			if err := repositories.SaveLinkCheck(b, check, updateRedirects); err != nil {
+				log.Printf("CheckLinks: failed to save check of %v %v", b.ID, err)
+				continue
+			}
+			checked++
+		}
+	})
+
+	return checked, nil
+}
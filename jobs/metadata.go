@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// MetadataInterval is how often new bookmarks are enriched with their page metadata.
+const MetadataInterval = "@every 1m"
+
+// metadataBatch is the number of bookmarks enriched per run.
+const metadataBatch = 200
+
+// metadataConcurrency is the number of pages fetched at the same time.
+const metadataConcurrency = 4
+
+// metadataClient fetches pages for their metadata. Bookmark URLs come from users, so it
+// refuses to connect to internal addresses.
+var metadataClient = library.NewPublicClient(15 * time.Second)
+
+// Metadata fetches the page metadata of bookmarks created or imported since the last run
+// and fills in their missing name, description, image and icon.
+func Metadata() {
+	bookmarks, err := repositories.GetBookmarksWithoutMetadata(metadataBatch)
+	if err != nil {
+		log.Printf("Metadata: %v", err)
+		return
+	}
+
+	queue := make(chan models.Bookmark)
+	var wg sync.WaitGroup
+	for i := 0; i < metadataConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range queue {
+				if _, err := RefreshMetadata(context.Background(), b); err != nil {
+					log.Printf("Metadata: %v %v", b.URL, err)
+				}
+			}
+		}()
+	}
+	for _, b := range bookmarks {
+		queue <- b
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(bookmarks) > 0 {
+		log.Printf("Metadata: enriched %v bookmarks", len(bookmarks))
+	}
+}
+
+// RefreshMetadata fetches the page metadata of a bookmark and saves it, along with the page
+// favicon when the bookmark has no icon. Pages that cannot be fetched are still marked as
+// fetched so they are not retried every run, and the fetch error is returned with the
+// saved bookmark.
+func RefreshMetadata(ctx context.Context, bookmark models.Bookmark) (models.Bookmark, error) {
+	meta, fetchErr := library.FetchMetadata(ctx, metadataClient, bookmark.URL)
+
+	iconHash := ""
+	if meta != nil && meta.Favicon != "" && bookmark.IconHash == "" {
+		iconHash = fetchFavicon(ctx, meta.Favicon)
+	}
+
+	bookmark, err := repositories.SaveBookmarkMetadata(bookmark, meta, iconHash)
+	if err != nil {
+		return bookmark, err
+	}
+	return bookmark, fetchErr
+}
+
+// fetchFavicon downloads and stores a favicon, returning its hash or an empty string when it
+// cannot be used.
+func fetchFavicon(ctx context.Context, iconURL string) string {
+	data, err := library.FetchIcon(ctx, metadataClient, iconURL)
+	if err != nil {
+		log.Printf("fetchFavicon: %v %v", iconURL, err)
+		return ""
+	}
+	hash, err := repositories.SaveIcon(data)
+	if err != nil {
+		log.Printf("fetchFavicon: %v %v", iconURL, err)
+		return ""
+	}
+	return hash
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// jobLeaseRenewal is how often a running job renews its lease, often enough that a slow
+// renewal does not let it expire.
+const jobLeaseRenewal = repositories.JobLease / 4
+
+// queueWorker runs the jobs whose IDs are pushed to a Redis list, one at a time.
+func queueWorker(queue string, run func(jobID string)) {
+	for {
+		values, err := config.Cfg.RedisClient.BRPop(5*time.Second, queue).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("queueWorker: failed to read %v %v", queue, err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		run(values[1])
+	}
+}
+
+// startJobQueue hands the queued jobs of a kind to the workers again, as they may have been
+// lost from the queue when the application stopped, and keeps handing back the jobs whose
+// worker stopped renewing their lease or that stayed queued, checking every lease period.
+func startJobQueue(kind string, enqueue func(jobID string) error) {
+	ids, err := repositories.GetQueuedJobIDs(kind)
+	if err != nil {
+		log.Printf("startJobQueue: failed to load queued %v jobs %v", kind, err)
+	}
+	for {
+		for _, id := range ids {
+			if err := enqueue(id); err != nil {
+				log.Printf("startJobQueue: failed to requeue %v job %v %v", kind, id, err)
+			}
+		}
+		time.Sleep(repositories.JobLease)
+
+		ids, err = repositories.RequeueInterruptedJobs(kind)
+		if err != nil {
+			log.Printf("startJobQueue: failed to requeue interrupted %v jobs %v", kind, err)
+		}
+	}
+}
+
+// holdJobLease takes out the lease of a claimed job and renews it until stop is called.
+func holdJobLease(jobID string) (stop func()) {
+	if err := repositories.RenewJobLease(jobID); err != nil {
+		log.Printf("holdJobLease: failed to take out the lease of %v %v", jobID, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobLeaseRenewal)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := repositories.RenewJobLease(jobID); err != nil {
+					log.Printf("holdJobLease: failed to renew the lease of %v %v", jobID, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// ReadLaterInterval is how often read items of the read-later queue are archived.
+const ReadLaterInterval = "@every 1h"
+
+// ReadLater archives the items of the read-later queue that were read longer ago than the
+// queue archive period. A zero period disables it.
+func ReadLater() {
+	if config.Cfg.QueueArchiveAfter == 0 {
+		return
+	}
+	archived, err := repositories.ArchiveReadBookmarks(time.Now().Add(-config.Cfg.QueueArchiveAfter))
+	if err != nil {
+		log.Printf("ReadLater: failed to archive read items %v", err)
+		return
+	}
+	if archived > 0 {
+		log.Printf("ReadLater: archived %v read items", archived)
+	}
+}
@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// TrashInterval is how often old bookmarks are purged from the trash.
+const TrashInterval = "@every 1h"
+
+// Trash permanently deletes the bookmarks that have been in the trash for longer than
+// the trash retention, and their archives.
+func Trash() {
+	purged, err := repositories.PurgeTrash(time.Now().Add(-config.Cfg.TrashRetention))
+	if err != nil {
+		log.Printf("Trash: failed to purge trash %v", err)
+		return
+	}
+	if purged == 0 {
+		return
+	}
+	log.Printf("Trash: purged %v bookmarks", purged)
+	if _, err := RemoveOrphanedArchives(context.Background(), ""); err != nil {
+		log.Printf("Trash: failed to remove archives of purged bookmarks %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"log"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// VisitsInterval is how often the visits counted in Redis are written to the database.
+const VisitsInterval = "@every 5m"
+
+// Visits adds the visits counted by the /go redirect to the visit statistics and frecency
+// of the bookmarks.
+func Visits() {
+	updated, err := repositories.FlushVisits(config.Cfg.FrecencyHalfLife)
+	if err != nil {
+		log.Printf("Visits: failed to flush visits %v", err)
+		return
+	}
+	if updated > 0 {
+		log.Printf("Visits: updated %v bookmarks", updated)
+	}
+}
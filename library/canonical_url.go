@@ -0,0 +1,98 @@
+package library
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// DefaultTrackingParams are the query parameters removed from canonical URLs when no
+// list is configured. A trailing * matches any parameter with that prefix.
+var DefaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid", "twclid",
+	"igshid", "mc_cid", "mc_eid", "_hsenc", "_hsmi", "mkt_tok", "ref_src", "ref_url",
+}
+
+// defaultPorts are the ports implied by the schemes whose URLs are canonicalized.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// CanonicalURL returns the normalized form of a URL used to detect duplicate bookmarks.
+//
+// For http and https URLs the scheme is unified to https, the host is lower cased,
+// converted to punycode and stripped of a leading "www.", the default port of the original
+// scheme is removed, tracking parameters are dropped and the remaining ones sorted,
+// trailing slashes are removed from the path and fragments are dropped unless they look
+// like an app route ("#/..." or "#!..."). Other URLs are only trimmed and have their scheme
+// lower cased.
+func CanonicalURL(raw string, trackingParams []string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return u.String(), nil
+	}
+
+	host, port := u.Hostname(), u.Port()
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+	host = strings.TrimPrefix(host, "www.")
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	canonical := &url.URL{
+		Scheme:  "https",
+		User:    u.User,
+		Host:    host,
+		Path:    strings.TrimRight(u.Path, "/"),
+		RawPath: strings.TrimRight(u.RawPath, "/"),
+	}
+	if canonical.Path == "" {
+		canonical.Path, canonical.RawPath = "/", ""
+	}
+
+	query := u.Query()
+	for key := range query {
+		if isTrackingParam(key, trackingParams) {
+			query.Del(key)
+		}
+	}
+	for _, values := range query {
+		sort.Strings(values)
+	}
+	canonical.RawQuery = query.Encode()
+
+	if strings.HasPrefix(u.Fragment, "/") || strings.HasPrefix(u.Fragment, "!") {
+		canonical.Fragment = u.Fragment
+	}
+
+	return canonical.String(), nil
+}
+
+// isTrackingParam reports whether a query parameter is on the tracking list.
+func isTrackingParam(key string, trackingParams []string) bool {
+	key = strings.ToLower(key)
+	for _, param := range trackingParams {
+		param = strings.ToLower(param)
+		if strings.HasSuffix(param, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(param, "*")) {
+				return true
+			}
+		} else if key == param {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package library
+
+import "testing"
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"unifies scheme", "http://example.com/page", "https://example.com/page"},
+		{"lower cases host", "https://EXAMPLE.com/Page", "https://example.com/Page"},
+		{"strips www", "https://www.example.com/", "https://example.com/"},
+		{"strips default http port", "http://example.com:80/a", "https://example.com/a"},
+		{"strips default https port", "https://example.com:443/a", "https://example.com/a"},
+		{"keeps other ports", "https://example.com:8080/a", "https://example.com:8080/a"},
+		{"keeps https port on http", "http://example.com:443/", "https://example.com:443/"},
+		{"keeps http port on https", "https://example.com:80/", "https://example.com:80/"},
+		{"converts to punycode", "https://bücher.example/", "https://xn--bcher-kva.example/"},
+		{"trims trailing dot of host", "https://example.com./a", "https://example.com/a"},
+		{"trims trailing slashes", "https://example.com/a/b//", "https://example.com/a/b"},
+		{"keeps root path", "https://example.com", "https://example.com/"},
+		{"drops tracking parameters", "https://example.com/a?utm_source=x&utm_medium=y&id=1&fbclid=z", "https://example.com/a?id=1"},
+		{"matches tracking parameters regardless of case", "https://example.com/a?UTM_Source=x&id=1", "https://example.com/a?id=1"},
+		{"sorts parameters", "https://example.com/a?b=2&a=1&a=0", "https://example.com/a?a=0&a=1&b=2"},
+		{"drops fragments", "https://example.com/a#section", "https://example.com/a"},
+		{"keeps app route fragments", "https://example.com/#/inbox", "https://example.com/#/inbox"},
+		{"keeps hashbang fragments", "https://example.com/#!/inbox", "https://example.com/#!/inbox"},
+		{"trims spaces", "  https://example.com/a  ", "https://example.com/a"},
+		{"only lower cases other schemes", "MAILTO:Someone@Example.com", "mailto:Someone@Example.com"},
+		{"leaves URLs without host alone", "file:///home/Notes.txt", "file:///home/Notes.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalURL(tt.raw, DefaultTrackingParams)
+			if err != nil {
+				t.Fatalf("CanonicalURL(%q) returned error %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("CanonicalURL(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalURLDuplicates(t *testing.T) {
+	same := []string{
+		"http://www.example.com/article/?utm_campaign=spring#comments",
+		"https://example.com/article",
+		"https://EXAMPLE.com:443/article/",
+	}
+	want, err := CanonicalURL(same[0], DefaultTrackingParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range same[1:] {
+		got, err := CanonicalURL(raw, DefaultTrackingParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("CanonicalURL(%q) = %q, want the same as %q: %q", raw, got, same[0], want)
+		}
+	}
+}
+
+func TestCanonicalURLTrackingParams(t *testing.T) {
+	got, err := CanonicalURL("https://example.com/?ref=feed&utm_source=x", []string{"ref"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://example.com/?utm_source=x"; got != want {
+		t.Errorf("CanonicalURL with a custom list = %q, want %q", got, want)
+	}
+}
+
+func TestCanonicalURLInvalid(t *testing.T) {
+	if _, err := CanonicalURL("https://exa mple.com/%zz", DefaultTrackingParams); err == nil {
+		t.Error("CanonicalURL of an invalid URL returned no error")
+	}
+}
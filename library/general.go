@@ -1,15 +1,27 @@
 package library
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
 // GeneratePassword generates a bcrypt hash for the given password.
 func GeneratePassword(password string) string {
 	// Hash the password before storing it
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return ""
 	}
 	return string(hashedPassword)
 }
+
+// RandomToken returns an unguessable URL-safe token made of n random bytes.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
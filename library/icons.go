@@ -0,0 +1,202 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	// Decoders for the icon formats that can be resized
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+const (
+	// IconSize is the largest width and height an icon is stored with.
+	IconSize = 64
+	// MaxIconBytes is the largest icon that is stored after normalization.
+	MaxIconBytes = 64 << 10
+	// maxIconSourceBytes is the largest icon that is read before normalization.
+	maxIconSourceBytes = 1 << 20
+	// maxIconPixels is the largest icon that is decoded. A small file can declare a huge
+	// image, which would take a lot of memory to decode.
+	maxIconPixels = 1024 * 1024
+)
+
+// ErrInvalidIcon is returned for icons that are not a supported image.
+var ErrInvalidIcon = errors.New("invalid icon")
+
+// iconTypes are the image types icons are stored as. SVG is not accepted because it can
+// carry scripts.
+var iconTypes = map[string]bool{
+	"image/png":    true,
+	"image/gif":    true,
+	"image/jpeg":   true,
+	"image/x-icon": true,
+	"image/webp":   true,
+}
+
+// DecodeDataURI returns the content of a base64 or URL encoded data URI,
+// such as the ICON attribute of a Netscape bookmark file.
+func DecodeDataURI(uri string) ([]byte, error) {
+	if !strings.HasPrefix(uri, "data:") {
+		return nil, fmt.Errorf("%w: not a data URI", ErrInvalidIcon)
+	}
+	comma := strings.IndexByte(uri, ',')
+	if comma < 0 {
+		return nil, fmt.Errorf("%w: malformed data URI", ErrInvalidIcon)
+	}
+	header, payload := uri[len("data:"):comma], uri[comma+1:]
+
+	if strings.HasSuffix(header, ";base64") {
+		payload = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+				return -1
+			}
+			return r
+		}, payload)
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIcon, err)
+		}
+		return data, nil
+	}
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIcon, err)
+	}
+	return []byte(data), nil
+}
+
+// DataURI encodes content as a base64 data URI.
+func DataURI(contentType string, data []byte) string {
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// NormalizeIcon checks that data is a supported image and returns its content type and the
+// bytes to store. PNG, GIF and JPEG icons larger than IconSize are scaled down and stored as PNG.
+func NormalizeIcon(data []byte) (string, []byte, error) {
+	if len(data) == 0 {
+		return "", nil, fmt.Errorf("%w: empty image", ErrInvalidIcon)
+	}
+	contentType := http.DetectContentType(data)
+	if !iconTypes[contentType] {
+		return "", nil, fmt.Errorf("%w: unsupported type %v", ErrInvalidIcon, contentType)
+	}
+
+	if contentType == "image/png" || contentType == "image/gif" || contentType == "image/jpeg" {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %v", ErrInvalidIcon, err)
+		}
+		if config.Width*config.Height > maxIconPixels {
+			return "", nil, fmt.Errorf("%w: larger than %v pixels", ErrInvalidIcon, maxIconPixels)
+		}
+		if config.Width > IconSize || config.Height > IconSize {
+			img, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				return "", nil, fmt.Errorf("%w: %v", ErrInvalidIcon, err)
+			}
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, scaleDown(img, IconSize)); err != nil {
+				return "", nil, err
+			}
+			contentType, data = "image/png", buf.Bytes()
+		}
+	}
+
+	if len(data) > MaxIconBytes {
+		return "", nil, fmt.Errorf("%w: larger than %v bytes", ErrInvalidIcon, MaxIconBytes)
+	}
+	return contentType, data, nil
+}
+
+// IconHash returns the key an icon is stored under.
+func IconHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// FetchIcon downloads an icon, such as the favicon found by FetchMetadata. Icon URLs come
+// from the pages they are found on, so client should be a NewPublicClient.
+func FetchIcon(ctx context.Context, client *http.Client, iconURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, iconURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "KwikPortal-Metadata/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIconSourceBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxIconSourceBytes {
+		return nil, fmt.Errorf("%w: larger than %v bytes", ErrInvalidIcon, maxIconSourceBytes)
+	}
+	return data, nil
+}
+
+// scaleDown resizes img to fit in a size by size square, averaging the source pixels
+// that fall into every target pixel.
+func scaleDown(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := size, size
+	if b.Dx() > b.Dy() {
+		h = maxInt(1, b.Dy()*size/b.Dx())
+	} else {
+		w = maxInt(1, b.Dx()*size/b.Dy())
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(img.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.Set(x, y, color.NRGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,56 @@
+package library
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func TestNormalizeIcon(t *testing.T) {
+	var small bytes.Buffer
+	if err := png.Encode(&small, image.NewRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	contentType, data, err := NormalizeIcon(small.Bytes())
+	if err != nil || contentType != "image/png" || !bytes.Equal(data, small.Bytes()) {
+		t.Errorf("NormalizeIcon of a small PNG = %v, %v bytes, %v; want it unchanged", contentType, len(data), err)
+	}
+
+	var large bytes.Buffer
+	if err := png.Encode(&large, image.NewRGBA(image.Rect(0, 0, 256, 128))); err != nil {
+		t.Fatal(err)
+	}
+	_, data, err = NormalizeIcon(large.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != IconSize || config.Height != IconSize/2 {
+		t.Errorf("NormalizeIcon scaled 256x128 to %vx%v, want %vx%v", config.Width, config.Height, IconSize, IconSize/2)
+	}
+
+	if _, _, err := NormalizeIcon([]byte("<svg></svg>")); !errors.Is(err, ErrInvalidIcon) {
+		t.Errorf("NormalizeIcon of SVG returned %v, want ErrInvalidIcon", err)
+	}
+}
+
+func TestNormalizeIconRejectsHugeImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 1, 1), []color.Color{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Declare a 65535x65535 image in the logical screen descriptor
+	data := buf.Bytes()
+	copy(data[6:10], []byte{0xff, 0xff, 0xff, 0xff})
+
+	if _, _, err := NormalizeIcon(data); !errors.Is(err, ErrInvalidIcon) {
+		t.Errorf("NormalizeIcon of a 65535x65535 GIF returned %v, want ErrInvalidIcon", err)
+	}
+}
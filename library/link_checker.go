@@ -0,0 +1,185 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// maxRedirects is the number of redirects followed before a link is reported as broken.
+const maxRedirects = 10
+
+// LinkCheck is the outcome of checking one URL.
+type LinkCheck struct {
+	URL string
+	// Status is the HTTP status of the final response, 0 when no response was received.
+	Status int
+	// FinalURL is the URL after following redirects, empty when there were none.
+	FinalURL string
+	// Permanent is set when every redirect on the way to FinalURL was permanent.
+	Permanent bool
+	Err       error
+}
+
+// Broken reports whether the link could not be fetched successfully.
+func (c LinkCheck) Broken() bool {
+	return c.Err != nil || c.Status >= 400 || c.Status == 0
+}
+
+// Redirected reports whether the link leads to a different URL.
+func (c LinkCheck) Redirected() bool {
+	return c.FinalURL != ""
+}
+
+// LinkChecker checks URLs with a bounded number of concurrent requests and a minimum
+// delay between requests to the same host.
+type LinkChecker struct {
+	Client       *http.Client
+	Concurrency  int
+	HostInterval time.Duration
+	UserAgent    string
+
+	mu          sync.Mutex
+	nextRequest map[string]time.Time
+}
+
+// NewLinkChecker returns a checker using the given client.
+func NewLinkChecker(client *http.Client, concurrency int, hostInterval time.Duration) *LinkChecker {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &LinkChecker{
+		Client:       client,
+		Concurrency:  concurrency,
+		HostInterval: hostInterval,
+		UserAgent:    "KwikPortal-LinkChecker/1.0",
+		nextRequest:  map[string]time.Time{},
+	}
+}
+
+// CheckAll checks every URL and calls fn with each result. Results arrive in completion
+// order; fn is never called concurrently.
+func (c *LinkChecker) CheckAll(ctx context.Context, urls []string, fn func(LinkCheck)) {
+	work := make(chan string)
+	results := make(chan LinkCheck)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range work {
+				results <- c.Check(ctx, u)
+			}
+		}()
+	}
+	go func() {
+		defer close(work)
+		for _, u := range urls {
+			select {
+			case work <- u:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		fn(result)
+	}
+}
+
+// Check fetches a URL and follows its redirects.
+//
+// A HEAD request is tried first; servers that do not support it are asked again with GET.
+func (c *LinkChecker) Check(ctx context.Context, rawURL string) LinkCheck {
+	check := LinkCheck{URL: rawURL}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+
+	status, final, permanent, err := c.fetch(ctx, http.MethodHead, u)
+	if err != nil || status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented || status == http.StatusForbidden {
+		status, final, permanent, err = c.fetch(ctx, http.MethodGet, u)
+	}
+	check.Status, check.FinalURL, check.Permanent, check.Err = status, final, permanent, err
+	return check
+}
+
+func (c *LinkChecker) fetch(ctx context.Context, method string, u *url.URL) (status int, final string, permanent bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return 0, "", false, err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	permanent = true
+	client := *c.Client
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.New("too many redirects")
+		}
+		if next.Response != nil && next.Response.StatusCode != http.StatusMovedPermanently &&
+			next.Response.StatusCode != http.StatusPermanentRedirect {
+			permanent = false
+		}
+		return c.wait(ctx, next.URL.Host)
+	}
+
+	if err := c.wait(ctx, u.Host); err != nil {
+		return 0, "", false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", false, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	io.CopyN(io.Discard, resp.Body, 4096)
+
+	final = resp.Request.URL.String()
+	if final == u.String() {
+		return resp.StatusCode, "", false, nil
+	}
+	return resp.StatusCode, final, permanent, nil
+}
+
+// wait blocks until a request to host respects the per host interval.
+func (c *LinkChecker) wait(ctx context.Context, host string) error {
+	if c.HostInterval <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	if c.nextRequest == nil {
+		c.nextRequest = map[string]time.Time{}
+	}
+	now := time.Now()
+	at := c.nextRequest[host]
+	if at.Before(now) {
+		at = now
+	}
+	c.nextRequest[host] = at.Add(c.HostInterval)
+	c.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
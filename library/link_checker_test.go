@@ -0,0 +1,136 @@
+package library
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newLinkServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved-again", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/moved-again", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusPermanentRedirect)
+	})
+	mux.HandleFunc("/temporary", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved", http.StatusFound)
+	})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusMovedPermanently)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLinkCheckerCheck(t *testing.T) {
+	srv := newLinkServer(t)
+	checker := NewLinkChecker(srv.Client(), 2, 0)
+
+	tests := []struct {
+		path      string
+		status    int
+		final     string
+		permanent bool
+		broken    bool
+	}{
+		{path: "/ok", status: http.StatusOK},
+		{path: "/missing", status: http.StatusNotFound, broken: true},
+		{path: "/moved", status: http.StatusOK, final: "/ok", permanent: true},
+		{path: "/temporary", status: http.StatusOK, final: "/ok"},
+		{path: "/get-only", status: http.StatusOK},
+		{path: "/loop", broken: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			check := checker.Check(context.Background(), srv.URL+tt.path)
+			if check.Status != tt.status {
+				t.Errorf("Status = %d, want %d", check.Status, tt.status)
+			}
+			wantFinal := ""
+			if tt.final != "" {
+				wantFinal = srv.URL + tt.final
+			}
+			if check.FinalURL != wantFinal {
+				t.Errorf("FinalURL = %q, want %q", check.FinalURL, wantFinal)
+			}
+			if check.Redirected() != (tt.final != "") {
+				t.Errorf("Redirected() = %v, want %v", check.Redirected(), tt.final != "")
+			}
+			if check.Permanent != tt.permanent {
+				t.Errorf("Permanent = %v, want %v", check.Permanent, tt.permanent)
+			}
+			if check.Broken() != tt.broken {
+				t.Errorf("Broken() = %v, want %v (err %v)", check.Broken(), tt.broken, check.Err)
+			}
+		})
+	}
+}
+
+func TestLinkCheckerUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	check := NewLinkChecker(http.DefaultClient, 1, 0).Check(context.Background(), url)
+	if check.Err == nil || check.Status != 0 || !check.Broken() {
+		t.Errorf("Check of a closed server = %+v, want an error and no status", check)
+	}
+}
+
+func TestLinkCheckerCheckAll(t *testing.T) {
+	srv := newLinkServer(t)
+	checker := NewLinkChecker(srv.Client(), 3, 0)
+
+	urls := []string{srv.URL + "/ok", srv.URL + "/missing", srv.URL + "/moved", srv.URL + "/get-only"}
+	results := map[string]LinkCheck{}
+	checker.CheckAll(context.Background(), urls, func(check LinkCheck) {
+		results[check.URL] = check
+	})
+	if len(results) != len(urls) {
+		t.Fatalf("CheckAll returned %d results, want %d", len(results), len(urls))
+	}
+	if !results[srv.URL+"/missing"].Broken() || results[srv.URL+"/ok"].Broken() {
+		t.Errorf("CheckAll results = %+v", results)
+	}
+}
+
+func TestLinkCheckerHostInterval(t *testing.T) {
+	var mu sync.Mutex
+	var seen []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, time.Now())
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	interval := 50 * time.Millisecond
+	checker := NewLinkChecker(srv.Client(), 3, interval)
+	checker.CheckAll(context.Background(), []string{srv.URL + "/a", srv.URL + "/b", srv.URL + "/c"}, func(LinkCheck) {})
+
+	if len(seen) != 3 {
+		t.Fatalf("server saw %d requests, want 3", len(seen))
+	}
+	if spread := seen[2].Sub(seen[0]); spread < 2*interval-10*time.Millisecond {
+		t.Errorf("three requests to one host took %v, want at least %v", spread, 2*interval)
+	}
+}
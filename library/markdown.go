@@ -0,0 +1,70 @@
+package library
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// markdown renders GitHub flavoured Markdown. Raw HTML in the source is not rendered.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+)
+
+// taskCheckboxes replaces the checkboxes of rendered task lists.
+var taskCheckboxes = strings.NewReplacer(
+	`<input checked="" disabled="" type="checkbox">`, "\u2611",
+	`<input disabled="" type="checkbox">`, "\u2610",
+)
+
+// RenderMarkdown renders Markdown text as sanitized HTML, safe to embed in a page.
+func RenderMarkdown(source string) (string, error) {
+	if strings.TrimSpace(source) == "" {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	// Form inputs are not allowed, so task list checkboxes are kept as characters
+	return SanitizeHTML(taskCheckboxes.Replace(buf.String()))
+}
+
+// SanitizeHTML keeps only the elements and attributes allowed in archived pages, dropping
+// scripts, styles, event handlers and links that are not web or mailto URLs.
+func SanitizeHTML(fragment string) (string, error) {
+	context := &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return "", err
+	}
+
+	root := &xhtml.Node{Type: xhtml.DocumentNode}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	removeUnsafe(root)
+
+	var out strings.Builder
+	sanitize(&out, root, nil)
+	return out.String(), nil
+}
+
+// removeUnsafe drops the elements that are removed with their content, such as scripts.
+func removeUnsafe(n *xhtml.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == xhtml.CommentNode || (c.Type == xhtml.ElementNode && removedElements[c.DataAtom]) {
+			n.RemoveChild(c)
+		} else {
+			removeUnsafe(c)
+		}
+		c = next
+	}
+}
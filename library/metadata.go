@@ -0,0 +1,194 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// maxMetadataBytes is how much of a page is read looking for its metadata.
+const maxMetadataBytes = 1 << 20
+
+// PageMetadata holds what a page says about itself in its <head>.
+// OpenGraph and Twitter card fields take precedence over the plain HTML ones.
+type PageMetadata struct {
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Image        string `json:"image,omitempty"`
+	SiteName     string `json:"site_name,omitempty"`
+	CanonicalURL string `json:"canonical_url,omitempty"`
+	Language     string `json:"language,omitempty"`
+	Favicon      string `json:"favicon,omitempty"`
+}
+
+// FetchMetadata downloads a page and extracts its metadata.
+func FetchMetadata(ctx context.Context, client *http.Client, pageURL string) (*PageMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "KwikPortal-Metadata/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxMetadataBytes), contentType)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMetadata(body, resp.Request.URL)
+}
+
+// ParseMetadata extracts the metadata from the head of an HTML document.
+// Relative URLs are resolved against base.
+func ParseMetadata(r io.Reader, base *url.URL) (*PageMetadata, error) {
+	var title, description, ogTitle, ogDescription, ogImage, twitterTitle, twitterDescription, twitterImage string
+	meta := &PageMetadata{}
+	var favicons []string
+
+	z := html.NewTokenizer(r)
+	inTitle := false
+	var titleText strings.Builder
+parse:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				break parse
+			}
+			return nil, z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			attrs := tagAttributes(z)
+			switch string(name) {
+			case "html":
+				meta.Language = strings.TrimSpace(attrs["lang"])
+			case "title":
+				inTitle = tt == html.StartTagToken
+			case "meta":
+				key := strings.ToLower(attrs["property"])
+				if key == "" {
+					key = strings.ToLower(attrs["name"])
+				}
+				content := strings.TrimSpace(attrs["content"])
+				switch key {
+				case "description":
+					description = content
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					ogDescription = content
+				case "og:image", "og:image:url":
+					if ogImage == "" {
+						ogImage = content
+					}
+				case "og:site_name":
+					meta.SiteName = content
+				case "twitter:title":
+					twitterTitle = content
+				case "twitter:description":
+					twitterDescription = content
+				case "twitter:image", "twitter:image:src":
+					twitterImage = content
+				}
+			case "link":
+				rel := strings.Fields(strings.ToLower(attrs["rel"]))
+				href := strings.TrimSpace(attrs["href"])
+				for _, r := range rel {
+					switch r {
+					case "canonical":
+						meta.CanonicalURL = href
+					case "icon":
+						favicons = append([]string{href}, favicons...)
+					case "apple-touch-icon":
+						favicons = append(favicons, href)
+					}
+				}
+			case "body":
+				break parse
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+				title = strings.TrimSpace(titleText.String())
+			case "head":
+				break parse
+			}
+		case html.TextToken:
+			if inTitle {
+				titleText.Write(z.Text())
+			}
+		}
+	}
+	if title == "" {
+		title = strings.TrimSpace(titleText.String())
+	}
+
+	meta.Title = firstNonEmpty(ogTitle, twitterTitle, title)
+	meta.Description = firstNonEmpty(ogDescription, twitterDescription, description)
+	meta.Image = resolveURL(base, firstNonEmpty(ogImage, twitterImage))
+	meta.CanonicalURL = resolveURL(base, meta.CanonicalURL)
+	if len(favicons) > 0 {
+		meta.Favicon = resolveURL(base, favicons[0])
+	} else if base != nil {
+		meta.Favicon = resolveURL(base, "/favicon.ico")
+	}
+
+	return meta, nil
+}
+
+// tagAttributes collects the attributes of the current tag with lower case keys.
+func tagAttributes(z *html.Tokenizer) map[string]string {
+	attrs := map[string]string{}
+	for {
+		key, val, more := z.TagAttr()
+		if len(key) > 0 {
+			attrs[strings.ToLower(string(key))] = string(val)
+		}
+		if !more {
+			return attrs
+		}
+	}
+}
+
+// resolveURL resolves ref against base, returning ref unchanged when it cannot be resolved.
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" || base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
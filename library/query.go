@@ -0,0 +1,375 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidQuery is wrapped by every QueryError.
+var ErrInvalidQuery = errors.New("invalid search")
+
+// Limits of search queries, which keep the parser's recursion and the SQL they compile to
+// within bounds.
+const (
+	// MaxQueryDepth is how deeply parentheses and negations may be nested.
+	MaxQueryDepth = 32
+	// MaxQueryTerms is the number of words, phrases and fields in a query.
+	MaxQueryTerms = 64
+)
+
+// QueryError describes a search query that cannot be understood. Position is the offset of
+// the offending character in the query, counted in characters from 0.
+type QueryError struct {
+	Position int
+	Message  string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%v: %v at position %d", ErrInvalidQuery, e.Message, e.Position)
+}
+
+// Unwrap makes errors.Is(err, ErrInvalidQuery) hold for query errors.
+func (e *QueryError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+// QueryNode is a node of the syntax tree of a search query.
+type QueryNode interface {
+	// Pos is the position of the node in the query, as in QueryError.
+	Pos() int
+}
+
+// QueryAnd matches what all of its terms match.
+type QueryAnd struct {
+	Position int
+	Terms    []QueryNode
+}
+
+// QueryOr matches what any of its terms match.
+type QueryOr struct {
+	Position int
+	Terms    []QueryNode
+}
+
+// QueryNot matches what its term does not match.
+type QueryNot struct {
+	Position int
+	Term     QueryNode
+}
+
+// QueryText matches a word, or a quoted phrase, in the text of a bookmark.
+type QueryText struct {
+	Position int
+	Text     string
+	Phrase   bool
+}
+
+// QueryField matches a field of a bookmark, written as name:value. The value may be quoted;
+// ValuePosition is where it starts.
+type QueryField struct {
+	Position      int
+	Name          string
+	Value         string
+	ValuePosition int
+}
+
+func (n *QueryAnd) Pos() int   { return n.Position }
+func (n *QueryOr) Pos() int    { return n.Position }
+func (n *QueryNot) Pos() int   { return n.Position }
+func (n *QueryText) Pos() int  { return n.Position }
+func (n *QueryField) Pos() int { return n.Position }
+
+// ParseQuery parses a search query into its syntax tree, or nil for an empty query.
+//
+// Terms separated by spaces must all match, and OR between terms matches either side; AND
+// binds tighter than OR, and parentheses group terms. A term is a word, a "quoted phrase",
+// or a field such as tag:go or folder:"Read later", and a leading - negates it. The meaning
+// of fields is left to the caller. The keywords OR and AND are upper case; AND is implied
+// between terms and may be left out. Queries beyond MaxQueryDepth or MaxQueryTerms are
+// refused.
+func ParseQuery(query string) (QueryNode, error) {
+	tokens, err := lexQuery([]rune(query))
+	if err != nil {
+		return nil, err
+	}
+	p := queryParser{tokens: tokens}
+	if p.peek().kind == queryEOF {
+		return nil, nil
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != queryEOF {
+		return nil, &QueryError{Position: t.pos, Message: "unexpected )"}
+	}
+	return node, nil
+}
+
+// Query token kinds.
+const (
+	queryEOF = iota
+	queryWord
+	queryPhrase
+	queryField
+	queryNot
+	queryOr
+	queryAnd
+	queryOpen
+	queryClose
+)
+
+// queryToken is a token of a search query. Fields carry their name in text and their value
+// in value, starting at valuePos.
+type queryToken struct {
+	kind     int
+	pos      int
+	text     string
+	value    string
+	valuePos int
+}
+
+// lexQuery splits a search query into tokens, ending with queryEOF.
+func lexQuery(query []rune) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for {
+		for i < len(query) && unicode.IsSpace(query[i]) {
+			i++
+		}
+		if i == len(query) {
+			return append(tokens, queryToken{kind: queryEOF, pos: i}), nil
+		}
+
+		start := i
+		switch c := query[i]; {
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: queryOpen, pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: queryClose, pos: i})
+			i++
+		case c == '-':
+			if i+1 == len(query) || unicode.IsSpace(query[i+1]) || query[i+1] == ')' {
+				return nil, &QueryError{Position: i, Message: "- must be followed by the term it excludes"}
+			}
+			tokens = append(tokens, queryToken{kind: queryNot, pos: i})
+			i++
+		case c == '"':
+			phrase, end, err := lexPhrase(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: queryPhrase, pos: start, text: phrase})
+			i = end
+		default:
+			for i < len(query) && !unicode.IsSpace(query[i]) && query[i] != '(' && query[i] != ')' && query[i] != ':' && query[i] != '"' {
+				i++
+			}
+			word := string(query[start:i])
+			// A URL such as https://example.com is a word, not a field
+			isField := i < len(query) && query[i] == ':' && isQueryFieldName(word) &&
+				!(i+2 < len(query) && query[i+1] == '/' && query[i+2] == '/')
+			if isField {
+				i++
+				valuePos := i
+				var value string
+				if i < len(query) && query[i] == '"' {
+					phrase, end, err := lexPhrase(query, i)
+					if err != nil {
+						return nil, err
+					}
+					value, i = phrase, end
+				} else {
+					for i < len(query) && !unicode.IsSpace(query[i]) && query[i] != '(' && query[i] != ')' {
+						i++
+					}
+					value = string(query[valuePos:i])
+				}
+				if value == "" {
+					return nil, &QueryError{Position: valuePos, Message: fmt.Sprintf("%v: needs a value", word)}
+				}
+				tokens = append(tokens, queryToken{kind: queryField, pos: start, text: word, value: value, valuePos: valuePos})
+				continue
+			}
+			// Anything else up to the next space, including colons and quotes, is one word
+			for i < len(query) && !unicode.IsSpace(query[i]) && query[i] != '(' && query[i] != ')' {
+				i++
+			}
+			word = string(query[start:i])
+			switch word {
+			case "OR":
+				tokens = append(tokens, queryToken{kind: queryOr, pos: start, text: word})
+			case "AND":
+				tokens = append(tokens, queryToken{kind: queryAnd, pos: start, text: word})
+			default:
+				tokens = append(tokens, queryToken{kind: queryWord, pos: start, text: word})
+			}
+		}
+	}
+}
+
+// lexPhrase reads the quoted phrase starting at the quote at start, and returns it with the
+// position after its closing quote.
+func lexPhrase(query []rune, start int) (string, int, error) {
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != '"' {
+			continue
+		}
+		phrase := strings.TrimSpace(string(query[start+1 : i]))
+		if phrase == "" {
+			return "", 0, &QueryError{Position: start, Message: "empty quoted phrase"}
+		}
+		return phrase, i + 1, nil
+	}
+	return "", 0, &QueryError{Position: start, Message: "quoted phrase is not closed"}
+}
+
+// isQueryFieldName reports whether s can name a field: letters, then letters, digits or _.
+func isQueryFieldName(s string) bool {
+	for i, c := range s {
+		if !unicode.IsLetter(c) && (i == 0 || (!unicode.IsDigit(c) && c != '_')) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// queryParser builds the syntax tree from the tokens of a query by recursive descent:
+//
+//	or   = and { "OR" and }
+//	and  = not { ["AND"] not }
+//	not  = "-" not | term
+//	term = word | phrase | field | "(" or ")"
+type queryParser struct {
+	tokens []queryToken
+	next   int
+	depth  int
+	terms  int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) take() queryToken {
+	t := p.tokens[p.next]
+	if t.kind != queryEOF {
+		p.next++
+	}
+	return t
+}
+
+// nest goes one level deeper into the query for the token at pos, until done is called.
+func (p *queryParser) nest(pos int) (done func(), err error) {
+	if p.depth == MaxQueryDepth {
+		return nil, &QueryError{Position: pos, Message: fmt.Sprintf("more than %d nested groups and exclusions", MaxQueryDepth)}
+	}
+	p.depth++
+	return func() { p.depth-- }, nil
+}
+
+func (p *queryParser) parseOr() (QueryNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	terms := []QueryNode{first}
+	for p.peek().kind == queryOr {
+		p.take()
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return &QueryOr{Position: first.Pos(), Terms: terms}, nil
+}
+
+func (p *queryParser) parseAnd() (QueryNode, error) {
+	first, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	terms := []QueryNode{first}
+	for {
+		switch p.peek().kind {
+		case queryEOF, queryOr, queryClose:
+			if len(terms) == 1 {
+				return first, nil
+			}
+			return &QueryAnd{Position: first.Pos(), Terms: terms}, nil
+		case queryAnd:
+			p.take()
+		}
+		term, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+}
+
+func (p *queryParser) parseNot() (QueryNode, error) {
+	if t := p.peek(); t.kind == queryNot {
+		p.take()
+		done, err := p.nest(t.pos)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+		term, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &QueryNot{Position: t.pos, Term: term}, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *queryParser) parseTerm() (QueryNode, error) {
+	t := p.take()
+	switch t.kind {
+	case queryWord, queryPhrase, queryField:
+		if p.terms == MaxQueryTerms {
+			return nil, &QueryError{Position: t.pos, Message: fmt.Sprintf("more than %d search terms", MaxQueryTerms)}
+		}
+		p.terms++
+	}
+	switch t.kind {
+	case queryWord:
+		return &QueryText{Position: t.pos, Text: t.text}, nil
+	case queryPhrase:
+		return &QueryText{Position: t.pos, Text: t.text, Phrase: true}, nil
+	case queryField:
+		return &QueryField{Position: t.pos, Name: t.text, Value: t.value, ValuePosition: t.valuePos}, nil
+	case queryOpen:
+		if p.peek().kind == queryClose {
+			return nil, &QueryError{Position: t.pos, Message: "empty parentheses"}
+		}
+		done, err := p.nest(t.pos)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != queryClose {
+			return nil, &QueryError{Position: t.pos, Message: "( is not closed"}
+		}
+		p.take()
+		return node, nil
+	case queryOr, queryAnd:
+		return nil, &QueryError{Position: t.pos, Message: t.text + " must be between two terms"}
+	case queryClose:
+		return nil, &QueryError{Position: t.pos, Message: "unexpected )"}
+	}
+	return nil, &QueryError{Position: t.pos, Message: "expected a search term"}
+}
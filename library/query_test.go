@@ -0,0 +1,134 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// formatQuery writes a syntax tree in prefix notation, for comparing trees in tests.
+func formatQuery(node QueryNode) string {
+	switch n := node.(type) {
+	case nil:
+		return "<nil>"
+	case *QueryAnd:
+		return formatQueryTerms("and", n.Terms)
+	case *QueryOr:
+		return formatQueryTerms("or", n.Terms)
+	case *QueryNot:
+		return "(not " + formatQuery(n.Term) + ")"
+	case *QueryText:
+		if n.Phrase {
+			return fmt.Sprintf("%q", n.Text)
+		}
+		return n.Text
+	case *QueryField:
+		return n.Name + ":" + n.Value
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+func formatQueryTerms(operator string, terms []QueryNode) string {
+	parts := []string{operator}
+	for _, t := range terms {
+		parts = append(parts, formatQuery(t))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "<nil>"},
+		{"   ", "<nil>"},
+		{"go", "go"},
+		{"go generics", "(and go generics)"},
+		{"go AND generics", "(and go generics)"},
+		{"go OR rust", "(or go rust)"},
+		{"a b OR c", "(or (and a b) c)"},
+		{"a (b OR c)", "(and a (or b c))"},
+		{`"error handling" go`, `(and "error handling" go)`},
+		{"-old", "(not old)"},
+		{"--old", "(not (not old))"},
+		{"-(a OR b)", "(not (or a b))"},
+		{"tag:go -tag:old", "(and tag:go (not tag:old))"},
+		{`folder:"Read later"`, "folder:Read later"},
+		{"added:>2023-01-01", "added:>2023-01-01"},
+		{"https://example.com/a:b", "https://example.com/a:b"},
+		{"or and", "(and or and)"},
+		{"tag:go (site:github.com OR site:golang.org) added:last-30d",
+			"(and tag:go (or site:github.com site:golang.org) added:last-30d)"},
+	}
+	for _, tt := range tests {
+		node, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.query, err)
+			continue
+		}
+		if got := formatQuery(node); got != tt.want {
+			t.Errorf("ParseQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryPositions(t *testing.T) {
+	node, err := ParseQuery(`né tag:"a b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	and := node.(*QueryAnd)
+	field := and.Terms[1].(*QueryField)
+	if and.Pos() != 0 || field.Position != 3 || field.ValuePosition != 7 {
+		t.Errorf("positions = %d, %d, %d, want 0, 3, 7", and.Pos(), field.Position, field.ValuePosition)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+		message  string
+	}{
+		{"go -", 3, "- must be followed"},
+		{"- go", 0, "- must be followed"},
+		{`"open`, 0, "not closed"},
+		{`""`, 0, "empty quoted phrase"},
+		{"tag:", 4, "needs a value"},
+		{"(a", 0, "( is not closed"},
+		{"a)", 1, "unexpected )"},
+		{"()", 0, "empty parentheses"},
+		{"OR a", 0, "must be between two terms"},
+		{"a OR", 4, "expected a search term"},
+		{"a AND OR b", 6, "must be between two terms"},
+		{strings.Repeat("(", MaxQueryDepth) + "a" + strings.Repeat(")", MaxQueryDepth), -1, ""},
+		{strings.Repeat("(", MaxQueryDepth+1) + "a" + strings.Repeat(")", MaxQueryDepth+1), MaxQueryDepth, "nested"},
+		{strings.Repeat("-", MaxQueryDepth+1) + "a", MaxQueryDepth, "nested"},
+		{strings.Repeat("(", 1000000), MaxQueryDepth, "nested"},
+		{strings.Repeat("a ", MaxQueryTerms), -1, ""},
+		{strings.Repeat("a ", MaxQueryTerms+1), 2 * MaxQueryTerms, "more than"},
+	}
+	for _, tt := range tests {
+		name := tt.query
+		if len(name) > 40 {
+			name = name[:40] + "..."
+		}
+		_, err := ParseQuery(tt.query)
+		if tt.position < 0 {
+			if err != nil {
+				t.Errorf("ParseQuery(%q) returned error %v", name, err)
+			}
+			continue
+		}
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) || !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("ParseQuery(%q) returned %v, want a *QueryError", name, err)
+			continue
+		}
+		if queryErr.Position != tt.position || !strings.Contains(queryErr.Message, tt.message) {
+			t.Errorf("ParseQuery(%q) = %q at %d, want %q at %d", name, queryErr.Message, queryErr.Position, tt.message, tt.position)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// Readable is the main content of a page, with the navigation, ads and scripts around it removed.
+type Readable struct {
+	Title string
+	// HTML is the sanitized main content, safe to serve as a standalone document.
+	HTML string
+	// Text is the main content as plain text, one paragraph per line.
+	Text string
+}
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|header|legends|menu|modal|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|ad-break|agegate|pagination|pager|popup|share|subscribe|newsletter`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveHints      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	negativeHints      = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	whitespace         = regexp.MustCompile(`\s+`)
+)
+
+// removedElements are dropped from the page together with their content.
+var removedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true, atom.Frame: true,
+	atom.Frameset: true, atom.Object: true, atom.Embed: true, atom.Applet: true, atom.Form: true,
+	atom.Input: true, atom.Button: true, atom.Select: true, atom.Textarea: true, atom.Svg: true,
+	atom.Math: true, atom.Canvas: true, atom.Template: true, atom.Link: true, atom.Meta: true,
+	atom.Base: true, atom.Nav: true, atom.Aside: true, atom.Dialog: true,
+}
+
+// allowedElements are kept in the sanitized snapshot with the listed attributes.
+// Any other element is replaced by its content.
+var allowedElements = map[atom.Atom][]string{
+	atom.A: {"href", "title"}, atom.Abbr: {"title"}, atom.B: nil, atom.Blockquote: {"cite"},
+	atom.Br: nil, atom.Caption: nil, atom.Code: nil, atom.Dd: nil, atom.Del: nil, atom.Div: nil,
+	atom.Dl: nil, atom.Dt: nil, atom.Em: nil, atom.Figcaption: nil, atom.Figure: nil,
+	atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Hr: nil, atom.I: nil, atom.Img: {"src", "alt", "title", "width", "height"}, atom.Ins: nil,
+	atom.Kbd: nil, atom.Li: nil, atom.Mark: nil, atom.Ol: {"start"}, atom.P: nil, atom.Pre: nil,
+	atom.Q: {"cite"}, atom.S: nil, atom.Section: nil, atom.Article: nil, atom.Small: nil,
+	atom.Span: nil, atom.Strong: nil, atom.Sub: nil, atom.Sup: nil, atom.Table: nil,
+	atom.Tbody: nil, atom.Td: {"colspan", "rowspan"}, atom.Tfoot: nil, atom.Th: {"colspan", "rowspan"},
+	atom.Thead: nil, atom.Time: {"datetime"}, atom.Tr: nil, atom.U: nil, atom.Ul: nil,
+}
+
+// urlAttributes hold URLs, which are resolved and limited to web and data image URLs.
+var urlAttributes = map[string]bool{"href": true, "src": true, "cite": true}
+
+// blockElements start a new line in the plain text version.
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Br: true, atom.Dd: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Figcaption: true, atom.Figure: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Hr: true, atom.Li: true, atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true,
+	atom.Table: true, atom.Tr: true, atom.Ul: true,
+}
+
+// FetchReadable downloads a page, reading at most maxBytes, and extracts its main content.
+// Pages are bookmarked by users, so client should be a NewPublicClient.
+func FetchReadable(ctx context.Context, client *http.Client, pageURL string, maxBytes int64) (*Readable, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "KwikPortal-Archive/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxBytes), contentType)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractReadable(body, resp.Request.URL)
+}
+
+// Document wraps the readable content into a standalone HTML page, noting where and when
+// it was archived.
+func (r *Readable) Document(sourceURL string, archivedAt time.Time) string {
+	title := html.EscapeString(r.Title)
+	source := html.EscapeString(safeURL(nil, sourceURL, false))
+
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\">")
+	sb.WriteString(`<meta name="robots" content="noindex, nofollow">`)
+	sb.WriteString("<title>" + title + "</title></head>\n<body><header>")
+	sb.WriteString(`<p>Archived from <a href="` + source + `" rel="noopener noreferrer nofollow">` + source + `</a> on `)
+	sb.WriteString(archivedAt.UTC().Format("2 January 2006 15:04 MST") + "</p>")
+	if title != "" {
+		sb.WriteString("<h1>" + title + "</h1>")
+	}
+	sb.WriteString("</header>\n<main>" + r.HTML + "</main>\n</body></html>\n")
+	return sb.String()
+}
+
+// wordsPerMinute is the reading speed assumed by ReadingMinutes.
+const wordsPerMinute = 230
+
+// ReadingMinutes estimates the time it takes to read the content, in whole minutes.
+// Content without text takes no time; any other content takes at least a minute.
+func (r *Readable) ReadingMinutes() int {
+	words := len(strings.Fields(r.Text))
+	return int(math.Ceil(float64(words) / wordsPerMinute))
+}
+
+// ExtractReadable finds the main content of an HTML page, the way reader modes do: paragraphs
+// are scored by their length and punctuation, their scores are added to the elements
+// containing them, and the best scoring element is kept. Relative URLs are resolved against base.
+func ExtractReadable(r io.Reader, base *url.URL) (*Readable, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	readable := &Readable{Title: documentTitle(doc)}
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+	removeUnlikely(body)
+
+	content := bestCandidate(body)
+	if content == nil {
+		content = body
+	}
+
+	var out strings.Builder
+	sanitize(&out, content, base)
+	readable.HTML = out.String()
+
+	var text strings.Builder
+	plainText(&text, content)
+	readable.Text = cleanText(text.String())
+
+	return readable, nil
+}
+
+// documentTitle returns the text of the <title> element.
+func documentTitle(doc *html.Node) string {
+	title := findElement(doc, atom.Title)
+	if title == nil {
+		return ""
+	}
+	return strings.TrimSpace(whitespace.ReplaceAllString(textContent(title), " "))
+}
+
+// findElement returns the first element of the given type below n.
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// removeUnlikely drops scripts, forms and navigation, and elements whose class or id marks
+// them as page furniture rather than content.
+func removeUnlikely(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode {
+			n.RemoveChild(c)
+		} else if c.Type == html.ElementNode {
+			hints := attr(c, "class") + " " + attr(c, "id")
+			unlikely := unlikelyCandidates.MatchString(hints) && !maybeCandidate.MatchString(hints) &&
+				c.DataAtom != atom.Body && c.DataAtom != atom.Article && c.DataAtom != atom.Main
+			if removedElements[c.DataAtom] || unlikely || attr(c, "hidden") != "" || attr(c, "aria-hidden") == "true" {
+				n.RemoveChild(c)
+			} else {
+				removeUnlikely(c)
+			}
+		}
+		c = next
+	}
+}
+
+// bestCandidate scores the elements containing paragraphs and returns the best one.
+func bestCandidate(body *html.Node) *html.Node {
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = elementWeight(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.P, atom.Pre, atom.Td, atom.Blockquote:
+				text := textContent(n)
+				if len(text) >= 25 {
+					score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+					addScore(n.Parent, score)
+					if n.Parent != nil {
+						addScore(n.Parent.Parent, score/2)
+					}
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range candidates {
+		score := scores[n] * (1 - linkDensity(n))
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+// elementWeight is the starting score of an element, from its tag and its class and id.
+func elementWeight(n *html.Node) float64 {
+	weight := 0.0
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		weight += 10
+	case atom.Div:
+		weight += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		weight += 3
+	case atom.Ol, atom.Ul, atom.Dl, atom.Form:
+		weight -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		weight -= 5
+	}
+	for _, hints := range []string{attr(n, "class"), attr(n, "id")} {
+		if hints == "" {
+			continue
+		}
+		if negativeHints.MatchString(hints) {
+			weight -= 25
+		}
+		if positiveHints.MatchString(hints) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity is the share of the text of n that is inside links.
+func linkDensity(n *html.Node) float64 {
+	total := len(textContent(n))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			links += len(textContent(c))
+			return
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return float64(links) / float64(total)
+}
+
+// sanitize writes n as HTML, keeping only allowed elements and attributes.
+func sanitize(w *strings.Builder, n *html.Node, base *url.URL) {
+	switch n.Type {
+	case html.TextNode:
+		w.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+		attrs, ok := allowedElements[n.DataAtom]
+		if !ok {
+			break
+		}
+		w.WriteString("<" + n.Data)
+		for _, name := range attrs {
+			val := attr(n, name)
+			if urlAttributes[name] {
+				val = safeURL(base, val, n.DataAtom == atom.Img)
+			}
+			if val != "" {
+				w.WriteString(" " + name + `="` + html.EscapeString(val) + `"`)
+			}
+		}
+		if n.DataAtom == atom.A {
+			w.WriteString(` rel="noopener noreferrer nofollow"`)
+		}
+		w.WriteString(">")
+		if n.DataAtom == atom.Br || n.DataAtom == atom.Hr || n.DataAtom == atom.Img {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			sanitize(w, c, base)
+		}
+		w.WriteString("</" + n.Data + ">")
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sanitize(w, c, base)
+	}
+}
+
+// safeURL resolves a URL and drops it unless it is a web URL, a mailto link, or a data URI
+// for images.
+func safeURL(base *url.URL, raw string, image bool) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	if image && strings.HasPrefix(raw, "data:image/") && !strings.HasPrefix(raw, "data:image/svg") {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && (image || u.Scheme != "mailto") {
+		return ""
+	}
+	return u.String()
+}
+
+// plainText writes the text of n, starting a new line for every block element.
+func plainText(w *strings.Builder, n *html.Node) {
+	if n.Type == html.TextNode {
+		w.WriteString(n.Data)
+		return
+	}
+	block := n.Type == html.ElementNode && blockElements[n.DataAtom]
+	if block {
+		w.WriteString("\n")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		plainText(w, c)
+	}
+	if block {
+		w.WriteString("\n")
+	}
+}
+
+// cleanText collapses the whitespace of every line and drops empty lines.
+func cleanText(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(whitespace.ReplaceAllString(line, " "))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// textContent returns the text below n.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
+
+// attr returns the value of an attribute of n.
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
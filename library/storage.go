@@ -0,0 +1,152 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrObjectNotFound is returned when a storage key holds no object.
+var ErrObjectNotFound = errors.New("object not found")
+
+// Storage stores blobs, such as page archives, under slash separated keys.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalStorage keeps objects as files below a directory.
+type LocalStorage struct {
+	Dir string
+}
+
+// NewLocalStorage creates a LocalStorage storing files below dir.
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{Dir: dir}
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if clean == "." || filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Written to a temporary file first so readers never see a partial object
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return data, err
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// HTTPStorage keeps objects in an S3 compatible bucket reached over plain HTTP: objects are
+// written with PUT, read with GET and removed with DELETE at BaseURL/key. Requests carry
+// Token as a bearer token when it is set, so the bucket is expected to sit behind a gateway
+// or policy that accepts it rather than S3 request signing.
+type HTTPStorage struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewHTTPStorage creates an HTTPStorage for the bucket at baseURL.
+func NewHTTPStorage(client *http.Client, baseURL, token string) *HTTPStorage {
+	return &HTTPStorage{BaseURL: strings.TrimRight(baseURL, "/"), Token: token, Client: client}
+}
+
+func (s *HTTPStorage) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.BaseURL+"/"+strings.TrimLeft(key, "/"), reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	return s.Client.Do(req)
+}
+
+func (s *HTTPStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("storing %v failed with status %v", key, resp.Status)
+	}
+	return nil
+}
+
+func (s *HTTPStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("reading %v failed with status %v", key, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *HTTPStorage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("deleting %v failed with status %v", key, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// Archive statuses.
+const (
+	ArchivePending   = "pending"
+	ArchiveCompleted = "completed"
+	ArchiveFailed    = "failed"
+)
+
+// Archive is an offline snapshot of a bookmarked page. The sanitized HTML snapshot and the
+// plain text are kept in the archive storage under HTMLKey and TextKey; Size counts both.
+type Archive struct {
+	ID         string `gorm:"column:id"`
+	UserID     string `gorm:"column:user_id"`
+	BookmarkID string `gorm:"column:bookmark_id"`
+	URL        string `gorm:"column:url"`
+	Status     string `gorm:"column:status"`
+	Title      string `gorm:"column:title"`
+	Error      string `gorm:"column:error"`
+	HTMLKey    string `gorm:"column:html_key"`
+	TextKey    string `gorm:"column:text_key"`
+	Size       int64  `gorm:"column:size"`
+	ArchivedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new archive record.
+// It generates a UUID for the ID field.
+func (a *Archive) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	a.ID = id.String()
+	return nil
+}
+
+// TableName specifies the table name for the archive model.
+func (Archive) TableName() string {
+	return "archives"
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -10,26 +11,76 @@ import (
 
 // Bookmark represents a bookmark entry in the database.
 type Bookmark struct {
-	ID        string `gorm:"column:id"`
-	UserID    string `gorm:"column:user_id"`
-	Folder    string `gorm:"column:folder"`
-	URL       string `gorm:"column:url"`
-	AddDate   int64  `gorm:"column:add_date"`
-	Icon      string `gorm:"column:icon"`
-	Name      string `gorm:"column:name"`
+	ID           string `gorm:"column:id"`
+	UserID       string `gorm:"column:user_id"`
+	Folder       string `gorm:"column:folder"`
+	URL          string `gorm:"column:url"`
+	CanonicalURL string `gorm:"column:canonical_url"`
+	// Duplicate marks a copy an import kept next to a saved bookmark with the same canonical
+	// URL. Apart from those, a user has one bookmark per canonical URL outside the trash.
+	Duplicate    bool   `gorm:"column:duplicate"`
+	AddDate      int64  `gorm:"column:add_date"`
+	LastModified int64  `gorm:"column:last_modified"`
+	Icon         string `gorm:"column:icon"`
+	IconHash     string `gorm:"column:icon_hash"`
+	Name         string `gorm:"column:name"`
+	Tags         string `gorm:"column:tags"`
+	Keyword      string `gorm:"column:keyword"`
+	Description  string `gorm:"column:description"`
+	Image        string `gorm:"column:image"`
+	Lang         string `gorm:"column:lang"`
+	// Notes are written by the user in Markdown. NotesHTML is the rendered, sanitized
+	// notes, only filled in for API responses.
+	Notes     string `gorm:"column:notes"`
+	NotesHTML string `gorm:"-" json:",omitempty"`
+	// Page metadata, filled in by the metadata cron job. Metadata keeps the last fetched
+	// values as JSON so fields edited by the user are not overwritten on refresh.
+	Metadata          string     `gorm:"column:metadata"`
+	MetadataFetchedAt *time.Time `gorm:"column:metadata_fetched_at"`
+	// Link health, recorded by the link check cron job
+	HTTPStatus        int        `gorm:"column:http_status"`
+	FinalURL          string     `gorm:"column:final_url"`
+	PermanentRedirect bool       `gorm:"column:permanent_redirect"`
+	LastCheckedAt     *time.Time `gorm:"column:last_checked_at"`
+	CheckFailures     int        `gorm:"column:check_failures"`
+	// Read-later queue. ReadState is empty for bookmarks that are not in the queue.
+	// QueuePosition orders unread items; ReadingMinutes is estimated from the archived page.
+	ReadState      string     `gorm:"column:read_state"`
+	QueuePosition  int64      `gorm:"column:queue_position"`
+	ReadAt         *time.Time `gorm:"column:read_at"`
+	ReadingMinutes int        `gorm:"column:reading_minutes"`
+	// Visit statistics, read from the bookmark_visits table (see BookmarkVisit) when a query
+	// includes them
+	VisitCount    int64      `gorm:"column:visit_count;->"`
+	LastVisitedAt *time.Time `gorm:"column:last_visited_at;->"`
+	Frecency      float64    `gorm:"column:frecency;->"`
+	// Version starts at 1 and is incremented by the database on every write to the fields
+	// users edit, see seed/init.sql
+	Version   int64 `gorm:"column:version"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// Read states of bookmarks in the read-later queue.
+const (
+	ReadStateUnread   = "unread"
+	ReadStateRead     = "read"
+	ReadStateArchived = "archived"
+)
+
+// ReadStates lists the read states.
+var ReadStates = []string{ReadStateUnread, ReadStateRead, ReadStateArchived}
+
 // BeforeCreate is a GORM callback that is triggered before creating a new bookmark record.
-// It generates a UUID for the ID field.
+// It generates a UUID for the ID field and sets the first version.
 func (b *Bookmark) BeforeCreate(tx *gorm.DB) (err error) {
 	id, err := uuid.NewV4()
 	if err != nil {
 		log.Println(err)
 	}
 	b.ID = id.String()
+	b.Version = 1
 	return nil
 }
 
@@ -37,3 +88,28 @@ func (b *Bookmark) BeforeCreate(tx *gorm.DB) (err error) {
 func (Bookmark) TableName() string {
 	return "bookmarks"
 }
+
+// TagList returns the bookmark tags as a slice.
+func (b Bookmark) TagList() []string {
+	return SplitTags(b.Tags)
+}
+
+// SplitTags splits a comma separated tag list, dropping blanks and duplicates.
+func SplitTags(tags string) []string {
+	var list []string
+	seen := map[string]bool{}
+	for _, t := range strings.Split(tags, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		list = append(list, t)
+	}
+	return list
+}
+
+// JoinTags normalizes a list of tags into the comma separated form stored in the database.
+func JoinTags(tags []string) string {
+	return strings.Join(SplitTags(strings.Join(tags, ",")), ",")
+}
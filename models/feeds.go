@@ -0,0 +1,51 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// Feed kinds, naming what Target selects. A collection feed has no target.
+const (
+	FeedCollection = "collection"
+	FeedFolder     = "folder"
+	FeedTag        = "tag"
+	FeedSearch     = "search"
+)
+
+// FeedKinds lists the feed kinds.
+var FeedKinds = []string{FeedCollection, FeedFolder, FeedTag, FeedSearch}
+
+// Feed publishes the newest bookmarks of a user, in a folder, with a tag or matching a saved
+// search, to feed readers.
+// Public feeds can be read by anyone who knows their ID; private ones also need Token.
+type Feed struct {
+	ID        string `gorm:"column:id"`
+	UserID    string `gorm:"column:user_id"`
+	Token     string `gorm:"column:token"`
+	Kind      string `gorm:"column:kind"`
+	Target    string `gorm:"column:target"`
+	Title     string `gorm:"column:title"`
+	Public    bool   `gorm:"column:public"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new feed record.
+// It generates a UUID for the ID field.
+func (f *Feed) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	f.ID = id.String()
+	return nil
+}
+
+// TableName specifies the table name for the feed model.
+func (Feed) TableName() string {
+	return "feeds"
+}
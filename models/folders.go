@@ -0,0 +1,103 @@
+package models
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// FolderSeparator separates the components of a folder path.
+const FolderSeparator = "/"
+
+// Folder represents a bookmark folder and the attributes imported with it.
+// Bookmarks reference folders by their path. Role is set on folders listed for a user, to
+// the role the user has in them.
+type Folder struct {
+	ID           string `gorm:"column:id"`
+	UserID       string `gorm:"column:user_id"`
+	Path         string `gorm:"column:path"`
+	AddDate      int64  `gorm:"column:add_date"`
+	LastModified int64  `gorm:"column:last_modified"`
+	Toolbar      bool   `gorm:"column:toolbar"`
+	Role         string `gorm:"-" json:",omitempty"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new folder record.
+// It generates a UUID for the ID field.
+func (f *Folder) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	f.ID = id.String()
+	return nil
+}
+
+// TableName specifies the table name for the folder model.
+func (Folder) TableName() string {
+	return "folders"
+}
+
+// Name returns the last component of the folder path.
+func (f Folder) Name() string {
+	parts := SplitFolderPath(f.Path)
+	if len(parts) == 0 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+// JoinFolderPath builds a folder path from its components.
+// Separators and backslashes inside a component are escaped so the path can be split again.
+func JoinFolderPath(parts ...string) string {
+	escaped := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.ReplaceAll(p, `\`, `\\`)
+		p = strings.ReplaceAll(p, FolderSeparator, `\`+FolderSeparator)
+		escaped = append(escaped, p)
+	}
+	return strings.Join(escaped, FolderSeparator)
+}
+
+// SplitFolderPath splits a folder path built by JoinFolderPath into its components.
+func SplitFolderPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			i++
+			current.WriteByte(path[i])
+		case strings.HasPrefix(path[i:], FolderSeparator):
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(path[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+// CompareFolderPaths orders folder paths so that a folder always sorts directly before its
+// subfolders. It matches ordering by REPLACE(folder, '/', char(1)) in SQL.
+func CompareFolderPaths(a, b string) int {
+	return strings.Compare(folderSortKey(a), folderSortKey(b))
+}
+
+// FolderSortExpression is the SQL ordering equivalent to CompareFolderPaths for the given column.
+func FolderSortExpression(column string) string {
+	return "REPLACE(" + column + ", '" + FolderSeparator + "', char(1))"
+}
+
+func folderSortKey(path string) string {
+	return strings.ReplaceAll(path, FolderSeparator, "\x01")
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// Icon is a bookmark icon, stored once no matter how many bookmarks use it.
+// Icons are keyed by the SHA-256 hash of their content.
+type Icon struct {
+	Hash        string `gorm:"column:hash;primaryKey"`
+	ContentType string `gorm:"column:content_type"`
+	Data        []byte `gorm:"column:data"`
+	Size        int    `gorm:"column:size"`
+	CreatedAt   time.Time
+}
+
+// TableName specifies the table name for the icon model.
+func (Icon) TableName() string {
+	return "icons"
+}
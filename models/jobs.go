@@ -0,0 +1,57 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// Job kinds.
+const (
+	JobKindImport = "import"
+	JobKindBulk   = "bulk"
+)
+
+// Job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job represents a background job started by a user, such as an import.
+// Params and Result hold the job specific input and outcome as JSON.
+type Job struct {
+	ID         string `gorm:"column:id"`
+	UserID     string `gorm:"column:user_id"`
+	Kind       string `gorm:"column:kind"`
+	Status     string `gorm:"column:status"`
+	Params     string `gorm:"column:params"`
+	Result     string `gorm:"column:result"`
+	Error      string `gorm:"column:error"`
+	Processed  int    `gorm:"column:processed"`
+	Total      int    `gorm:"column:total"`
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new job record.
+// It generates a UUID for the ID field.
+func (j *Job) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	j.ID = id.String()
+	return nil
+}
+
+// TableName specifies the table name for the job model.
+func (Job) TableName() string {
+	return "jobs"
+}
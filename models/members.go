@@ -0,0 +1,107 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// Folder member roles, from least to most privileged. Viewers see the bookmarks of a shared
+// folder, editors also add, change and delete them, and owners also manage the members.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// Roles lists the folder member roles from least to most privileged.
+var Roles = []string{RoleViewer, RoleEditor, RoleOwner}
+
+// RolesAtLeast returns the roles that grant at least the given role.
+func RolesAtLeast(role string) []string {
+	for i, r := range Roles {
+		if r == role {
+			return Roles[i:]
+		}
+	}
+	return nil
+}
+
+// HasRole reports whether role grants at least the required role.
+func HasRole(role string, required string) bool {
+	for _, r := range RolesAtLeast(required) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Invitation statuses.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
+// FolderMember gives a user access to a folder of another user and its subfolders.
+// Email is the member's address, loaded with the member list.
+type FolderMember struct {
+	ID        string `gorm:"column:id"`
+	FolderID  string `gorm:"column:folder_id"`
+	UserID    string `gorm:"column:user_id"`
+	Role      string `gorm:"column:role"`
+	InvitedBy string `gorm:"column:invited_by"`
+	Email     string `gorm:"column:email;->"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new folder member record.
+// It generates a UUID for the ID field.
+func (m *FolderMember) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	m.ID = id.String()
+	return nil
+}
+
+// TableName specifies the table name for the folder member model.
+func (FolderMember) TableName() string {
+	return "folder_members"
+}
+
+// FolderInvitation invites the user with an email address to become a member of a folder.
+// FolderPath is the path of the folder in its owner's tree, loaded with the invitation.
+type FolderInvitation struct {
+	ID          string `gorm:"column:id"`
+	FolderID    string `gorm:"column:folder_id"`
+	Email       string `gorm:"column:email"`
+	Role        string `gorm:"column:role"`
+	Status      string `gorm:"column:status"`
+	InvitedBy   string `gorm:"column:invited_by"`
+	FolderPath  string `gorm:"column:folder_path;->"`
+	RespondedAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new invitation record.
+// It generates a UUID for the ID field.
+func (i *FolderInvitation) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	i.ID = id.String()
+	return nil
+}
+
+// TableName specifies the table name for the folder invitation model.
+func (FolderInvitation) TableName() string {
+	return "folder_invitations"
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// Operation kinds.
+const (
+	OperationCreate    = "create"
+	OperationSave      = "save"
+	OperationDelete    = "delete"
+	OperationImport    = "import"
+	OperationBulk      = "bulk"
+	OperationMerge     = "merge"
+	OperationRedirects = "redirects"
+	OperationTrash     = "trash"
+	OperationSync      = "sync"
+	OperationUndo      = "undo"
+	OperationRules     = "rules"
+	OperationMetadata  = "metadata"
+)
+
+// Revision actions.
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionMove    = "move"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionPurge   = "purge"
+)
+
+// Operation groups the revisions made by one action of a user, such as an import or a bulk
+// action, so that they can be undone together.
+type Operation struct {
+	ID        string `gorm:"column:id"`
+	UserID    string `gorm:"column:user_id"`
+	Kind      string `gorm:"column:kind"`
+	UndoneAt  *time.Time
+	CreatedAt time.Time
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new operation record.
+// It generates a UUID for the ID field.
+func (o *Operation) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	o.ID = id.String()
+	return nil
+}
+
+// TableName specifies the table name for the operation model.
+func (Operation) TableName() string {
+	return "operations"
+}
+
+// Revision records one change to a bookmark. Before and After are the state of the bookmark
+// around the change: Before is empty for a created bookmark and After for a purged one.
+// Revision IDs increase with every change.
+type Revision struct {
+	ID          int64          `gorm:"column:id;primaryKey;autoIncrement"`
+	OperationID string         `gorm:"column:operation_id"`
+	UserID      string         `gorm:"column:user_id"`
+	BookmarkID  string         `gorm:"column:bookmark_id"`
+	Action      string         `gorm:"column:action"`
+	Before      *BookmarkState `gorm:"column:before_state;serializer:json"`
+	After       *BookmarkState `gorm:"column:after_state;serializer:json"`
+	CreatedAt   time.Time
+}
+
+// TableName specifies the table name for the revision model.
+func (Revision) TableName() string {
+	return "revisions"
+}
+
+// BookmarkState is the part of a bookmark edited by users, as recorded in a revision.
+// Page metadata and link health are filled in by cron jobs and are not recorded.
+type BookmarkState struct {
+	Folder       string
+	URL          string
+	CanonicalURL string
+	Duplicate    bool
+	AddDate      int64
+	LastModified int64
+	Icon         string
+	IconHash     string
+	Name         string
+	Tags         string
+	Keyword      string
+	Description  string
+	Notes        string
+	DeletedAt    *time.Time
+}
+
+// State returns the recorded state of the bookmark.
+func (b Bookmark) State() BookmarkState {
+	state := BookmarkState{
+		Folder:       b.Folder,
+		URL:          b.URL,
+		CanonicalURL: b.CanonicalURL,
+		Duplicate:    b.Duplicate,
+		AddDate:      b.AddDate,
+		LastModified: b.LastModified,
+		Icon:         b.Icon,
+		IconHash:     b.IconHash,
+		Name:         b.Name,
+		Tags:         b.Tags,
+		Keyword:      b.Keyword,
+		Description:  b.Description,
+		Notes:        b.Notes,
+	}
+	if b.DeletedAt.Valid {
+		deletedAt := b.DeletedAt.Time
+		state.DeletedAt = &deletedAt
+	}
+	return state
+}
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// Rule files and tags the bookmarks of a user that match it. A bookmark matches when its
+// URL is on Domain or one of its subdomains, its URL matches URLPattern, where * stands for
+// any text, and its name contains TitleContains, ignoring case; conditions left empty match
+// any bookmark. A matching bookmark is moved to Folder, given the comma separated AddTags
+// and renamed after NameTemplate, in which {title}, {domain}, {url} and {folder} stand for
+// the bookmark's; names already in the shape of the template are kept, so running a rule
+// again does not rename bookmarks twice. Empty actions change nothing.
+//
+// Rules apply in the order of Position, each to the bookmark as left by the rules before it.
+type Rule struct {
+	ID            string `gorm:"column:id"`
+	UserID        string `gorm:"column:user_id"`
+	Name          string `gorm:"column:name"`
+	Position      int    `gorm:"column:position"`
+	Enabled       bool   `gorm:"column:enabled"`
+	Domain        string `gorm:"column:domain"`
+	URLPattern    string `gorm:"column:url_pattern"`
+	TitleContains string `gorm:"column:title_contains"`
+	Folder        string `gorm:"column:folder"`
+	AddTags       string `gorm:"column:add_tags"`
+	NameTemplate  string `gorm:"column:name_template"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	// Set by Prepare
+	urlPattern   *regexp.Regexp
+	nameTemplate []templatePart
+}
+
+// templatePart is a piece of a name template, either literal text or a placeholder.
+type templatePart struct {
+	text        string
+	placeholder string
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new rule record.
+// It generates a UUID for the ID field.
+func (r *Rule) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	r.ID = id.String()
+	return nil
+}
+
+// TableName specifies the table name for the rule model.
+func (Rule) TableName() string {
+	return "rules"
+}
+
+// Validate checks that the rule has a condition and an action.
+func (r Rule) Validate() error {
+	if r.Domain == "" && r.URLPattern == "" && r.TitleContains == "" {
+		return errors.New("a rule needs a domain, url_pattern or title_contains to match")
+	}
+	if r.Folder == "" && JoinTags([]string{r.AddTags}) == "" && r.NameTemplate == "" {
+		return errors.New("a rule needs a folder, add_tags or name_template to apply")
+	}
+	return nil
+}
+
+// Prepare compiles the URL pattern and parses the name template of the rule, so that
+// matching many bookmarks does not do it again for each. Rules that are not prepared
+// still match, at that cost.
+func (r *Rule) Prepare() {
+	r.urlPattern = nil
+	if r.URLPattern != "" {
+		r.urlPattern = urlPatternRegexp(r.URLPattern)
+	}
+	r.nameTemplate = parseNameTemplate(r.NameTemplate)
+}
+
+// Matches reports whether the bookmark meets the conditions of the rule.
+func (r Rule) Matches(b Bookmark) bool {
+	if r.Domain != "" {
+		host := bookmarkHost(b.URL)
+		domain := strings.ToLower(strings.TrimSpace(r.Domain))
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+	}
+	if r.URLPattern != "" {
+		pattern := r.urlPattern
+		if pattern == nil {
+			pattern = urlPatternRegexp(r.URLPattern)
+		}
+		if !pattern.MatchString(b.URL) {
+			return false
+		}
+	}
+	if r.TitleContains != "" && !strings.Contains(strings.ToLower(b.Name), strings.ToLower(r.TitleContains)) {
+		return false
+	}
+	return true
+}
+
+// Apply changes the bookmark as the rule says, whether or not it matches, and reports
+// whether anything changed.
+func (r Rule) Apply(b *Bookmark) bool {
+	before := *b
+	template := r.nameTemplate
+	if template == nil {
+		template = parseNameTemplate(r.NameTemplate)
+	}
+	if r.NameTemplate != "" && !renamed(template, b.Name, *b) {
+		name := strings.NewReplacer(
+			"{title}", b.Name,
+			"{domain}", bookmarkHost(b.URL),
+			"{url}", b.URL,
+			"{folder}", b.Folder,
+		).Replace(r.NameTemplate)
+		if name = strings.TrimSpace(name); name != "" {
+			b.Name = name
+		}
+	}
+	if r.Folder != "" {
+		b.Folder = r.Folder
+	}
+	if r.AddTags != "" {
+		b.Tags = JoinTags(append(b.TagList(), SplitTags(r.AddTags)...))
+	}
+	return b.Name != before.Name || b.Folder != before.Folder || b.Tags != before.Tags
+}
+
+// ApplyRules applies the rules a bookmark matches, in order, and returns the IDs of those
+// that changed it.
+func ApplyRules(rules []Rule, b *Bookmark) []string {
+	var applied []string
+	for _, r := range rules {
+		if r.Matches(*b) && r.Apply(b) {
+			applied = append(applied, r.ID)
+		}
+	}
+	return applied
+}
+
+// bookmarkHost returns the lower-cased host of a bookmark URL, or "" when it has none.
+func bookmarkHost(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// urlPatternRegexp compiles a URL pattern, in which * stands for any text, into a regular
+// expression matching whole URLs regardless of case.
+func urlPatternRegexp(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("(?i)^" + strings.Join(parts, ".*") + "$")
+}
+
+// namePlaceholders are the placeholders of name templates.
+var namePlaceholders = regexp.MustCompile(`\{(title|domain|url|folder)\}`)
+
+// parseNameTemplate splits a name template into literal text and placeholders.
+func parseNameTemplate(template string) []templatePart {
+	template = strings.TrimSpace(template)
+	parts := []templatePart{}
+	last := 0
+	for _, loc := range namePlaceholders.FindAllStringSubmatchIndex(template, -1) {
+		parts = append(parts,
+			templatePart{text: template[last:loc[0]]},
+			templatePart{placeholder: template[loc[2]:loc[3]]},
+		)
+		last = loc[1]
+	}
+	return append(parts, templatePart{text: template[last:]})
+}
+
+// renamed reports whether a name is already in the shape of a parsed name template for a
+// bookmark: {domain} and {url} stand for the bookmark's, {title} and {folder} for any text.
+func renamed(template []templatePart, name string, b Bookmark) bool {
+	// The literal text between the placeholders standing for any text
+	literals := []string{""}
+	for _, part := range template {
+		switch part.placeholder {
+		case "":
+			literals[len(literals)-1] += part.text
+		case "domain":
+			literals[len(literals)-1] += bookmarkHost(b.URL)
+		case "url":
+			literals[len(literals)-1] += b.URL
+		default:
+			literals = append(literals, "")
+		}
+	}
+
+	first, last := literals[0], literals[len(literals)-1]
+	if len(literals) == 1 {
+		return name == first
+	}
+	if len(name) < len(first)+len(last) || !strings.HasPrefix(name, first) || !strings.HasSuffix(name, last) {
+		return false
+	}
+	// Taking the earliest place for each literal in between leaves the most room for the rest
+	rest := name[len(first) : len(name)-len(last)]
+	for _, literal := range literals[1 : len(literals)-1] {
+		i := strings.Index(rest, literal)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(literal):]
+	}
+	return true
+}
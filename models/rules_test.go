@@ -0,0 +1,107 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		b    Bookmark
+		want bool
+	}{
+		{"domain", Rule{Domain: "github.com"}, Bookmark{URL: "https://github.com/golang/go"}, true},
+		{"subdomain", Rule{Domain: "github.com"}, Bookmark{URL: "https://gist.github.com/x"}, true},
+		{"domain case", Rule{Domain: " GitHub.com "}, Bookmark{URL: "https://GITHUB.com/"}, true},
+		{"other domain", Rule{Domain: "github.com"}, Bookmark{URL: "https://notgithub.com/"}, false},
+		{"url pattern", Rule{URLPattern: "https://*.example.com/docs/*"}, Bookmark{URL: "https://www.example.com/docs/intro"}, true},
+		{"url pattern is anchored", Rule{URLPattern: "https://example.com/docs"}, Bookmark{URL: "https://example.com/docs/intro"}, false},
+		{"url pattern quotes", Rule{URLPattern: "https://example.com/a?b=*"}, Bookmark{URL: "https://example.com/ab=1"}, false},
+		{"title", Rule{TitleContains: "golang"}, Bookmark{Name: "The GoLang Blog"}, true},
+		{"all conditions", Rule{Domain: "go.dev", TitleContains: "blog"}, Bookmark{URL: "https://go.dev/doc", Name: "Docs"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Matches(tt.b); got != tt.want {
+			t.Errorf("%v: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRuleApply(t *testing.T) {
+	rule := Rule{Folder: "Dev/Go", AddTags: "go, Lang", NameTemplate: "{domain}: {title}"}
+	b := Bookmark{URL: "https://go.dev/blog", Name: "Blog", Folder: "Inbox", Tags: "news"}
+	if !rule.Apply(&b) {
+		t.Fatal("Apply reported no change")
+	}
+	if b.Folder != "Dev/Go" || b.Name != "go.dev: Blog" || b.Tags != JoinTags([]string{"news", "go", "Lang"}) {
+		t.Errorf("Apply = %+v", b)
+	}
+	// Applying again changes nothing, the name is already in the shape of the template
+	if rule.Apply(&b) {
+		t.Errorf("Apply changed the bookmark again: %+v", b)
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	rules := []Rule{
+		{ID: "folder", Domain: "go.dev", Folder: "Go"},
+		{ID: "tag", TitleContains: "blog", AddTags: "blog"},
+		{ID: "later", Domain: "go.dev", Folder: "Go/Later"},
+		{ID: "other", Domain: "rust-lang.org", Folder: "Rust"},
+	}
+	b := Bookmark{URL: "https://go.dev/blog", Name: "Go blog", Folder: "Go"}
+	applied := ApplyRules(rules, &b)
+	if want := []string{"tag", "later"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("ApplyRules applied %v, want %v", applied, want)
+	}
+	if b.Folder != "Go/Later" || b.Tags != "blog" {
+		t.Errorf("ApplyRules = %+v, want the last matching folder and the tag", b)
+	}
+}
+
+func TestRenamed(t *testing.T) {
+	b := Bookmark{URL: "https://go.dev/blog", Name: "Blog", Folder: "Inbox"}
+	tests := []struct {
+		template string
+		name     string
+		want     bool
+	}{
+		{"{domain}: {title}", "go.dev: Blog", true},
+		{"{domain}: {title}", "go.dev:Blog", false},
+		{"{domain}: {title}", "example.com: Blog", false},
+		{"{title} - {domain}", "a - b - go.dev", true},
+		{"{title} ({folder}) {url}", "Blog (Inbox) https://go.dev/blog", true},
+		{"{title} ({folder}) {url}", "Blog (Inbox) https://go.dev/", false},
+		{"[{title}] [{folder}]", "[a] b]", false},
+		{"ab{title}ba", "aba", false},
+		{" Fixed ", "Fixed", true},
+	}
+	for _, tt := range tests {
+		if got := renamed(parseNameTemplate(tt.template), tt.name, b); got != tt.want {
+			t.Errorf("renamed(%q, %q) = %v, want %v", tt.template, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPreparedRule(t *testing.T) {
+	rule := Rule{URLPattern: "https://go.dev/*", NameTemplate: "{domain}: {title}", Folder: "Go"}
+	prepared := rule
+	prepared.Prepare()
+	for _, b := range []Bookmark{
+		{URL: "https://go.dev/blog", Name: "Blog"},
+		{URL: "https://go.dev/doc", Name: "go.dev: Docs"},
+		{URL: "https://example.com/", Name: "Example"},
+	} {
+		if rule.Matches(b) != prepared.Matches(b) {
+			t.Errorf("Matches(%v) differs once the rule is prepared", b.URL)
+		}
+		want, got := b, b
+		rule.Apply(&want)
+		prepared.Apply(&got)
+		if got != want {
+			t.Errorf("Apply = %+v once the rule is prepared, want %+v", got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// SavedSearch is a named search query of a user, such as "tag:go site:github.com
+// added:last-30d", evaluated whenever it is used. Count is set on saved searches listed for
+// a user, to the number of bookmarks the query currently matches.
+type SavedSearch struct {
+	ID        string `gorm:"column:id"`
+	UserID    string `gorm:"column:user_id"`
+	Name      string `gorm:"column:name"`
+	Query     string `gorm:"column:query"`
+	Count     *int64 `gorm:"-" json:",omitempty"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new saved search record.
+// It generates a UUID for the ID field.
+func (s *SavedSearch) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	s.ID = id.String()
+	return nil
+}
+
+// TableName specifies the table name for the saved search model.
+func (SavedSearch) TableName() string {
+	return "saved_searches"
+}
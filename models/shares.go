@@ -0,0 +1,65 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+)
+
+// Share kinds, naming what Target selects.
+const (
+	ShareFolder = "folder"
+	ShareTag    = "tag"
+	ShareSearch = "search"
+)
+
+// Share is a public, read-only link to the bookmarks of a user in a folder, with a tag or
+// matching a saved search, whose ID is then the target.
+// Anyone with the token can view it until it expires or is revoked; PasswordHash, when set,
+// also requires a password.
+type Share struct {
+	ID             string     `gorm:"column:id"`
+	UserID         string     `gorm:"column:user_id"`
+	Token          string     `gorm:"column:token"`
+	Kind           string     `gorm:"column:kind"`
+	Target         string     `gorm:"column:target"`
+	Title          string     `gorm:"column:title"`
+	PasswordHash   string     `gorm:"column:password_hash" json:"-"`
+	HasPassword    bool       `gorm:"-"`
+	ExpiresAt      *time.Time `gorm:"column:expires_at"`
+	RevokedAt      *time.Time `gorm:"column:revoked_at"`
+	AccessCount    int64      `gorm:"column:access_count"`
+	LastAccessedAt *time.Time `gorm:"column:last_accessed_at"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// BeforeCreate is a GORM callback that is triggered before creating a new share record.
+// It generates a UUID for the ID field.
+func (s *Share) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+	}
+	s.ID = id.String()
+	return nil
+}
+
+// AfterFind is a GORM callback that is triggered after loading a share record.
+// It tells whether the share needs a password without exposing the hash.
+func (s *Share) AfterFind(tx *gorm.DB) (err error) {
+	s.HasPassword = s.PasswordHash != ""
+	return nil
+}
+
+// TableName specifies the table name for the share model.
+func (Share) TableName() string {
+	return "shares"
+}
+
+// Expired reports whether the share has expired at the given time.
+func (s Share) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// BookmarkVisit holds the visit statistics of a bookmark, counted by the /go redirect.
+// They are kept apart from the bookmark so that visits do not change its version.
+//
+// Frecency ranks bookmarks by visits weighted by their recency: a visit counts half as
+// much as a visit one half-life later. It is stored as the base 2 logarithm of the sum of
+// 2^(t/half-life) over the Unix times t of all visits, which orders bookmarks the same way
+// at any point in time without having to be decayed. Zero means no visits. Scores recorded
+// with different half-lives do not compare.
+type BookmarkVisit struct {
+	BookmarkID    string     `gorm:"column:bookmark_id;primaryKey"`
+	VisitCount    int64      `gorm:"column:visit_count"`
+	LastVisitedAt *time.Time `gorm:"column:last_visited_at"`
+	Frecency      float64    `gorm:"column:frecency"`
+}
+
+// TableName specifies the table name for the bookmark visit model.
+func (BookmarkVisit) TableName() string {
+	return "bookmark_visits"
+}
+
+// AddVisits adds count visits made at a time to the statistics.
+func (v *BookmarkVisit) AddVisits(count int64, at time.Time, halfLife time.Duration) {
+	if count <= 0 {
+		return
+	}
+	v.VisitCount += count
+	if v.LastVisitedAt == nil || at.After(*v.LastVisitedAt) {
+		v.LastVisitedAt = &at
+	}
+
+	score := float64(at.Unix())/halfLife.Seconds() + math.Log2(float64(count))
+	if v.Frecency == 0 {
+		v.Frecency = score
+		return
+	}
+	// Add the scores in linear space without overflowing
+	high, low := math.Max(v.Frecency, score), math.Min(v.Frecency, score)
+	v.Frecency = high + math.Log2(1+math.Exp2(low-high))
+}
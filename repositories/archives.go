@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// ErrArchiveNotFound is returned when a bookmark has no archive.
+var ErrArchiveNotFound = errors.New("archive not found")
+
+// ArchiveUsage is the storage used by the archives of a user.
+type ArchiveUsage struct {
+	Archives int64 `json:"archives"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// RequestArchive queues a bookmark for archiving, creating its archive or queueing an
+// existing one to be fetched again.
+func RequestArchive(bookmark models.Bookmark) (models.Archive, error) {
+	db := config.Cfg.GormDB
+
+	var archive models.Archive
+	result := db.Where("bookmark_id = ?", bookmark.ID).First(&archive)
+	if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+		return archive, result.Error
+	}
+
+	archive.UserID = bookmark.UserID
+	archive.BookmarkID = bookmark.ID
+	archive.URL = bookmark.URL
+	archive.Status = models.ArchivePending
+	archive.Error = ""
+	if archive.ID == "" {
+		result = db.Create(&archive)
+	} else {
+		result = db.Model(&archive).Select("url", "status", "error").Updates(&archive)
+	}
+	if result.Error != nil {
+		return archive, result.Error
+	}
+
+	return archive, nil
+}
+
+// GetUsersArchive retrieves the archive of a user's bookmark.
+func GetUsersArchive(bookmarkID string, userID string) (models.Archive, error) {
+	db := config.Cfg.GormDB
+
+	var archive models.Archive
+	result := db.Where("bookmark_id = ? AND user_id = ?", bookmarkID, userID).First(&archive)
+	if result.Error == gorm.ErrRecordNotFound {
+		return archive, ErrArchiveNotFound
+	}
+	if result.Error != nil {
+		return archive, result.Error
+	}
+
+	return archive, nil
+}
+
+// GetPendingArchives retrieves up to limit archives waiting to be fetched, oldest first.
+func GetPendingArchives(limit int) ([]models.Archive, error) {
+	db := config.Cfg.GormDB
+
+	var archives []models.Archive
+	result := db.Where("status = ?", models.ArchivePending).Order("updated_at").Limit(limit).Find(&archives)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return archives, nil
+}
+
+// GetExpiredArchives retrieves up to limit archives that are past the retention period,
+// or whose bookmark was permanently deleted. A zero archivedBefore only returns the latter.
+// Archives of bookmarks in the trash are kept, so restoring a bookmark restores its archive.
+func GetExpiredArchives(archivedBefore time.Time, limit int) ([]models.Archive, error) {
+	db := config.Cfg.GormDB
+
+	orphaned := "bookmark_id NOT IN (SELECT id FROM bookmarks)"
+	query := db.Where(orphaned)
+	if !archivedBefore.IsZero() {
+		query = db.Where(db.Where(orphaned).Or("archived_at < ?", archivedBefore))
+	}
+
+	var archives []models.Archive
+	result := query.Limit(limit).Find(&archives)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return archives, nil
+}
+
+// GetOrphanedArchives retrieves up to limit archives of a user whose bookmark was
+// permanently deleted, or those of every user when userID is empty.
+func GetOrphanedArchives(userID string, limit int) ([]models.Archive, error) {
+	db := config.Cfg.GormDB
+
+	query := db.Where("bookmark_id NOT IN (SELECT id FROM bookmarks)")
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var archives []models.Archive
+	result := query.Limit(limit).Find(&archives)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return archives, nil
+}
+
+// GetArchiveUsage returns how many archives a user has and how much storage they use.
+func GetArchiveUsage(userID string) (ArchiveUsage, error) {
+	db := config.Cfg.GormDB
+
+	var usage ArchiveUsage
+	result := db.Model(&models.Archive{}).
+		Select("COUNT(*) AS archives, COALESCE(SUM(size), 0) AS bytes").
+		Where("user_id = ?", userID).
+		Scan(&usage)
+	if result.Error != nil {
+		return usage, result.Error
+	}
+
+	return usage, nil
+}
+
+// SaveArchive records the outcome of fetching an archive.
+func SaveArchive(archive models.Archive) error {
+	db := config.Cfg.GormDB
+
+	result := db.Model(&archive).
+		Select("status", "title", "error", "html_key", "text_key", "size", "archived_at").
+		Updates(&archive)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// DeleteArchive removes an archive record. The stored snapshot is removed by the caller.
+func DeleteArchive(archiveID string) error {
+	db := config.Cfg.GormDB
+
+	result := db.Where("id = ?", archiveID).Delete(&models.Archive{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
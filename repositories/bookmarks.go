@@ -1,12 +1,20 @@
 package repositories
 
 import (
+	"errors"
 	"log"
+	"strings"
 
 	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/library"
 	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
 )
 
+// ErrVersionMismatch is returned when a bookmark is written with a version that is no longer
+// its current version.
+var ErrVersionMismatch = errors.New("bookmark was changed since this version")
+
 // GetAllBookmarks retrieves all bookmarks from the database.
 func GetAllBookmarks() ([]models.Bookmark, error) {
 	db := config.Cfg.GormDB
@@ -20,12 +28,14 @@ func GetAllBookmarks() ([]models.Bookmark, error) {
 	return bookmarks, nil
 }
 
-// GetUsersBookmarks retrieves bookmarks associated with a specific user.
-func GetUsersBookmarks(userID string) ([]models.Bookmark, error) {
+// GetUsersBookmarks retrieves the bookmarks a user can see, their own and those in folders
+// shared with them, with their visit statistics. Scopes narrow down which bookmarks are
+// returned.
+func GetUsersBookmarks(userID string, scopes ...func(*gorm.DB) *gorm.DB) ([]models.Bookmark, error) {
 	db := config.Cfg.GormDB
 
 	var bookmarks []models.Bookmark
-	result := db.Where("user_id=?", userID).Find(&bookmarks)
+	result := db.Scopes(WithVisits()).Scopes(scopes...).Scopes(AccessibleBy(userID, models.RoleViewer)).Find(&bookmarks)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -33,41 +43,237 @@ func GetUsersBookmarks(userID string) ([]models.Bookmark, error) {
 	return bookmarks, nil
 }
 
-// SaveAllBookmarks saves multiple bookmarks to the database.
-func SaveAllBookmarks(bookmarks []models.Bookmark) error {
+// SaveBookmark saves a single bookmark row to the database, on behalf of its owner or an
+// editor of its folder. An editor cannot move the bookmark out of the folders they edit.
+// When the bookmark has a version, it is only saved if that is still the current version,
+// otherwise ErrVersionMismatch is returned. Changing the URL to one the owner already saved
+// in another bookmark returns ErrBookmarkExists.
+func SaveBookmark(bookmark models.Bookmark, userID string) error {
 	db := config.Cfg.GormDB
 
-	result := db.Debug().Table("bookmarks").Create(&bookmarks)
-	if result.Error != nil {
-		log.Println(result.Error.Error())
-		return result.Error
+	if bookmark.URL != "" {
+		bookmark.CanonicalURL = canonicalURL(bookmark.URL)
+	}
+	if err := storeIcon(db, &bookmark); err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		op, err := beginOperation(tx, userID, models.OperationSave)
+		if err != nil {
+			return err
+		}
+		return trackChanges(tx, op, []string{bookmark.ID}, func() error {
+			// Only tell users about the URLs of bookmarks they may edit
+			if bookmark.URL != "" {
+				editable, err := canEditBookmark(tx, bookmark.ID, userID)
+				if err != nil {
+					return err
+				}
+				if editable {
+					if err := checkURLNotSaved(tx, bookmark.ID, bookmark.CanonicalURL); err != nil {
+						return err
+					}
+				}
+			}
+			query := tx.Debug().Table("bookmarks").Where("id = ?", bookmark.ID).Scopes(AccessibleBy(userID, models.RoleEditor))
+			if bookmark.Version != 0 {
+				query = query.Where("version = ?", bookmark.Version)
+			}
+			result := query.Omit("version", "user_id", "duplicate").Updates(&bookmark)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return writeError(tx, bookmark.ID, userID, bookmark.Version)
+			}
+			if bookmark.Folder == "" {
+				return nil
+			}
+			editable, err := canEditBookmark(tx, bookmark.ID, userID)
+			if err != nil {
+				return err
+			}
+			if !editable {
+				return ErrPermissionDenied
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return err
 	}
 
 	return nil
 }
 
-// SaveBookmark saves a single bookmark row to the database
-func SaveBookmark(bookmark models.Bookmark, userID string) error {
+// DeleteBookmark moves a bookmark to its owner's trash, on behalf of the owner or an editor
+// of its folder. With a version, it is only deleted if that is still the current version,
+// otherwise ErrVersionMismatch is returned.
+func DeleteBookmark(bookmarkID string, userID string, version int64) error {
 	db := config.Cfg.GormDB
 
-	result := db.Debug().Table("bookmarks").Where("id = ? AND user_id = ?", bookmark.ID, userID).Updates(&bookmark)
-	if result.Error != nil {
-		log.Println(result.Error.Error())
-		return result.Error
+	// Delete the bookmark based on the bookmark ID and the user's role in its folder
+	err := db.Transaction(func(tx *gorm.DB) error {
+		op, err := beginOperation(tx, userID, models.OperationDelete)
+		if err != nil {
+			return err
+		}
+		return trackChanges(tx, op, []string{bookmarkID}, func() error {
+			query := tx.Debug().Table("bookmarks").Where("id = ?", bookmarkID).Scopes(AccessibleBy(userID, models.RoleEditor))
+			if version != 0 {
+				query = query.Where("version = ?", version)
+			}
+			result := query.Delete(&models.Bookmark{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return writeError(tx, bookmarkID, userID, version)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return err
 	}
 
 	return nil
 }
 
-func DeleteBookmark(bookmarkID string, userID string) error {
+// writeError explains why a write of a bookmark changed nothing: the user cannot see the
+// bookmark, may only view it, or it has another version than the one written.
+func writeError(tx *gorm.DB, bookmarkID string, userID string, version int64) error {
+	var count int64
+	err := tx.Model(&models.Bookmark{}).Scopes(AccessibleBy(userID, models.RoleViewer)).Where("id = ?", bookmarkID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrBookmarkNotFound
+	}
+	editable, err := canEditBookmark(tx, bookmarkID, userID)
+	if err != nil {
+		return err
+	}
+	if !editable {
+		return ErrPermissionDenied
+	}
+	if version != 0 {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// ScanUsersBookmarks streams the bookmarks of a user in folder order, calling fn for every row.
+// Scopes narrow down which bookmarks are returned. Only bookmarks owned by the user are
+// read, not those of folders shared with them.
+func ScanUsersBookmarks(userID string, fn func(models.Bookmark) error, scopes ...func(*gorm.DB) *gorm.DB) error {
+	return scanUsersBookmarks(config.Cfg.GormDB, userID, fn, scopes...)
+}
+
+func scanUsersBookmarks(db *gorm.DB, userID string, fn func(models.Bookmark) error, scopes ...func(*gorm.DB) *gorm.DB) error {
+	rows, err := usersBookmarksInFolderOrder(db, userID, scopes...).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookmark models.Bookmark
+		if err := db.ScanRows(rows, &bookmark); err != nil {
+			return err
+		}
+		if err := fn(bookmark); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// bookmarkWithIcon is a bookmark row read together with its stored icon.
+type bookmarkWithIcon struct {
+	models.Bookmark
+	IconContentType string `gorm:"column:icon_content_type"`
+	IconData        []byte `gorm:"column:icon_data"`
+}
+
+// ScanUsersBookmarksWithIcons is ScanUsersBookmarks with the stored icon of every bookmark
+// read in the same query and set inline, as a data URI, in the bookmark Icon.
+func ScanUsersBookmarksWithIcons(userID string, fn func(models.Bookmark) error, scopes ...func(*gorm.DB) *gorm.DB) error {
 	db := config.Cfg.GormDB
 
-	// Delete the bookmark based on the bookmark ID and user ID
-	result := db.Debug().Table("bookmarks").Where("id = ? AND user_id = ?", bookmarkID, userID).Delete(&models.Bookmark{})
-	if result.Error != nil {
-		log.Println(result.Error.Error())
-		return result.Error
+	rows, err := usersBookmarksInFolderOrder(db, userID, scopes...).
+		Select("bookmarks.*, " +
+			"(SELECT content_type FROM icons WHERE icons.hash = bookmarks.icon_hash) AS icon_content_type, " +
+			"(SELECT data FROM icons WHERE icons.hash = bookmarks.icon_hash) AS icon_data").
+		Rows()
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
-	return nil
+	for rows.Next() {
+		var row bookmarkWithIcon
+		if err := db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		bookmark := row.Bookmark
+		if len(row.IconData) > 0 {
+			bookmark.Icon = library.DataURI(row.IconContentType, row.IconData)
+		}
+		if err := fn(bookmark); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// usersBookmarksInFolderOrder selects the bookmarks of a user in the order they are streamed.
+func usersBookmarksInFolderOrder(db *gorm.DB, userID string, scopes ...func(*gorm.DB) *gorm.DB) *gorm.DB {
+	return db.Model(&models.Bookmark{}).
+		Scopes(scopes...).
+		Where("user_id = ?", userID).
+		Order(models.FolderSortExpression("folder")).
+		Order("add_date, created_at")
+}
+
+// InFolder limits a bookmark query to a folder and its subfolders.
+func InFolder(folder string) func(*gorm.DB) *gorm.DB {
+	return folderCondition(folder).scope()
+}
+
+// WithTag limits a bookmark query to bookmarks carrying the given tag.
+func WithTag(tag string) func(*gorm.DB) *gorm.DB {
+	return tagCondition(tag).scope()
+}
+
+// Matching limits a bookmark query to bookmarks whose name, URL, description, notes, tags
+// or keyword contain every word of the search text.
+func Matching(text string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, word := range strings.Fields(text) {
+			db = db.Scopes(textCondition(word).scope())
+		}
+		return db
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// canonicalURL returns the canonical form of a bookmark URL used to find duplicates,
+// or the URL itself when it cannot be parsed.
+func canonicalURL(raw string) string {
+	canonical, err := library.CanonicalURL(raw, config.Cfg.TrackingParams)
+	if err != nil {
+		return raw
+	}
+	return canonical
 }
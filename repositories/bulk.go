@@ -0,0 +1,271 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// Bulk actions.
+const (
+	BulkMove            = "move"
+	BulkAddTags         = "add_tags"
+	BulkRemoveTags      = "remove_tags"
+	BulkDelete          = "delete"
+	BulkRestore         = "restore"
+	BulkRefreshMetadata = "refresh_metadata"
+)
+
+// BulkActions lists the supported bulk actions.
+var BulkActions = []string{BulkMove, BulkAddTags, BulkRemoveTags, BulkDelete, BulkRestore, BulkRefreshMetadata}
+
+// Outcomes of a bulk action on a single bookmark.
+const (
+	BulkItemOK       = "ok"
+	BulkItemNotFound = "not_found"
+	// BulkItemForbidden is the outcome for a bookmark in a shared folder the user may only view.
+	BulkItemForbidden = "forbidden"
+	// BulkItemExists is the outcome of restoring a bookmark whose URL was saved again since.
+	BulkItemExists = "exists"
+)
+
+// bulkBatchSize is the number of bookmarks updated per query.
+const bulkBatchSize = 200
+
+// BulkOperation describes an action applied to many bookmarks at once.
+// Folder is the destination of a move, Tags the tags added or removed.
+type BulkOperation struct {
+	Action string   `json:"action"`
+	Folder string   `json:"folder,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// BulkItem is the outcome of a bulk action on one bookmark.
+type BulkItem struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// BulkResult reports the outcome of a bulk action.
+type BulkResult struct {
+	Action      string     `json:"action"`
+	OperationID string     `json:"operation_id"`
+	Succeeded   int        `json:"succeeded"`
+	Failed      int        `json:"failed"`
+	Items       []BulkItem `json:"items"`
+}
+
+// IsBulkAction reports whether action is a supported bulk action.
+func IsBulkAction(action string) bool {
+	for _, a := range BulkActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the operation has what its action needs.
+func (op BulkOperation) Validate() error {
+	if !IsBulkAction(op.Action) {
+		return fmt.Errorf("unknown bulk action %q", op.Action)
+	}
+	if (op.Action == BulkAddTags || op.Action == BulkRemoveTags) && models.JoinTags(op.Tags) == "" {
+		return fmt.Errorf("%v needs at least one tag", op.Action)
+	}
+	return nil
+}
+
+// GetUsersBookmarkIDs retrieves the IDs of the bookmarks a user may edit selected by the
+// scopes, including those in folders shared with them. With deleted set, only the bookmarks
+// in the user's own trash are selected.
+func GetUsersBookmarkIDs(userID string, deleted bool, scopes ...func(*gorm.DB) *gorm.DB) ([]string, error) {
+	db := config.Cfg.GormDB
+
+	query := db.Model(&models.Bookmark{}).Scopes(scopes...).Scopes(AccessibleBy(userID, models.RoleEditor))
+	if deleted {
+		query = db.Model(&models.Bookmark{}).Scopes(scopes...).Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+	}
+
+	var ids []string
+	result := query.Order("created_at").Pluck("id", &ids)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return ids, nil
+}
+
+// ApplyBulk applies an operation to the given bookmarks of a user in a single transaction,
+// reporting progress after every batch. Bookmarks in folders shared with the user are
+// changed when they are an editor, and reported as forbidden when they may only view them
+// or a move would take them out of the shared folder. IDs the user cannot see, or that are
+// not deleted in their own trash when restoring, are reported as not found. Bookmarks whose URL the user saved
+// again stay in the trash and are reported as existing. The changes are recorded as one
+// operation, so the whole action can be undone.
+//
+// Refreshing metadata queues the bookmarks for the metadata cron job rather than fetching
+// their pages while the transaction is open.
+func ApplyBulk(userID string, ids []string, op BulkOperation, progress func(processed, total int)) (*BulkResult, error) {
+	db := config.Cfg.GormDB
+
+	if err := op.Validate(); err != nil {
+		return nil, err
+	}
+
+	result := &BulkResult{Action: op.Action, Items: make([]BulkItem, 0, len(ids))}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		operation, err := beginOperation(tx, userID, models.OperationBulk)
+		if err != nil {
+			return err
+		}
+		result.OperationID = operation.ID
+
+		for start := 0; start < len(ids); start += bulkBatchSize {
+			batch := ids[start:minInt(start+bulkBatchSize, len(ids))]
+			var statuses map[string]string
+			err := trackChanges(tx, operation, batch, func() (err error) {
+				statuses, err = applyBulkBatch(tx, userID, batch, op)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			for _, id := range batch {
+				item := BulkItem{ID: id, Status: statuses[id]}
+				if item.Status == "" {
+					item.Status = BulkItemNotFound
+				}
+				if item.Status == BulkItemOK {
+					result.Succeeded++
+				} else {
+					result.Failed++
+				}
+				result.Items = append(result.Items, item)
+			}
+			if progress != nil {
+				progress(start+len(batch), len(ids))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// applyBulkBatch applies an operation to one batch of bookmarks and returns the outcome for
+// the IDs found.
+func applyBulkBatch(tx *gorm.DB, userID string, ids []string, op BulkOperation) (map[string]string, error) {
+	query := tx.Where("id IN ?", ids).Scopes(AccessibleBy(userID, models.RoleViewer))
+	if op.Action == BulkRestore {
+		query = tx.Unscoped().Where("id IN ? AND user_id = ? AND deleted_at IS NOT NULL", ids, userID)
+	}
+
+	var bookmarks []models.Bookmark
+	if err := query.Select("id", "user_id", "folder", "url", "canonical_url", "duplicate", "tags").Find(&bookmarks).Error; err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]string, len(bookmarks))
+	memberships, err := usersMemberships(tx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	var foundIDs []string
+	restored := map[string]bool{}
+	folderOwners := map[string]bool{}
+	for _, b := range bookmarks {
+		if b.UserID != userID {
+			if !editsFolder(memberships, b.UserID, b.Folder) ||
+				(op.Action == BulkMove && !editsFolder(memberships, b.UserID, op.Folder)) {
+				statuses[b.ID] = BulkItemForbidden
+				continue
+			}
+		}
+		if op.Action == BulkMove {
+			folderOwners[b.UserID] = true
+		}
+		if op.Action == BulkRestore && !b.Duplicate {
+			canonical := b.CanonicalURL
+			if canonical == "" {
+				canonical = canonicalURL(b.URL)
+			}
+			saved, err := savedBookmarkID(tx, b.UserID, canonical, b.ID)
+			if err != nil {
+				return nil, err
+			}
+			if saved != "" || restored[canonical] {
+				statuses[b.ID] = BulkItemExists
+				continue
+			}
+			restored[canonical] = true
+		}
+		statuses[b.ID] = BulkItemOK
+		foundIDs = append(foundIDs, b.ID)
+	}
+	if len(foundIDs) == 0 {
+		return statuses, nil
+	}
+
+	// Moved bookmarks go to the folder of that path in their owner's tree
+	for ownerID := range folderOwners {
+		if err := ensureFolder(tx, ownerID, op.Folder); err != nil {
+			return nil, err
+		}
+	}
+
+	bookmarksByID := tx.Model(&models.Bookmark{}).Where("id IN ?", foundIDs)
+	switch op.Action {
+	case BulkMove:
+		err = bookmarksByID.Updates(map[string]interface{}{"folder": op.Folder, "last_modified": time.Now().Unix()}).Error
+	case BulkDelete:
+		err = tx.Where("id IN ?", foundIDs).Delete(&models.Bookmark{}).Error
+	case BulkRestore:
+		err = tx.Unscoped().Model(&models.Bookmark{}).Where("id IN ?", foundIDs).Update("deleted_at", nil).Error
+	case BulkRefreshMetadata:
+		err = bookmarksByID.Update("metadata_fetched_at", nil).Error
+	case BulkAddTags, BulkRemoveTags:
+		for _, b := range bookmarks {
+			if statuses[b.ID] != BulkItemOK {
+				continue
+			}
+			tags := bulkTags(b.TagList(), op)
+			if tags == b.Tags {
+				continue
+			}
+			err = tx.Model(&models.Bookmark{}).Where("id = ?", b.ID).
+				Updates(map[string]interface{}{"tags": tags, "last_modified": time.Now().Unix()}).Error
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// bulkTags returns the tags of a bookmark after adding or removing the operation tags.
+func bulkTags(tags []string, op BulkOperation) string {
+	if op.Action == BulkAddTags {
+		return models.JoinTags(append(tags, op.Tags...))
+	}
+	remove := map[string]bool{}
+	for _, t := range models.SplitTags(models.JoinTags(op.Tags)) {
+		remove[t] = true
+	}
+	var kept []string
+	for _, t := range tags {
+		if !remove[t] {
+			kept = append(kept, t)
+		}
+	}
+	return models.JoinTags(kept)
+}
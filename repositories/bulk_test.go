@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openTestDB points the repositories at a new database with the seed schema for the
+// duration of a test.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	schema, err := os.ReadFile(filepath.Join("..", "seed", "init.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(string(schema)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	previous := config.Cfg.GormDB
+	config.Cfg.GormDB = db
+	t.Cleanup(func() {
+		config.Cfg.GormDB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestApplyBulkTagsSharedFolder(t *testing.T) {
+	tests := []struct {
+		role   string
+		status string
+		tags   string
+	}{
+		{models.RoleViewer, BulkItemForbidden, "a"},
+		{models.RoleEditor, BulkItemOK, "a,b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			db := openTestDB(t)
+			for _, id := range []string{"owner", "member"} {
+				if err := db.Exec("INSERT INTO users (id, email, password) VALUES (?, ?, '')", id, id+"@example.com").Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			folder := models.Folder{UserID: "owner", Path: "Shared"}
+			if err := db.Create(&folder).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Create(&models.FolderMember{FolderID: folder.ID, UserID: "member", Role: tt.role}).Error; err != nil {
+				t.Fatal(err)
+			}
+			bookmark := models.Bookmark{UserID: "owner", URL: "https://example.com/", Folder: "Shared", Tags: "a"}
+			if err := db.Create(&bookmark).Error; err != nil {
+				t.Fatal(err)
+			}
+			// A bookmark of the member's own is tagged along with it
+			own := models.Bookmark{UserID: "member", URL: "https://example.org/"}
+			if err := db.Create(&own).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := ApplyBulk("member", []string{bookmark.ID, own.ID}, BulkOperation{Action: BulkAddTags, Tags: []string{"b"}}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []BulkItem{{ID: bookmark.ID, Status: tt.status}, {ID: own.ID, Status: BulkItemOK}}
+			if !reflect.DeepEqual(result.Items, want) {
+				t.Errorf("Items = %+v, want %+v", result.Items, want)
+			}
+
+			var saved models.Bookmark
+			if err := db.Where("id = ?", bookmark.ID).First(&saved).Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved.Tags != tt.tags {
+				t.Errorf("Tags = %q, want %q", saved.Tags, tt.tags)
+			}
+			var revisions int64
+			if err := db.Model(&models.Revision{}).Where("bookmark_id = ?", bookmark.ID).Count(&revisions).Error; err != nil {
+				t.Fatal(err)
+			}
+			if changed := tt.status == BulkItemOK; (revisions > 0) != changed {
+				t.Errorf("recorded %d revisions, want them only when the tags change", revisions)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrBookmarkNotFound is returned when a bookmark does not exist for the user.
+	ErrBookmarkNotFound = errors.New("bookmark not found")
+	// ErrNotDuplicates is returned when bookmarks to merge do not share a canonical URL.
+	ErrNotDuplicates = errors.New("bookmarks do not share the same canonical URL")
+	// ErrBookmarkExists is returned when a bookmark would be saved at a URL the user already
+	// saved. Only imports keep both, marking the new copy as a duplicate.
+	ErrBookmarkExists = errors.New("a bookmark with this URL is already saved")
+)
+
+// DuplicateGroup is a set of bookmarks sharing the same canonical URL.
+type DuplicateGroup struct {
+	CanonicalURL string            `json:"canonical_url"`
+	Bookmarks    []models.Bookmark `json:"bookmarks"`
+}
+
+// GetUsersDuplicates retrieves the bookmarks of a user that share a canonical URL with
+// another bookmark, grouped by canonical URL.
+func GetUsersDuplicates(userID string) ([]DuplicateGroup, error) {
+	db := config.Cfg.GormDB
+
+	var urls []string
+	result := db.Model(&models.Bookmark{}).
+		Where("user_id = ? AND canonical_url <> ''", userID).
+		Group("canonical_url").
+		Having("COUNT(*) > 1").
+		Pluck("canonical_url", &urls)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(urls) == 0 {
+		return []DuplicateGroup{}, nil
+	}
+
+	var bookmarks []models.Bookmark
+	result = db.Where("user_id = ? AND canonical_url IN ?", userID, urls).
+		Order("canonical_url, add_date, created_at").
+		Find(&bookmarks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var groups []DuplicateGroup
+	for _, b := range bookmarks {
+		if len(groups) == 0 || groups[len(groups)-1].CanonicalURL != b.CanonicalURL {
+			groups = append(groups, DuplicateGroup{CanonicalURL: b.CanonicalURL})
+		}
+		last := &groups[len(groups)-1]
+		last.Bookmarks = append(last.Bookmarks, b)
+	}
+
+	return groups, nil
+}
+
+// MergeBookmarks merges duplicate bookmarks of a user into one and deletes the others.
+//
+// The kept bookmark is keepID, or the oldest bookmark when keepID is empty. It receives
+// the tags of all duplicates, the earliest add date, and any name, icon or keyword it
+// is missing. The different notes and descriptions of the duplicates are appended to its
+// own, separated by a blank line. All bookmarks must share the same canonical URL.
+func MergeBookmarks(userID string, keepID string, ids []string) (models.Bookmark, error) {
+	db := config.Cfg.GormDB
+
+	unique := map[string]bool{}
+	for _, id := range append([]string{keepID}, ids...) {
+		if id != "" {
+			unique[id] = true
+		}
+	}
+	all := make([]string, 0, len(unique))
+	for id := range unique {
+		all = append(all, id)
+	}
+
+	var kept models.Bookmark
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var bookmarks []models.Bookmark
+		if err := tx.Where("user_id = ? AND id IN ?", userID, all).Order("add_date, created_at").Find(&bookmarks).Error; err != nil {
+			return err
+		}
+		if len(bookmarks) != len(all) {
+			return ErrBookmarkNotFound
+		}
+		if len(bookmarks) < 2 {
+			return ErrNotDuplicates
+		}
+
+		keepIndex := 0
+		for i, b := range bookmarks {
+			if b.ID == keepID {
+				keepIndex = i
+			}
+		}
+		kept = bookmarks[keepIndex]
+		if kept.CanonicalURL == "" {
+			kept.CanonicalURL = canonicalURL(kept.URL)
+		}
+
+		var tags []string
+		var remove []string
+		notes := []string{kept.Notes}
+		descriptions := []string{kept.Description}
+		for _, b := range bookmarks {
+			canonical := b.CanonicalURL
+			if canonical == "" {
+				canonical = canonicalURL(b.URL)
+			}
+			if canonical != kept.CanonicalURL {
+				return ErrNotDuplicates
+			}
+			tags = append(tags, b.TagList()...)
+			if b.ID == kept.ID {
+				continue
+			}
+			remove = append(remove, b.ID)
+			if b.AddDate != 0 && (kept.AddDate == 0 || b.AddDate < kept.AddDate) {
+				kept.AddDate = b.AddDate
+			}
+			if kept.Name == "" {
+				kept.Name = b.Name
+			}
+			if kept.Icon == "" {
+				kept.Icon = b.Icon
+			}
+			if kept.IconHash == "" {
+				kept.IconHash = b.IconHash
+			}
+			if kept.Keyword == "" {
+				kept.Keyword = b.Keyword
+			}
+			notes = append(notes, b.Notes)
+			descriptions = append(descriptions, b.Description)
+		}
+		kept.Tags = models.JoinTags(tags)
+		kept.Notes = joinParagraphs(notes)
+		kept.Description = joinParagraphs(descriptions)
+
+		op, err := beginOperation(tx, userID, models.OperationMerge)
+		if err != nil {
+			return err
+		}
+		return trackChanges(tx, op, all, func() error {
+			if err := tx.Where("id IN ? AND user_id = ?", remove, userID).Delete(&models.Bookmark{}).Error; err != nil {
+				return err
+			}
+			// The kept bookmark takes the place of the original unless that was left out
+			saved, err := savedBookmarkID(tx, userID, kept.CanonicalURL, kept.ID)
+			if err != nil {
+				return err
+			}
+			kept.Duplicate = saved != ""
+			return tx.Model(&models.Bookmark{}).Where("id = ? AND user_id = ?", kept.ID, userID).
+				Select("canonical_url", "duplicate", "add_date", "name", "icon", "icon_hash", "keyword", "tags", "notes", "description").
+				Updates(&kept).Error
+		})
+	})
+	if err != nil {
+		return kept, err
+	}
+
+	return kept, nil
+}
+
+// joinParagraphs joins the distinct non-empty texts, separated by a blank line.
+func joinParagraphs(texts []string) string {
+	var paragraphs []string
+	seen := map[string]bool{}
+	for _, text := range texts {
+		text = strings.TrimSpace(text)
+		if text == "" || seen[text] {
+			continue
+		}
+		seen[text] = true
+		paragraphs = append(paragraphs, text)
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// BackfillCanonicalURLs stores the canonical URL of up to limit bookmarks saved without one
+// and returns how many were updated. A bookmark whose URL another bookmark of the user
+// already has is marked as a duplicate of it.
+func BackfillCanonicalURLs(limit int) (int, error) {
+	db := config.Cfg.GormDB
+
+	var bookmarks []models.Bookmark
+	result := db.Select("id", "user_id", "url").
+		Where("(canonical_url IS NULL OR canonical_url = '') AND url <> ''").
+		Limit(limit).
+		Find(&bookmarks)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for _, b := range bookmarks {
+		canonical := canonicalURL(b.URL)
+		saved, err := savedBookmarkID(db, b.UserID, canonical, b.ID)
+		if err != nil {
+			return 0, err
+		}
+		result := db.Model(&models.Bookmark{}).Where("id = ?", b.ID).UpdateColumns(map[string]interface{}{
+			"canonical_url": canonical,
+			"duplicate":     saved != "",
+		})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+	}
+
+	return len(bookmarks), nil
+}
+
+// checkURLNotSaved returns ErrBookmarkExists when moving a bookmark to a canonical URL, or
+// out of the trash, would give its owner a second bookmark with that URL. Duplicates kept by
+// imports may share their URL. A bookmark that does not exist passes.
+func checkURLNotSaved(tx *gorm.DB, bookmarkID string, canonical string) error {
+	var bookmarks []models.Bookmark
+	err := tx.Unscoped().Select("id", "user_id", "url", "canonical_url", "duplicate").Where("id = ?", bookmarkID).Limit(1).Find(&bookmarks).Error
+	if err != nil || len(bookmarks) == 0 || bookmarks[0].Duplicate {
+		return err
+	}
+	if canonical == "" {
+		canonical = bookmarks[0].CanonicalURL
+	}
+	if canonical == "" {
+		canonical = canonicalURL(bookmarks[0].URL)
+	}
+
+	saved, err := savedBookmarkID(tx, bookmarks[0].UserID, canonical, bookmarkID)
+	if err != nil {
+		return err
+	}
+	if saved != "" {
+		return ErrBookmarkExists
+	}
+	return nil
+}
+
+// savedBookmarkID returns the ID of the bookmark of a user outside the trash, other than
+// exceptID, that holds a canonical URL and is not a duplicate, or "" when there is none.
+func savedBookmarkID(tx *gorm.DB, userID string, canonical string, exceptID string) (string, error) {
+	if canonical == "" {
+		return "", nil
+	}
+
+	var ids []string
+	err := tx.Model(&models.Bookmark{}).
+		Where("user_id = ? AND canonical_url = ? AND NOT duplicate AND id <> ?", userID, canonical, exceptID).
+		Limit(1).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return "", err
+	}
+	return ids[0], nil
+}
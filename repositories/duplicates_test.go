@@ -0,0 +1,21 @@
+package repositories
+
+import "testing"
+
+func TestJoinParagraphs(t *testing.T) {
+	tests := []struct {
+		texts []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"", "  "}, ""},
+		{[]string{"kept", ""}, "kept"},
+		{[]string{"", "merged"}, "merged"},
+		{[]string{"kept", " kept ", "merged"}, "kept\n\nmerged"},
+	}
+	for _, tt := range tests {
+		if got := joinParagraphs(tt.texts); got != tt.want {
+			t.Errorf("joinParagraphs(%q) = %q, want %q", tt.texts, got, tt.want)
+		}
+	}
+}
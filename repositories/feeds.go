@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// ErrFeedNotFound is returned when a feed does not exist or belongs to another user.
+var ErrFeedNotFound = errors.New("feed not found")
+
+// SaveFeed saves a new feed.
+func SaveFeed(feed *models.Feed) error {
+	db := config.Cfg.GormDB
+
+	if _, err := FeedScope(*feed); err != nil {
+		return err
+	}
+
+	result := db.Create(feed)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// GetUsersFeeds retrieves the feeds of a user, newest first.
+func GetUsersFeeds(userID string) ([]models.Feed, error) {
+	db := config.Cfg.GormDB
+
+	var feeds []models.Feed
+	result := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&feeds)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return feeds, nil
+}
+
+// GetFeed retrieves a feed by its ID.
+func GetFeed(feedID string) (models.Feed, error) {
+	db := config.Cfg.GormDB
+
+	var feed models.Feed
+	result := db.Where("id = ?", feedID).First(&feed)
+	if result.Error == gorm.ErrRecordNotFound {
+		return feed, ErrFeedNotFound
+	}
+	if result.Error != nil {
+		return feed, result.Error
+	}
+
+	return feed, nil
+}
+
+// SetFeedToken replaces the secret token of a user's feed, so the old feed URL stops working.
+func SetFeedToken(feedID string, userID string, token string) error {
+	db := config.Cfg.GormDB
+
+	result := db.Model(&models.Feed{}).Where("id = ? AND user_id = ?", feedID, userID).Update("token", token)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeedNotFound
+	}
+
+	return nil
+}
+
+// DeleteFeed deletes a feed of a user.
+func DeleteFeed(feedID string, userID string) error {
+	db := config.Cfg.GormDB
+
+	result := db.Where("id = ? AND user_id = ?", feedID, userID).Delete(&models.Feed{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeedNotFound
+	}
+
+	return nil
+}
+
+// FeedScope limits a bookmark query to the bookmarks a feed publishes.
+func FeedScope(feed models.Feed) (func(*gorm.DB) *gorm.DB, error) {
+	switch feed.Kind {
+	case models.FeedCollection:
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	case models.FeedFolder:
+		return InFolder(feed.Target), nil
+	case models.FeedTag:
+		return WithTag(feed.Target), nil
+	case models.FeedSearch:
+		return SavedSearchScope(feed.Target, feed.UserID)
+	}
+	return nil, fmt.Errorf("unknown feed kind %q", feed.Kind)
+}
+
+// GetNewestBookmarks retrieves the most recently added bookmarks of a user, up to limit.
+// Scopes narrow down which bookmarks are returned.
+func GetNewestBookmarks(userID string, limit int, scopes ...func(*gorm.DB) *gorm.DB) ([]models.Bookmark, error) {
+	db := config.Cfg.GormDB
+
+	var bookmarks []models.Bookmark
+	result := db.Scopes(scopes...).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&bookmarks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return bookmarks, nil
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"log"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaveFolders saves multiple folders to the database.
+// Folders that already exist for the user have their imported attributes updated.
+func SaveFolders(folders []models.Folder) error {
+	return saveFolders(config.Cfg.GormDB, folders)
+}
+
+func saveFolders(db *gorm.DB, folders []models.Folder) error {
+	if len(folders) == 0 {
+		return nil
+	}
+
+	result := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"add_date", "last_modified", "toolbar", "updated_at"}),
+	}).Create(&folders)
+	if result.Error != nil {
+		log.Println(result.Error.Error())
+		return result.Error
+	}
+
+	return nil
+}
+
+// ensureFolder saves a folder of a user unless it exists. An existing folder keeps its
+// attributes.
+func ensureFolder(db *gorm.DB, userID string, path string) error {
+	if path == "" {
+		return nil
+	}
+	folder := models.Folder{UserID: userID, Path: path}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&folder).Error
+}
+
+// GetUsersFolders retrieves the folders associated with a specific user.
+func GetUsersFolders(userID string, scopes ...func(*gorm.DB) *gorm.DB) ([]models.Folder, error) {
+	db := config.Cfg.GormDB
+
+	var folders []models.Folder
+	result := db.Scopes(scopes...).Where("user_id = ?", userID).Find(&folders)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return folders, nil
+}
+
+// FolderWithin limits a folder query to a folder and its subfolders.
+func FolderWithin(path string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(path = ? OR path LIKE ? ESCAPE '\\')", path, escapeLike(path+models.FolderSeparator)+"%")
+	}
+}
@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrIconNotFound is returned when no icon is stored under a hash.
+var ErrIconNotFound = errors.New("icon not found")
+
+// SaveIcon normalizes an icon, stores it unless the same icon is already stored, and
+// returns its hash.
+func SaveIcon(data []byte) (string, error) {
+	return saveIcon(config.Cfg.GormDB, data)
+}
+
+func saveIcon(db *gorm.DB, data []byte) (string, error) {
+	contentType, data, err := library.NormalizeIcon(data)
+	if err != nil {
+		return "", err
+	}
+
+	icon := models.Icon{
+		Hash:        library.IconHash(data),
+		ContentType: contentType,
+		Data:        data,
+		Size:        len(data),
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&icon)
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	return icon.Hash, nil
+}
+
+// GetIcon retrieves the icon stored under a hash.
+func GetIcon(hash string) (models.Icon, error) {
+	db := config.Cfg.GormDB
+
+	var icon models.Icon
+	result := db.Where("hash = ?", hash).First(&icon)
+	if result.Error == gorm.ErrRecordNotFound {
+		return icon, ErrIconNotFound
+	}
+	if result.Error != nil {
+		return icon, result.Error
+	}
+
+	return icon, nil
+}
+
+// storeIcon moves an inline data URI icon of a bookmark into the icon store and references
+// it by hash. Icons that are not a supported image are dropped.
+func storeIcon(db *gorm.DB, bookmark *models.Bookmark) error {
+	if !strings.HasPrefix(bookmark.Icon, "data:") {
+		return nil
+	}
+	icon := bookmark.Icon
+	bookmark.Icon = ""
+
+	data, err := library.DecodeDataURI(icon)
+	if err == nil {
+		var hash string
+		hash, err = saveIcon(db, data)
+		if err == nil {
+			bookmark.IconHash = hash
+			return nil
+		}
+	}
+	if errors.Is(err, library.ErrInvalidIcon) {
+		log.Printf("storeIcon: dropped icon of %v %v", bookmark.URL, err)
+		return nil
+	}
+	return err
+}
+
+// BackfillIcons moves the inline icons of up to limit bookmarks saved before the icon store
+// existed into the store, and returns how many bookmarks were updated.
+func BackfillIcons(limit int) (int, error) {
+	db := config.Cfg.GormDB
+
+	var bookmarks []models.Bookmark
+	result := db.Select("id", "url", "icon", "icon_hash").
+		Where("icon LIKE 'data:%'").
+		Limit(limit).
+		Find(&bookmarks)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for _, b := range bookmarks {
+		if err := storeIcon(db, &b); err != nil {
+			return 0, err
+		}
+		result := db.Model(&models.Bookmark{}).Where("id = ?", b.ID).UpdateColumns(map[string]interface{}{
+			"icon":      b.Icon,
+			"icon_hash": b.IconHash,
+		})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+	}
+
+	return len(bookmarks), nil
+}
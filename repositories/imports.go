@@ -0,0 +1,379 @@
+package repositories
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/formats"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// Import modes decide what happens to imported bookmarks whose URL is already saved.
+const (
+	// ImportSkipExisting leaves saved bookmarks untouched and skips the imported copy.
+	ImportSkipExisting = "skip"
+	// ImportUpdateExisting overwrites saved bookmarks with the imported attributes.
+	ImportUpdateExisting = "update"
+	// ImportKeepBoth saves the imported copy next to the saved bookmark, marked as a
+	// duplicate of it.
+	ImportKeepBoth = "keep_both"
+	// ImportReplaceFolder makes every imported folder hold exactly the imported bookmarks,
+	// deleting saved bookmarks in those folders that are not part of the import.
+	ImportReplaceFolder = "replace_folder"
+)
+
+// ImportModes lists the supported import modes.
+var ImportModes = []string{ImportSkipExisting, ImportUpdateExisting, ImportKeepBoth, ImportReplaceFolder}
+
+// Actions taken for a single import entry.
+const (
+	ImportActionNew     = "new"
+	ImportActionUpdate  = "update"
+	ImportActionSkip    = "skip"
+	ImportActionInvalid = "invalid"
+	ImportActionDelete  = "delete"
+	ImportActionRestore = "restore"
+)
+
+// importBatchSize is the number of rows inserted per statement.
+const importBatchSize = 200
+
+// ImportOptions control how an import is applied.
+type ImportOptions struct {
+	Mode   string `json:"mode"`
+	DryRun bool   `json:"dry_run"`
+	// Progress, when set, is called as rows are written.
+	Progress func(processed, total int) `json:"-"`
+}
+
+// ImportEntry reports what happened, or would happen, to one bookmark of an import.
+type ImportEntry struct {
+	Line   int    `json:"line,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Folder string `json:"folder,omitempty"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ImportReport summarizes an import.
+type ImportReport struct {
+	Mode        string        `json:"mode"`
+	DryRun      bool          `json:"dry_run"`
+	New         int           `json:"new"`
+	Updated     int           `json:"updated"`
+	Skipped     int           `json:"skipped"`
+	Invalid     int           `json:"invalid"`
+	Deleted     int           `json:"deleted"`
+	Restored    int           `json:"restored"`
+	OperationID string        `json:"operation_id,omitempty"`
+	Entries     []ImportEntry `json:"entries"`
+}
+
+// importPlan holds the changes an import makes to the database.
+type importPlan struct {
+	create  []models.Bookmark
+	update  []models.Bookmark
+	restore []models.Bookmark
+	delete  []string
+}
+
+// IsImportMode reports whether mode is a supported import mode.
+func IsImportMode(mode string) bool {
+	for _, m := range ImportModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportBookmarks applies the parsed contents of a bookmark file for a user.
+//
+// Every bookmark is compared with the user's saved bookmarks by canonical URL and handled according
+// to the import mode. A bookmark that is only in the trash is restored with the imported
+// attributes rather than saved again. The changes are recorded as one operation, so the
+// whole import can be undone. With DryRun set nothing is written and the report describes
+// what the import would do.
+func ImportBookmarks(userID string, result *formats.Result, options ImportOptions) (*ImportReport, error) {
+	db := config.Cfg.GormDB
+
+	if options.Mode == "" {
+		options.Mode = ImportSkipExisting
+	}
+	if !IsImportMode(options.Mode) {
+		return nil, fmt.Errorf("unknown import mode %q", options.Mode)
+	}
+
+	var existing []models.Bookmark
+	if err := db.Where("user_id = ?", userID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	var trashed []models.Bookmark
+	if err := db.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).Find(&trashed).Error; err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Mode: options.Mode, DryRun: options.DryRun, Entries: []ImportEntry{}}
+	plan := planImport(userID, result, existing, trashed, options.Mode, report)
+	if options.DryRun {
+		return report, nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		op, err := beginOperation(tx, userID, models.OperationImport)
+		if err != nil {
+			return err
+		}
+		report.OperationID = op.ID
+		return applyImport(tx, op, result.Folders, plan, options.Progress)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// planImport decides the action for every imported bookmark and fills in the report.
+func planImport(userID string, result *formats.Result, existing, trashed []models.Bookmark, mode string, report *ImportReport) importPlan {
+	var plan importPlan
+
+	for _, w := range result.Warnings {
+		report.add(ImportEntry{Line: w.Line, Name: w.Entry, Action: ImportActionInvalid, Reason: w.Message})
+	}
+
+	saved := map[string]models.Bookmark{}
+	for i, b := range existing {
+		if b.CanonicalURL == "" {
+			existing[i].CanonicalURL = canonicalURL(b.URL)
+		}
+		if _, ok := saved[existing[i].CanonicalURL]; !ok {
+			saved[existing[i].CanonicalURL] = existing[i]
+		}
+	}
+
+	trash := map[string]models.Bookmark{}
+	for _, b := range trashed {
+		if b.CanonicalURL == "" {
+			b.CanonicalURL = canonicalURL(b.URL)
+		}
+		trash[b.CanonicalURL] = b
+	}
+
+	imported := map[string]bool{}
+	importedFolders := map[string]bool{}
+	for _, f := range result.Folders {
+		importedFolders[f.Path] = true
+	}
+
+	for _, b := range result.Bookmarks {
+		entry := ImportEntry{URL: b.URL, Name: b.Name, Folder: b.Folder}
+		b.UserID = userID
+		b.CanonicalURL = canonicalURL(b.URL)
+		importedFolders[b.Folder] = true
+
+		if reason := invalidBookmarkURL(b.URL); reason != "" {
+			entry.Action, entry.Reason = ImportActionInvalid, reason
+			report.add(entry)
+			continue
+		}
+		inFile := imported[b.CanonicalURL]
+		if inFile && mode != ImportKeepBoth {
+			entry.Action, entry.Reason = ImportActionSkip, "duplicate bookmark in file"
+			report.add(entry)
+			continue
+		}
+		imported[b.CanonicalURL] = true
+
+		current, exists := saved[b.CanonicalURL]
+		deleted, inTrash := trash[b.CanonicalURL]
+		switch {
+		case inFile || (exists && mode == ImportKeepBoth):
+			entry.Action, entry.Reason = ImportActionNew, "kept as a duplicate"
+			b.Duplicate = true
+			plan.create = append(plan.create, b)
+		case !exists && inTrash:
+			entry.Action, entry.Reason = ImportActionRestore, "restored from trash"
+			plan.restore = append(plan.restore, mergeImported(deleted, b))
+		case !exists:
+			entry.Action = ImportActionNew
+			plan.create = append(plan.create, b)
+		case mode == ImportSkipExisting:
+			entry.Action, entry.Reason = ImportActionSkip, "bookmark already saved"
+		default:
+			entry.Action = ImportActionUpdate
+			plan.update = append(plan.update, mergeImported(current, b))
+		}
+		report.add(entry)
+	}
+
+	if mode == ImportReplaceFolder {
+		for _, b := range existing {
+			if importedFolders[b.Folder] && !imported[b.CanonicalURL] {
+				plan.delete = append(plan.delete, b.ID)
+				report.add(ImportEntry{URL: b.URL, Name: b.Name, Folder: b.Folder, Action: ImportActionDelete, Reason: "not part of the imported folder"})
+			}
+		}
+	}
+
+	return plan
+}
+
+// applyImport writes the planned changes as part of the operation, reporting progress after
+// every batch of rows.
+func applyImport(tx *gorm.DB, op models.Operation, folders []models.Folder, plan importPlan, progress func(processed, total int)) error {
+	userID := op.UserID
+	total := len(plan.create) + len(plan.update) + len(plan.restore) + len(plan.delete)
+	processed := 0
+	advance := func(n int) {
+		processed += n
+		if progress != nil {
+			progress(processed, total)
+		}
+	}
+
+	for i := range folders {
+		folders[i].UserID = userID
+	}
+	if err := saveFolders(tx, folders); err != nil {
+		return err
+	}
+	// Rules may have filed bookmarks in folders that are not in the file
+	ensured := map[string]bool{}
+	for _, bookmarks := range [][]models.Bookmark{plan.create, plan.update, plan.restore} {
+		for _, b := range bookmarks {
+			if ensured[b.Folder] {
+				continue
+			}
+			ensured[b.Folder] = true
+			if err := ensureFolder(tx, userID, b.Folder); err != nil {
+				return err
+			}
+		}
+	}
+	for start := 0; start < len(plan.create); start += importBatchSize {
+		batch := plan.create[start:minInt(start+importBatchSize, len(plan.create))]
+		for i := range batch {
+			if err := storeIcon(tx, &batch[i]); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		if err := recordCreated(tx, op, batch); err != nil {
+			return err
+		}
+		advance(len(batch))
+	}
+
+	plan.update = append(plan.update, plan.restore...)
+	var updated []string
+	for _, b := range plan.update {
+		updated = append(updated, b.ID)
+	}
+	err := trackChanges(tx, op, updated, func() error {
+		for _, b := range plan.restore {
+			if err := tx.Unscoped().Model(&models.Bookmark{}).Where("id = ? AND user_id = ?", b.ID, userID).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+		}
+		for i, b := range plan.update {
+			if err := storeIcon(tx, &b); err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Bookmark{}).Where("id = ? AND user_id = ?", b.ID, userID).Select(importedColumns).Updates(&b).Error; err != nil {
+				return err
+			}
+			if (i+1)%importBatchSize == 0 || i == len(plan.update)-1 {
+				advance((i % importBatchSize) + 1)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(plan.delete) > 0 {
+		err := trackChanges(tx, op, plan.delete, func() error {
+			return tx.Where("id IN ? AND user_id = ?", plan.delete, userID).Delete(&models.Bookmark{}).Error
+		})
+		if err != nil {
+			return err
+		}
+		advance(len(plan.delete))
+	}
+	return nil
+}
+
+// importedColumns are the columns an import may overwrite on a saved bookmark.
+var importedColumns = []string{"canonical_url", "folder", "add_date", "last_modified", "icon", "icon_hash", "name", "tags", "keyword", "notes"}
+
+// mergeImported copies the imported attributes onto a saved bookmark, keeping saved
+// values the file does not provide.
+func mergeImported(current, imported models.Bookmark) models.Bookmark {
+	current.Folder = imported.Folder
+	if imported.AddDate != 0 {
+		current.AddDate = imported.AddDate
+	}
+	if imported.LastModified != 0 {
+		current.LastModified = imported.LastModified
+	}
+	if imported.Icon != "" {
+		current.Icon = imported.Icon
+	}
+	if imported.Name != "" {
+		current.Name = imported.Name
+	}
+	if imported.Tags != "" {
+		current.Tags = imported.Tags
+	}
+	if imported.Keyword != "" {
+		current.Keyword = imported.Keyword
+	}
+	if imported.Notes != "" {
+		current.Notes = imported.Notes
+	}
+	return current
+}
+
+// invalidBookmarkURL explains why a URL cannot be saved, or returns an empty string.
+func invalidBookmarkURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "URL cannot be parsed"
+	}
+	if u.Scheme == "" {
+		return "URL has no scheme"
+	}
+	return ""
+}
+
+func (r *ImportReport) add(entry ImportEntry) {
+	switch entry.Action {
+	case ImportActionNew:
+		r.New++
+	case ImportActionUpdate:
+		r.Updated++
+	case ImportActionSkip:
+		r.Skipped++
+	case ImportActionInvalid:
+		r.Invalid++
+	case ImportActionDelete:
+		r.Deleted++
+	case ImportActionRestore:
+		r.Restored++
+	}
+	r.Entries = append(r.Entries, entry)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
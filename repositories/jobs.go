@@ -0,0 +1,207 @@
+package repositories
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+)
+
+// jobProgressTTL is how long live job progress is kept in Redis.
+const jobProgressTTL = 24 * time.Hour
+
+// JobLease is how long a running job stays with its worker without the lease being renewed.
+const JobLease = 2 * time.Minute
+
+// SaveJob saves a new job to the database.
+func SaveJob(job *models.Job) error {
+	db := config.Cfg.GormDB
+
+	result := db.Create(job)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// GetJob retrieves a job by its ID.
+func GetJob(jobID string) (models.Job, error) {
+	db := config.Cfg.GormDB
+
+	var job models.Job
+	result := db.Where("id = ?", jobID).First(&job)
+	if result.Error != nil {
+		return job, result.Error
+	}
+
+	return job, nil
+}
+
+// GetUsersJob retrieves a job of a specific user.
+func GetUsersJob(jobID string, userID string) (models.Job, error) {
+	db := config.Cfg.GormDB
+
+	var job models.Job
+	result := db.Where("id = ? AND user_id = ?", jobID, userID).First(&job)
+	if result.Error != nil {
+		return job, result.Error
+	}
+
+	return job, nil
+}
+
+// GetUsersJobs retrieves the jobs of a specific user and kind, newest first.
+func GetUsersJobs(userID string, kind string) ([]models.Job, error) {
+	db := config.Cfg.GormDB
+
+	var jobs []models.Job
+	result := db.Where("user_id = ? AND kind = ?", userID, kind).Order("created_at DESC").Find(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return jobs, nil
+}
+
+// ClaimJob marks a queued job as running. It returns false when the job is not queued,
+// for example because another worker claimed it first.
+func ClaimJob(jobID string) (bool, error) {
+	db := config.Cfg.GormDB
+
+	now := time.Now()
+	result := db.Model(&models.Job{}).
+		Where("id = ? AND status = ?", jobID, models.JobQueued).
+		Updates(map[string]interface{}{"status": models.JobRunning, "started_at": &now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// FinishJob stores the outcome of a job and releases its lease.
+func FinishJob(job *models.Job) error {
+	db := config.Cfg.GormDB
+
+	now := time.Now()
+	job.FinishedAt = &now
+	result := db.Model(job).Select("status", "result", "error", "processed", "total", "finished_at").Updates(job)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return config.Cfg.RedisClient.Del(jobLeaseKey(job.ID)).Err()
+}
+
+// RenewJobLease keeps a running job with its worker for another JobLease.
+//
+// Like progress, the lease is kept in Redis because the job writes its rows inside a single
+// transaction, which would hold up renewing it in the database.
+func RenewJobLease(jobID string) error {
+	return config.Cfg.RedisClient.Set(jobLeaseKey(jobID), 1, JobLease).Err()
+}
+
+// GetQueuedJobIDs retrieves the IDs of the queued jobs of a kind, oldest first.
+func GetQueuedJobIDs(kind string) ([]string, error) {
+	db := config.Cfg.GormDB
+
+	var ids []string
+	result := db.Model(&models.Job{}).Where("kind = ? AND status = ?", kind, models.JobQueued).Order("created_at").Pluck("id", &ids)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return ids, nil
+}
+
+// RequeueInterruptedJobs puts running jobs of a kind whose lease expired, because their
+// worker stopped, back in the queued state and returns their IDs. Jobs that started less
+// than JobLease ago are left to take out their lease.
+//
+// Queued jobs that no worker took for JobLease are returned as well, as their ID may have
+// been lost from the queue. Their updated_at is touched, so they are returned again only
+// once they waited another JobLease.
+func RequeueInterruptedJobs(kind string) ([]string, error) {
+	db := config.Cfg.GormDB
+
+	cutoff := time.Now().Add(-JobLease)
+	var running []string
+	result := db.Model(&models.Job{}).
+		Where("kind = ? AND status = ? AND (started_at IS NULL OR started_at < ?)", kind, models.JobRunning, cutoff).
+		Pluck("id", &running)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	var stale []string
+	result = db.Model(&models.Job{}).
+		Where("kind = ? AND status = ? AND updated_at < ?", kind, models.JobQueued, cutoff).
+		Order("created_at").
+		Pluck("id", &stale)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var ids []string
+	for _, id := range running {
+		leased, err := config.Cfg.RedisClient.Exists(jobLeaseKey(id)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if leased > 0 {
+			continue
+		}
+		result := db.Model(&models.Job{}).Where("id = ? AND status = ?", id, models.JobRunning).Update("status", models.JobQueued)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range stale {
+		result := db.Model(&models.Job{}).Where("id = ? AND status = ?", id, models.JobQueued).Update("updated_at", time.Now())
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// SetJobProgress records the live progress of a running job in Redis.
+//
+// Progress is kept out of the database because the job writes its rows inside a single
+// transaction, which would block other writers until it commits.
+func SetJobProgress(jobID string, processed, total int) error {
+	key := jobProgressKey(jobID)
+	pipe := config.Cfg.RedisClient.TxPipeline()
+	pipe.HSet(key, "processed", processed, "total", total)
+	pipe.Expire(key, jobProgressTTL)
+	_, err := pipe.Exec()
+	return err
+}
+
+// GetJobProgress returns the live progress of a running job, if any was recorded.
+func GetJobProgress(jobID string) (processed, total int, ok bool) {
+	values, err := config.Cfg.RedisClient.HGetAll(jobProgressKey(jobID)).Result()
+	if err != nil || len(values) == 0 {
+		return 0, 0, false
+	}
+	processed, _ = strconv.Atoi(values["processed"])
+	total, _ = strconv.Atoi(values["total"])
+	return processed, total, true
+}
+
+func jobProgressKey(jobID string) string {
+	return fmt.Sprintf("job:%v:progress", jobID)
+}
+
+func jobLeaseKey(jobID string) string {
+	return fmt.Sprintf("job:%v:lease", jobID)
+}
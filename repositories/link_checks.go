@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// GetBookmarksToCheck retrieves up to limit web bookmarks whose link was never checked or
+// was last checked before the given time, least recently checked first.
+func GetBookmarksToCheck(checkedBefore time.Time, limit int) ([]models.Bookmark, error) {
+	db := config.Cfg.GormDB
+
+	var bookmarks []models.Bookmark
+	result := db.Select("id", "user_id", "url").
+		Where("last_checked_at IS NULL OR last_checked_at < ?", checkedBefore).
+		Where("url LIKE 'http://%' OR url LIKE 'https://%'").
+		Order("last_checked_at IS NOT NULL, last_checked_at").
+		Limit(limit).
+		Find(&bookmarks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return bookmarks, nil
+}
+
+// SaveLinkCheck records the result of a link check on a bookmark.
+//
+// Consecutive failures are counted until the link works again. When updateRedirect is set
+// and every redirect was permanent, the bookmark URL is replaced with the final URL, unless
+// the user already saved that URL in another bookmark. Replacing the URL is recorded as an
+// operation of the bookmark owner, so it can be undone.
+func SaveLinkCheck(bookmark models.Bookmark, check library.LinkCheck, updateRedirect bool) error {
+	db := config.Cfg.GormDB
+
+	updates := map[string]interface{}{
+		"http_status":        check.Status,
+		"final_url":          check.FinalURL,
+		"permanent_redirect": check.Permanent,
+		"last_checked_at":    time.Now(),
+		"check_failures":     0,
+	}
+	if check.Broken() {
+		updates["check_failures"] = gorm.Expr("check_failures + 1")
+	}
+	save := func(tx *gorm.DB) error {
+		return tx.Model(&models.Bookmark{}).Where("id = ?", bookmark.ID).UpdateColumns(updates).Error
+	}
+	if check.Broken() || !updateRedirect || !check.Redirected() || !check.Permanent {
+		return save(db)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := checkURLNotSaved(tx, bookmark.ID, canonicalURL(check.FinalURL))
+		if errors.Is(err, ErrBookmarkExists) {
+			return save(tx)
+		}
+		if err != nil {
+			return err
+		}
+
+		updates["url"] = check.FinalURL
+		updates["canonical_url"] = canonicalURL(check.FinalURL)
+		updates["final_url"] = ""
+		updates["permanent_redirect"] = false
+		op, err := beginOperation(tx, bookmark.UserID, models.OperationRedirects)
+		if err != nil {
+			return err
+		}
+		return trackChanges(tx, op, []string{bookmark.ID}, func() error {
+			return save(tx)
+		})
+	})
+}
+
+// ApplyPermanentRedirects replaces the URL of a user's bookmarks that permanently redirect
+// with the URL they redirect to, and returns how many bookmarks were updated. Bookmarks
+// redirecting to a URL saved in another bookmark are left as they are.
+func ApplyPermanentRedirects(userID string) (int, error) {
+	db := config.Cfg.GormDB
+
+	var bookmarks []models.Bookmark
+	result := db.Scopes(IsRedirected()).Where("user_id = ? AND permanent_redirect", userID).Find(&bookmarks)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	ids := make([]string, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		ids = append(ids, b.ID)
+	}
+	updated := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		op, err := beginOperation(tx, userID, models.OperationRedirects)
+		if err != nil {
+			return err
+		}
+		return trackChanges(tx, op, ids, func() error {
+			for _, b := range bookmarks {
+				err := checkURLNotSaved(tx, b.ID, canonicalURL(b.FinalURL))
+				if errors.Is(err, ErrBookmarkExists) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				result := tx.Model(&models.Bookmark{}).Where("id = ? AND user_id = ?", b.ID, userID).Updates(map[string]interface{}{
+					"url":                b.FinalURL,
+					"canonical_url":      canonicalURL(b.FinalURL),
+					"final_url":          "",
+					"permanent_redirect": false,
+				})
+				if result.Error != nil {
+					return result.Error
+				}
+				updated++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// Conditions on the link status of bookmarks.
+const (
+	brokenCondition     = "check_failures > 0"
+	redirectedCondition = "(final_url <> '' AND check_failures = 0)"
+)
+
+// IsBroken limits a bookmark query to bookmarks whose last link check failed.
+func IsBroken() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(brokenCondition)
+	}
+}
+
+// IsRedirected limits a bookmark query to bookmarks whose link redirects elsewhere.
+func IsRedirected() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(redirectedCondition)
+	}
+}
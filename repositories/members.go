@@ -0,0 +1,435 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrFolderNotFound is returned when a folder does not exist or is not shared with the user.
+	ErrFolderNotFound = errors.New("folder not found")
+	// ErrPermissionDenied is returned when a user's role does not allow a change.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrInvitationNotFound is returned when an invitation does not exist, is addressed to
+	// another user or was already answered.
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrMemberNotFound is returned when a user is not a member of a folder.
+	ErrMemberNotFound = errors.New("member not found")
+)
+
+// AccessibleBy limits a bookmark query to the bookmarks a user has at least the given role
+// in: their own, and those in folders of other users they are a member of, including
+// subfolders.
+func AccessibleBy(userID string, role string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`(bookmarks.user_id = ? OR EXISTS (
+			SELECT 1 FROM folder_members m JOIN folders f ON f.id = m.folder_id
+			WHERE m.user_id = ? AND m.role IN ? AND f.user_id = bookmarks.user_id AND f.deleted_at IS NULL
+			AND (bookmarks.folder = f.path OR substr(bookmarks.folder, 1, length(f.path) + 1) = f.path || ?)))`,
+			userID, userID, models.RolesAtLeast(role), models.FolderSeparator)
+	}
+}
+
+// CanEditBookmark reports whether a user may change a bookmark, because it is theirs or it
+// is in a folder they are an editor of. Deleted bookmarks are included.
+func CanEditBookmark(bookmarkID string, userID string) (bool, error) {
+	return canEditBookmark(config.Cfg.GormDB, bookmarkID, userID)
+}
+
+func canEditBookmark(db *gorm.DB, bookmarkID string, userID string) (bool, error) {
+	var count int64
+	err := db.Unscoped().Model(&models.Bookmark{}).
+		Scopes(AccessibleBy(userID, models.RoleEditor)).
+		Where("id = ?", bookmarkID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// canEditFolder reports whether a user may change the bookmarks of an owner in the folder at
+// path: those of their own, or in a folder of the owner they are an editor of.
+func canEditFolder(db *gorm.DB, userID string, ownerID string, path string) (bool, error) {
+	if userID == ownerID {
+		return true, nil
+	}
+	memberships, err := usersMemberships(db, userID, ownerID)
+	if err != nil {
+		return false, err
+	}
+	return editsFolder(memberships, ownerID, path), nil
+}
+
+// editsFolder reports whether one of the memberships makes its user an editor of the folder
+// of an owner at path.
+func editsFolder(memberships []membership, ownerID string, path string) bool {
+	for _, m := range memberships {
+		if m.OwnerID == ownerID && models.HasRole(m.Role, models.RoleEditor) && folderContains(m.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetFolderRole retrieves a folder with the role a user has in it: owner of their own
+// folders, or the highest role of their memberships of the folder and its parents.
+// ErrFolderNotFound is returned when the user has no role in the folder.
+func GetFolderRole(folderID string, userID string) (models.Folder, error) {
+	db := config.Cfg.GormDB
+
+	var folder models.Folder
+	result := db.Where("id = ?", folderID).First(&folder)
+	if result.Error == gorm.ErrRecordNotFound {
+		return folder, ErrFolderNotFound
+	}
+	if result.Error != nil {
+		return folder, result.Error
+	}
+	if folder.UserID == userID {
+		folder.Role = models.RoleOwner
+		return folder, nil
+	}
+
+	memberships, err := usersMemberships(db, userID, folder.UserID)
+	if err != nil {
+		return folder, err
+	}
+	for _, m := range memberships {
+		if folderContains(m.Path, folder.Path) && !models.HasRole(folder.Role, m.Role) {
+			folder.Role = m.Role
+		}
+	}
+	if folder.Role == "" {
+		return folder, ErrFolderNotFound
+	}
+
+	return folder, nil
+}
+
+// GetUsersFolderTree retrieves the folders of a user together with the folders other users
+// share with them and their subfolders, each with the user's role in it.
+func GetUsersFolderTree(userID string) ([]models.Folder, error) {
+	db := config.Cfg.GormDB
+
+	var folders []models.Folder
+	result := db.Where("user_id = ?", userID).Order(models.FolderSortExpression("path")).Find(&folders)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for i := range folders {
+		folders[i].Role = models.RoleOwner
+	}
+
+	memberships, err := usersMemberships(db, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	shared := map[string]int{}
+	for _, m := range memberships {
+		var subfolders []models.Folder
+		err := db.Scopes(FolderWithin(m.Path)).
+			Where("user_id = ?", m.OwnerID).
+			Order(models.FolderSortExpression("path")).
+			Find(&subfolders).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range subfolders {
+			// Nested memberships give the highest of their roles
+			if i, ok := shared[f.ID]; ok {
+				if !models.HasRole(folders[i].Role, m.Role) {
+					folders[i].Role = m.Role
+				}
+				continue
+			}
+			f.Role = m.Role
+			shared[f.ID] = len(folders)
+			folders = append(folders, f)
+		}
+	}
+
+	return folders, nil
+}
+
+// membership is a folder a user is a member of.
+type membership struct {
+	FolderID string
+	OwnerID  string
+	Path     string
+	Role     string
+}
+
+// usersMemberships loads the folders a user is a member of, limited to the folders of one
+// owner unless ownerID is empty.
+func usersMemberships(db *gorm.DB, userID string, ownerID string) ([]membership, error) {
+	query := db.Table("folder_members m").
+		Select("m.folder_id, f.user_id AS owner_id, f.path, m.role").
+		Joins("JOIN folders f ON f.id = m.folder_id AND f.deleted_at IS NULL").
+		Where("m.user_id = ?", userID)
+	if ownerID != "" {
+		query = query.Where("f.user_id = ?", ownerID)
+	}
+
+	var memberships []membership
+	if err := query.Order("f.user_id, f.path").Scan(&memberships).Error; err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// folderContains reports whether path is the folder parent or one of its subfolders.
+func folderContains(parent string, path string) bool {
+	return path == parent || strings.HasPrefix(path, parent+models.FolderSeparator)
+}
+
+// GetFolderMembers retrieves the members of a folder with their email addresses, the owner
+// of the folder first.
+func GetFolderMembers(folder models.Folder) ([]models.FolderMember, error) {
+	db := config.Cfg.GormDB
+
+	var owner models.User
+	if err := db.Where("id = ?", folder.UserID).First(&owner).Error; err != nil {
+		return nil, err
+	}
+	members := []models.FolderMember{{
+		FolderID:  folder.ID,
+		UserID:    owner.ID,
+		Role:      models.RoleOwner,
+		Email:     owner.Email,
+		CreatedAt: folder.CreatedAt,
+		UpdatedAt: folder.UpdatedAt,
+	}}
+
+	var shared []models.FolderMember
+	result := db.Table("folder_members").
+		Select("folder_members.*, users.email").
+		Joins("JOIN users ON users.id = folder_members.user_id").
+		Where("folder_members.folder_id = ?", folder.ID).
+		Order("folder_members.created_at").
+		Find(&shared)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return append(members, shared...), nil
+}
+
+// InviteToFolder invites the user with an email address to a folder with a role. Inviting
+// the same address again while the invitation is pending changes its role.
+func InviteToFolder(folder models.Folder, invitedBy string, email string, role string) (models.FolderInvitation, error) {
+	db := config.Cfg.GormDB
+
+	invitation := models.FolderInvitation{
+		FolderID:   folder.ID,
+		Email:      strings.ToLower(strings.TrimSpace(email)),
+		Role:       role,
+		Status:     models.InvitationPending,
+		InvitedBy:  invitedBy,
+		FolderPath: folder.Path,
+	}
+	if !models.HasRole(role, models.RoleViewer) {
+		return invitation, fmt.Errorf("unknown role %q", role)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var pending models.FolderInvitation
+		err := tx.Where("folder_id = ? AND lower(email) = ? AND status = ?", folder.ID, invitation.Email, models.InvitationPending).
+			First(&pending).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&invitation).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		invitation.ID = pending.ID
+		invitation.CreatedAt = pending.CreatedAt
+		return tx.Model(&pending).Updates(map[string]interface{}{"role": role, "invited_by": invitedBy}).Error
+	})
+	if err != nil {
+		return invitation, err
+	}
+
+	return invitation, nil
+}
+
+// GetUsersInvitations retrieves the pending invitations addressed to the email address of
+// a user, newest first.
+func GetUsersInvitations(userID string) ([]models.FolderInvitation, error) {
+	db := config.Cfg.GormDB
+
+	var user models.User
+	if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	var invitations []models.FolderInvitation
+	result := db.Table("folder_invitations").
+		Select("folder_invitations.*, folders.path AS folder_path").
+		Joins("JOIN folders ON folders.id = folder_invitations.folder_id AND folders.deleted_at IS NULL").
+		Where("lower(folder_invitations.email) = lower(?) AND folder_invitations.status = ?", user.Email, models.InvitationPending).
+		Order("folder_invitations.created_at DESC").
+		Find(&invitations)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return invitations, nil
+}
+
+// RespondToInvitation accepts or declines a pending invitation addressed to the email
+// address of a user. Accepting makes the user a member of the folder with the invited role,
+// replacing the role of an existing membership.
+func RespondToInvitation(invitationID string, userID string, accept bool) (models.FolderInvitation, error) {
+	db := config.Cfg.GormDB
+
+	var invitation models.FolderInvitation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		err := tx.Where("id = ? AND lower(email) = lower(?) AND status = ?", invitationID, user.Email, models.InvitationPending).
+			First(&invitation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvitationNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var folder models.Folder
+		err = tx.Where("id = ?", invitation.FolderID).First(&folder).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvitationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		invitation.FolderPath = folder.Path
+
+		now := time.Now()
+		invitation.Status = models.InvitationDeclined
+		if accept {
+			invitation.Status = models.InvitationAccepted
+		}
+		invitation.RespondedAt = &now
+		err = tx.Model(&invitation).Updates(map[string]interface{}{"status": invitation.Status, "responded_at": now}).Error
+		if err != nil {
+			return err
+		}
+		// Owners already have every role in their own folders
+		if !accept || folder.UserID == userID {
+			return nil
+		}
+
+		member := models.FolderMember{
+			FolderID:  folder.ID,
+			UserID:    userID,
+			Role:      invitation.Role,
+			InvitedBy: invitation.InvitedBy,
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "folder_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role", "invited_by", "updated_at"}),
+		}).Create(&member).Error
+	})
+	if err != nil {
+		return invitation, err
+	}
+
+	return invitation, nil
+}
+
+// SetMemberRole changes the role of a member of a folder.
+func SetMemberRole(folderID string, memberID string, role string) error {
+	db := config.Cfg.GormDB
+
+	if !models.HasRole(role, models.RoleViewer) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	result := db.Model(&models.FolderMember{}).
+		Where("folder_id = ? AND user_id = ?", folderID, memberID).
+		Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+
+	return nil
+}
+
+// RemoveMember removes a member from a folder.
+func RemoveMember(folderID string, memberID string) error {
+	db := config.Cfg.GormDB
+
+	result := db.Where("folder_id = ? AND user_id = ?", folderID, memberID).Delete(&models.FolderMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+
+	return nil
+}
+
+// SaveFolderBookmark creates a bookmark in a folder on behalf of a member of the folder. The
+// bookmark belongs to the owner of the folder; its folder defaults to the folder itself and
+// must be within it. The owner's rules only file the bookmarks the owner creates, so those
+// of other members stay where they put them. When the owner already saved the URL,
+// ErrBookmarkExists is returned.
+func SaveFolderBookmark(folder models.Folder, memberID string, bookmark *models.Bookmark) error {
+	db := config.Cfg.GormDB
+
+	if bookmark.Folder == "" {
+		bookmark.Folder = folder.Path
+	}
+	if !folderContains(folder.Path, bookmark.Folder) {
+		return ErrPermissionDenied
+	}
+	bookmark.UserID = folder.UserID
+	bookmark.CanonicalURL = canonicalURL(bookmark.URL)
+	if err := storeIcon(db, bookmark); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		op, err := beginOperation(tx, memberID, models.OperationCreate)
+		if err != nil {
+			return err
+		}
+		if memberID == folder.UserID {
+			if err := applyRules(tx, folder.UserID, bookmark); err != nil {
+				return err
+			}
+		}
+		saved, err := savedBookmarkID(tx, folder.UserID, bookmark.CanonicalURL, "")
+		if err != nil {
+			return err
+		}
+		if saved != "" {
+			return ErrBookmarkExists
+		}
+		// Only imports keep duplicates
+		bookmark.Duplicate = false
+		if err := ensureFolder(tx, folder.UserID, bookmark.Folder); err != nil {
+			return err
+		}
+		if err := tx.Create(bookmark).Error; err != nil {
+			return err
+		}
+		return recordCreated(tx, op, []models.Bookmark{*bookmark})
+	})
+}
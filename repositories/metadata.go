@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// GetBookmarksWithoutMetadata retrieves up to limit web bookmarks whose page metadata
+// was never fetched, oldest first.
+func GetBookmarksWithoutMetadata(limit int) ([]models.Bookmark, error) {
+	db := config.Cfg.GormDB
+
+	var bookmarks []models.Bookmark
+	result := db.Where("metadata_fetched_at IS NULL").
+		Where("url LIKE 'http://%' OR url LIKE 'https://%'").
+		Order("created_at").
+		Limit(limit).
+		Find(&bookmarks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return bookmarks, nil
+}
+
+// GetUsersBookmark retrieves a single bookmark a user can see, their own or one in a folder
+// shared with them, with its visit statistics.
+func GetUsersBookmark(bookmarkID string, userID string) (models.Bookmark, error) {
+	db := config.Cfg.GormDB
+
+	var bookmark models.Bookmark
+	result := db.Scopes(WithVisits(), AccessibleBy(userID, models.RoleViewer)).Where("bookmarks.id = ?", bookmarkID).First(&bookmark)
+	if result.Error == gorm.ErrRecordNotFound {
+		return bookmark, ErrBookmarkNotFound
+	}
+	if result.Error != nil {
+		return bookmark, result.Error
+	}
+
+	return bookmark, nil
+}
+
+// SaveBookmarkMetadata fills in a bookmark from the metadata fetched from its page and
+// returns the updated bookmark. A nil meta only records that the fetch was attempted.
+// iconHash is the stored favicon of the page, used when the bookmark has no icon yet.
+//
+// A field is only set when it is empty or still holds the value fetched last time, so
+// names and descriptions edited by the user are kept.
+func SaveBookmarkMetadata(bookmark models.Bookmark, meta *library.PageMetadata, iconHash string) (models.Bookmark, error) {
+	db := config.Cfg.GormDB
+
+	now := time.Now()
+	updates := map[string]interface{}{"metadata_fetched_at": now}
+	bookmark.MetadataFetchedAt = &now
+
+	if meta != nil {
+		var previous library.PageMetadata
+		if bookmark.Metadata != "" {
+			// Unreadable previous values only mean nothing is treated as fetched
+			_ = json.Unmarshal([]byte(bookmark.Metadata), &previous)
+		}
+		fill := func(column string, current *string, fetched, previousFetched string) {
+			if fetched == "" || fetched == *current {
+				return
+			}
+			if *current == "" || *current == previousFetched {
+				*current = fetched
+				updates[column] = fetched
+			}
+		}
+		fill("name", &bookmark.Name, meta.Title, previous.Title)
+		fill("description", &bookmark.Description, meta.Description, previous.Description)
+		fill("image", &bookmark.Image, meta.Image, previous.Image)
+		fill("lang", &bookmark.Lang, meta.Language, previous.Language)
+
+		encoded, err := json.Marshal(meta)
+		if err != nil {
+			return bookmark, err
+		}
+		bookmark.Metadata = string(encoded)
+		updates["metadata"] = bookmark.Metadata
+	}
+
+	if iconHash != "" && bookmark.IconHash == "" {
+		bookmark.IconHash = iconHash
+		updates["icon_hash"] = iconHash
+	}
+
+	save := func(tx *gorm.DB) error {
+		return tx.Model(&models.Bookmark{}).Where("id = ?", bookmark.ID).UpdateColumns(updates).Error
+	}
+	_, name := updates["name"]
+	_, description := updates["description"]
+	_, icon := updates["icon_hash"]
+	if !name && !description && !icon {
+		return bookmark, save(db)
+	}
+
+	// Filling in fields the user can edit is recorded as an operation of the owner, so it
+	// can be undone
+	err := db.Transaction(func(tx *gorm.DB) error {
+		op, err := beginOperation(tx, bookmark.UserID, models.OperationMetadata)
+		if err != nil {
+			return err
+		}
+		return trackChanges(tx, op, []string{bookmark.ID}, func() error {
+			return save(tx)
+		})
+	})
+	if err != nil {
+		return bookmark, err
+	}
+
+	return bookmark, nil
+}
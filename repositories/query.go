@@ -0,0 +1,250 @@
+package repositories
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// searchCondition is a SQL condition on bookmarks with the parameters of its placeholders.
+type searchCondition struct {
+	SQL  string
+	Args []interface{}
+}
+
+// scope limits a bookmark query to the bookmarks meeting the condition.
+func (c searchCondition) scope() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(c.SQL, c.Args...)
+	}
+}
+
+// SearchScope compiles a search query into a scope limiting a bookmark query to the bookmarks
+// it matches. The syntax is that of library.ParseQuery; words and phrases are searched for
+// as in Matching, and the fields are
+//
+//	tag:{tag}          bookmarks with the tag
+//	folder:{path}      bookmarks in the folder or its subfolders
+//	site:{host}        bookmarks on the host or its subdomains
+//	is:{state}         bookmarks that are broken, redirected, unread, read or archived
+//	added:{date}       bookmarks added on a date such as 2023-01-01, or before or after it
+//	                   with <, <=, > or >= in front, or in the last n days, weeks, months
+//	                   or years with last-{n}d, last-{n}w, last-{n}m or last-{n}y
+//
+// For example: tag:go -tag:old (site:github.com OR site:golang.org) added:>2023-01-01.
+// Queries that cannot be understood return a *library.QueryError.
+func SearchScope(query string) (func(*gorm.DB) *gorm.DB, error) {
+	node, err := library.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+	condition, err := compileQuery(node)
+	if err != nil {
+		return nil, err
+	}
+	return condition.scope(), nil
+}
+
+// compileQuery turns the syntax tree of a search query into a condition. Every value ends up
+// in a placeholder parameter.
+func compileQuery(node library.QueryNode) (searchCondition, error) {
+	switch n := node.(type) {
+	case *library.QueryAnd:
+		return joinConditions(n.Terms, " AND ")
+	case *library.QueryOr:
+		return joinConditions(n.Terms, " OR ")
+	case *library.QueryNot:
+		term, err := compileQuery(n.Term)
+		if err != nil {
+			return term, err
+		}
+		// Conditions on NULL columns are neither true nor false, so they count as not matching
+		return searchCondition{SQL: "COALESCE(" + term.SQL + ", 0) = 0", Args: term.Args}, nil
+	case *library.QueryText:
+		return textCondition(n.Text), nil
+	case *library.QueryField:
+		return compileField(n)
+	}
+	return searchCondition{}, &library.QueryError{Position: node.Pos(), Message: "unsupported search term"}
+}
+
+// joinConditions compiles terms and joins them with a logical operator.
+func joinConditions(terms []library.QueryNode, operator string) (searchCondition, error) {
+	parts := make([]string, 0, len(terms))
+	var args []interface{}
+	for _, term := range terms {
+		condition, err := compileQuery(term)
+		if err != nil {
+			return condition, err
+		}
+		parts = append(parts, condition.SQL)
+		args = append(args, condition.Args...)
+	}
+	return searchCondition{SQL: "(" + strings.Join(parts, operator) + ")", Args: args}, nil
+}
+
+// searchStates are the values of is: terms.
+var searchStates = map[string]searchCondition{
+	"broken":                 {SQL: brokenCondition},
+	"redirected":             {SQL: redirectedCondition},
+	models.ReadStateUnread:   readStateCondition(models.ReadStateUnread),
+	models.ReadStateRead:     readStateCondition(models.ReadStateRead),
+	models.ReadStateArchived: readStateCondition(models.ReadStateArchived),
+}
+
+// compileField compiles a field term into a condition.
+func compileField(field *library.QueryField) (searchCondition, error) {
+	switch strings.ToLower(field.Name) {
+	case "tag":
+		return tagCondition(field.Value), nil
+	case "folder":
+		return folderCondition(field.Value), nil
+	case "site":
+		return siteCondition(field.Value), nil
+	case "is":
+		condition, ok := searchStates[strings.ToLower(field.Value)]
+		if !ok {
+			return condition, &library.QueryError{
+				Position: field.ValuePosition,
+				Message:  fmt.Sprintf("is:%v is unknown, expected broken, redirected, %v", field.Value, strings.Join(models.ReadStates, ", ")),
+			}
+		}
+		return condition, nil
+	case "added":
+		return addedCondition(field)
+	}
+	return searchCondition{}, &library.QueryError{
+		Position: field.Position,
+		Message:  fmt.Sprintf("unknown field %v:, expected tag:, folder:, site:, is: or added:", field.Name),
+	}
+}
+
+// Dates of added: terms.
+var (
+	addedWithinPattern = regexp.MustCompile(`^last-(\d+)([dwmy])$`)
+	addedDatePattern   = regexp.MustCompile(`^(<=|>=|<|>|=)?(\d{4}-\d{2}-\d{2})$`)
+)
+
+// addedCondition compiles an added: term into a condition on the add date of bookmarks.
+func addedCondition(field *library.QueryField) (searchCondition, error) {
+	if match := addedWithinPattern.FindStringSubmatch(field.Value); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err == nil {
+			since := time.Now()
+			switch match[2] {
+			case "d":
+				since = since.AddDate(0, 0, -n)
+			case "w":
+				since = since.AddDate(0, 0, -7*n)
+			case "m":
+				since = since.AddDate(0, -n, 0)
+			case "y":
+				since = since.AddDate(-n, 0, 0)
+			}
+			return addedCompare(">=", since), nil
+		}
+	}
+
+	match := addedDatePattern.FindStringSubmatch(field.Value)
+	if match == nil {
+		return searchCondition{}, &library.QueryError{
+			Position: field.ValuePosition,
+			Message:  fmt.Sprintf("added:%v is not a date, expected one such as 2023-01-01, >2023-01-01 or last-30d", field.Value),
+		}
+	}
+	day, err := time.Parse("2006-01-02", match[2])
+	if err != nil {
+		return searchCondition{}, &library.QueryError{
+			Position: field.ValuePosition + len(match[1]),
+			Message:  fmt.Sprintf("%v is not a valid date", match[2]),
+		}
+	}
+	next := day.AddDate(0, 0, 1)
+	switch match[1] {
+	case ">":
+		return addedCompare(">=", next), nil
+	case ">=":
+		return addedCompare(">=", day), nil
+	case "<":
+		return addedCompare("<", day), nil
+	case "<=":
+		return addedCompare("<", next), nil
+	}
+	from, to := addedCompare(">=", day), addedCompare("<", next)
+	return searchCondition{SQL: "(" + from.SQL + " AND " + to.SQL + ")", Args: append(from.Args, to.Args...)}, nil
+}
+
+// addedCompare compares the add date of bookmarks with a time, where operator is one of
+// <, <=, > and >=. Bookmarks without an add date count as added when they were created.
+func addedCompare(operator string, t time.Time) searchCondition {
+	return searchCondition{
+		SQL:  fmt.Sprintf("(CASE WHEN COALESCE(bookmarks.add_date, 0) <> 0 THEN bookmarks.add_date %[1]s ? ELSE bookmarks.created_at %[1]s ? END)", operator),
+		Args: []interface{}{t.Unix(), t},
+	}
+}
+
+// textCondition matches bookmarks whose name, URL, description, notes, tags or keyword
+// contain the text.
+func textCondition(text string) searchCondition {
+	pattern := "%" + escapeLike(text) + "%"
+	return searchCondition{
+		SQL:  "(name LIKE ? ESCAPE '\\' OR url LIKE ? ESCAPE '\\' OR description LIKE ? ESCAPE '\\' OR notes LIKE ? ESCAPE '\\' OR tags LIKE ? ESCAPE '\\' OR keyword LIKE ? ESCAPE '\\')",
+		Args: []interface{}{pattern, pattern, pattern, pattern, pattern, pattern},
+	}
+}
+
+// tagCondition matches bookmarks carrying the tag.
+func tagCondition(tag string) searchCondition {
+	return searchCondition{
+		SQL:  "(',' || tags || ',') LIKE ? ESCAPE '\\'",
+		Args: []interface{}{"%," + escapeLike(tag) + ",%"},
+	}
+}
+
+// folderCondition matches bookmarks in the folder or its subfolders.
+func folderCondition(folder string) searchCondition {
+	return searchCondition{
+		SQL:  "(folder = ? OR folder LIKE ? ESCAPE '\\')",
+		Args: []interface{}{folder, escapeLike(folder+models.FolderSeparator) + "%"},
+	}
+}
+
+// bookmarkHost is the SQL expression for the lower-cased host of a bookmark URL.
+var bookmarkHost = func() string {
+	rest := "substr(bookmarks.url, instr(bookmarks.url, '://') + 3)"
+	return fmt.Sprintf("lower(CASE WHEN instr(%[1]s, '/') > 0 THEN substr(%[1]s, 1, instr(%[1]s, '/') - 1) ELSE %[1]s END)", rest)
+}()
+
+// siteCondition matches bookmarks whose URL is on the host or its subdomains.
+func siteCondition(host string) searchCondition {
+	host = strings.ToLower(host)
+	return searchCondition{
+		SQL:  "(" + bookmarkHost + " = ? OR " + bookmarkHost + " LIKE ? ESCAPE '\\')",
+		Args: []interface{}{host, "%." + escapeLike(host)},
+	}
+}
+
+// readStateCondition matches bookmarks in the read state.
+func readStateCondition(state string) searchCondition {
+	return searchCondition{SQL: "bookmarks.read_state = ?", Args: []interface{}{state}}
+}
+
+// OnSite limits a bookmark query to bookmarks whose URL is on a host or its subdomains.
+func OnSite(host string) func(*gorm.DB) *gorm.DB {
+	return siteCondition(host).scope()
+}
+
+// AddedSince limits a bookmark query to bookmarks added at or after a time. Bookmarks without
+// an add date count as added when they were created.
+func AddedSince(since time.Time) func(*gorm.DB) *gorm.DB {
+	return addedCompare(">=", since).scope()
+}
@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jasonbronson/kwikportal-api/library"
+)
+
+func compileTestQuery(t *testing.T, query string) (searchCondition, error) {
+	t.Helper()
+	node, err := library.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	return compileQuery(node)
+}
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		sql   string
+		args  []interface{}
+	}{
+		{"tag:go", "(',' || tags || ',') LIKE ? ESCAPE '\\'", []interface{}{"%,go,%"}},
+		{"tag:100%_off", "(',' || tags || ',') LIKE ? ESCAPE '\\'", []interface{}{`%,100\%\_off,%`}},
+		{"folder:Work", "(folder = ? OR folder LIKE ? ESCAPE '\\')", []interface{}{"Work", "Work/%"}},
+		{"is:broken", brokenCondition, nil},
+		{"is:UNREAD", "bookmarks.read_state = ?", []interface{}{"unread"}},
+		{"-tag:old", "COALESCE((',' || tags || ',') LIKE ? ESCAPE '\\', 0) = 0", []interface{}{"%,old,%"}},
+		{"tag:a tag:b", "((',' || tags || ',') LIKE ? ESCAPE '\\' AND (',' || tags || ',') LIKE ? ESCAPE '\\')", []interface{}{"%,a,%", "%,b,%"}},
+		{"tag:a OR is:read", "((',' || tags || ',') LIKE ? ESCAPE '\\' OR bookmarks.read_state = ?)", []interface{}{"%,a,%", "read"}},
+	}
+	for _, tt := range tests {
+		condition, err := compileTestQuery(t, tt.query)
+		if err != nil {
+			t.Errorf("compileQuery(%q) returned error %v", tt.query, err)
+			continue
+		}
+		if condition.SQL != tt.sql {
+			t.Errorf("compileQuery(%q) SQL = %v, want %v", tt.query, condition.SQL, tt.sql)
+		}
+		if len(condition.Args) != len(tt.args) {
+			t.Errorf("compileQuery(%q) args = %v, want %v", tt.query, condition.Args, tt.args)
+			continue
+		}
+		for i := range tt.args {
+			if condition.Args[i] != tt.args[i] {
+				t.Errorf("compileQuery(%q) args = %v, want %v", tt.query, condition.Args, tt.args)
+				break
+			}
+		}
+	}
+}
+
+func TestCompileQueryText(t *testing.T) {
+	condition, err := compileTestQuery(t, `"50% off"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(condition.Args) != 6 || condition.Args[0] != `%50\% off%` {
+		t.Errorf("compileQuery of a phrase args = %v, want the escaped phrase for every column", condition.Args)
+	}
+	if strings.Count(condition.SQL, "?") != len(condition.Args) {
+		t.Errorf("compileQuery of a phrase has %d placeholders for %d args", strings.Count(condition.SQL, "?"), len(condition.Args))
+	}
+}
+
+func TestCompileQueryAdded(t *testing.T) {
+	tests := []struct {
+		query     string
+		operators []string
+	}{
+		{"added:2023-01-01", []string{">=", "<"}},
+		{"added:>2023-01-01", []string{">="}},
+		{"added:>=2023-01-01", []string{">="}},
+		{"added:<2023-01-01", []string{"<"}},
+		{"added:<=2023-01-01", []string{"<"}},
+		{"added:last-30d", []string{">="}},
+		{"added:last-2y", []string{">="}},
+	}
+	for _, tt := range tests {
+		condition, err := compileTestQuery(t, tt.query)
+		if err != nil {
+			t.Errorf("compileQuery(%q) returned error %v", tt.query, err)
+			continue
+		}
+		for _, operator := range tt.operators {
+			if !strings.Contains(condition.SQL, "add_date "+operator+" ?") {
+				t.Errorf("compileQuery(%q) = %v, want a %v comparison", tt.query, condition.SQL, operator)
+			}
+		}
+		if len(condition.Args) != 2*len(tt.operators) {
+			t.Errorf("compileQuery(%q) has %d args, want %d", tt.query, len(condition.Args), 2*len(tt.operators))
+		}
+	}
+}
+
+func TestCompileQueryErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+	}{
+		{"color:red", 0},
+		{"go is:pinned", 6},
+		{"added:yesterday", 6},
+		{"added:>2023-13-01", 7},
+		{"a (b OR -nope:x)", 9},
+	}
+	for _, tt := range tests {
+		_, err := compileTestQuery(t, tt.query)
+		var queryErr *library.QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("compileQuery(%q) returned %v, want a *library.QueryError", tt.query, err)
+			continue
+		}
+		if queryErr.Position != tt.position {
+			t.Errorf("compileQuery(%q) error at %d, want %d: %v", tt.query, queryErr.Position, tt.position, err)
+		}
+	}
+}
+
+func TestCompileQueryLimits(t *testing.T) {
+	// The most placeholders a query can have stay well below SQLite's limit of 999
+	query := strings.Repeat("word ", library.MaxQueryTerms)
+	condition, err := compileTestQuery(t, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(condition.Args) > 500 {
+		t.Errorf("a query of %d words has %d args", library.MaxQueryTerms, len(condition.Args))
+	}
+}
@@ -0,0 +1,224 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// GetUsersQueue retrieves the bookmarks of a user in a read state. Unread items come in
+// queue order, read and archived ones most recently read first.
+func GetUsersQueue(userID string, state string) ([]models.Bookmark, error) {
+	db := config.Cfg.GormDB
+
+	query := db.Where("user_id = ? AND read_state = ?", userID, state)
+	if state == models.ReadStateUnread {
+		query = query.Order("queue_position, created_at")
+	} else {
+		query = query.Order("read_at DESC, created_at DESC")
+	}
+
+	var bookmarks []models.Bookmark
+	result := query.Find(&bookmarks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return bookmarks, nil
+}
+
+// QueueBookmark saves a bookmark of a user straight into the read-later queue, at its end.
+// New bookmarks are filed by the user's rules. When the user already saved the URL, that
+// bookmark is queued instead, restoring it from the trash if needed, and the bookmark is
+// replaced by the saved one.
+func QueueBookmark(bookmark *models.Bookmark) error {
+	db := config.Cfg.GormDB
+
+	bookmark.CanonicalURL = canonicalURL(bookmark.URL)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var saved []models.Bookmark
+		err := tx.Unscoped().
+			Where("user_id = ? AND canonical_url = ?", bookmark.UserID, bookmark.CanonicalURL).
+			Order("deleted_at IS NOT NULL").
+			Limit(1).
+			Find(&saved).Error
+		if err != nil {
+			return err
+		}
+		position, err := nextQueuePosition(tx, bookmark.UserID)
+		if err != nil {
+			return err
+		}
+
+		if len(saved) > 0 {
+			op, err := beginOperation(tx, bookmark.UserID, models.OperationSave)
+			if err != nil {
+				return err
+			}
+			columns := map[string]interface{}{
+				"deleted_at":     nil,
+				"read_state":     models.ReadStateUnread,
+				"read_at":        nil,
+				"queue_position": position,
+			}
+			// An unread item keeps its place in the queue
+			if saved[0].ReadState == models.ReadStateUnread && !saved[0].DeletedAt.Valid {
+				delete(columns, "queue_position")
+			}
+			err = trackChanges(tx, op, []string{saved[0].ID}, func() error {
+				return tx.Unscoped().Model(&models.Bookmark{}).Where("id = ?", saved[0].ID).Updates(columns).Error
+			})
+			if err != nil {
+				return err
+			}
+			return tx.Where("id = ?", saved[0].ID).First(bookmark).Error
+		}
+
+		op, err := beginOperation(tx, bookmark.UserID, models.OperationCreate)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		bookmark.AddDate = now
+		bookmark.LastModified = now
+		bookmark.ReadState = models.ReadStateUnread
+		bookmark.QueuePosition = position
+		if err := applyRules(tx, bookmark.UserID, bookmark); err != nil {
+			return err
+		}
+		if err := ensureFolder(tx, bookmark.UserID, bookmark.Folder); err != nil {
+			return err
+		}
+		if err := tx.Create(bookmark).Error; err != nil {
+			return err
+		}
+		return recordCreated(tx, op, []models.Bookmark{*bookmark})
+	})
+}
+
+// SetReadState moves a bookmark of a user to a read state. Unread bookmarks join the end of
+// the queue, read ones record when they were read, and an empty state takes the bookmark
+// out of the queue.
+func SetReadState(bookmarkID string, userID string, state string) error {
+	db := config.Cfg.GormDB
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var bookmark models.Bookmark
+		err := tx.Where("id = ? AND user_id = ?", bookmarkID, userID).First(&bookmark).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrBookmarkNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if bookmark.ReadState == state {
+			return nil
+		}
+
+		columns := map[string]interface{}{"read_state": state}
+		switch state {
+		case models.ReadStateUnread:
+			position, err := nextQueuePosition(tx, userID)
+			if err != nil {
+				return err
+			}
+			columns["queue_position"] = position
+			columns["read_at"] = nil
+		case models.ReadStateRead:
+			columns["read_at"] = time.Now()
+		case models.ReadStateArchived:
+			if bookmark.ReadAt == nil {
+				columns["read_at"] = time.Now()
+			}
+		default:
+			columns["queue_position"] = 0
+			columns["read_at"] = nil
+		}
+		return tx.Model(&models.Bookmark{}).Where("id = ?", bookmarkID).Updates(columns).Error
+	})
+}
+
+// ReorderQueue puts the unread items of a user's queue in the order of ids. Items missing
+// from ids follow in their current order; IDs of other bookmarks are ignored.
+func ReorderQueue(userID string, ids []string) error {
+	db := config.Cfg.GormDB
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var queued []string
+		err := tx.Model(&models.Bookmark{}).
+			Where("user_id = ? AND read_state = ?", userID, models.ReadStateUnread).
+			Order("queue_position, created_at").
+			Pluck("id", &queued).Error
+		if err != nil {
+			return err
+		}
+
+		inQueue := make(map[string]bool, len(queued))
+		for _, id := range queued {
+			inQueue[id] = true
+		}
+		order := make([]string, 0, len(queued))
+		placed := make(map[string]bool, len(queued))
+		for _, id := range append(ids, queued...) {
+			if inQueue[id] && !placed[id] {
+				placed[id] = true
+				order = append(order, id)
+			}
+		}
+
+		for i, id := range order {
+			if err := tx.Model(&models.Bookmark{}).Where("id = ?", id).Update("queue_position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// nextQueuePosition returns the position at the end of a user's queue.
+func nextQueuePosition(tx *gorm.DB, userID string) (int64, error) {
+	var last int64
+	err := tx.Model(&models.Bookmark{}).
+		Where("user_id = ? AND read_state = ?", userID, models.ReadStateUnread).
+		Select("COALESCE(MAX(queue_position), 0)").
+		Scan(&last).Error
+	if err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
+
+// SetReadingTime records the estimated reading time of a bookmarked page.
+func SetReadingTime(bookmarkID string, minutes int) error {
+	db := config.Cfg.GormDB
+
+	result := db.Model(&models.Bookmark{}).Where("id = ?", bookmarkID).Update("reading_minutes", minutes)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// ArchiveReadBookmarks archives the bookmarks of every user that were read before the given
+// time, and returns how many were archived.
+func ArchiveReadBookmarks(readBefore time.Time) (int64, error) {
+	db := config.Cfg.GormDB
+
+	result := db.Model(&models.Bookmark{}).
+		Where("read_state = ? AND read_at < ?", models.ReadStateRead, readBefore).
+		Update("read_state", models.ReadStateArchived)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
+// InReadState limits a bookmark query to bookmarks in a read state.
+func InReadState(state string) func(*gorm.DB) *gorm.DB {
+	return readStateCondition(state).scope()
+}
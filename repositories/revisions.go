@@ -0,0 +1,369 @@
+package repositories
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOperationNotFound is returned when an operation does not exist or belongs to another user.
+	ErrOperationNotFound = errors.New("operation not found")
+	// ErrOperationUndone is returned when an operation has already been undone.
+	ErrOperationUndone = errors.New("operation already undone")
+)
+
+// UndoResult reports the outcome of undoing an operation. Bookmarks changed again after the
+// operation, or whose URL their owner saved again in another bookmark, are left as they are
+// and reported as conflicts.
+type UndoResult struct {
+	OperationID string   `json:"operation_id"`
+	Reverted    int      `json:"reverted"`
+	Conflicts   []string `json:"conflicts"`
+}
+
+// GetUsersBookmarkHistory retrieves the revisions of a user's bookmark, or of a bookmark in a
+// folder shared with them, newest first. The history is kept after the bookmark is purged.
+func GetUsersBookmarkHistory(bookmarkID string, userID string) ([]models.Revision, error) {
+	db := config.Cfg.GormDB
+
+	query := db.Where("bookmark_id = ?", bookmarkID)
+	if _, err := GetUsersBookmark(bookmarkID, userID); errors.Is(err, ErrBookmarkNotFound) {
+		query = query.Where("user_id = ?", userID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var revisions []models.Revision
+	result := query.Order("id DESC").Find(&revisions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return revisions, nil
+}
+
+// UndoOperation reverts every bookmark changed by an operation of a user to its state before
+// the operation. Undoing is itself recorded as an operation, which can be undone in turn.
+func UndoOperation(operationID string, userID string) (*UndoResult, error) {
+	db := config.Cfg.GormDB
+
+	result := &UndoResult{Conflicts: []string{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var op models.Operation
+		err := tx.Where("id = ? AND user_id = ?", operationID, userID).First(&op).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOperationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if op.UndoneAt != nil {
+			return ErrOperationUndone
+		}
+
+		var revisions []models.Revision
+		if err := tx.Where("operation_id = ?", op.ID).Order("id").Find(&revisions).Error; err != nil {
+			return err
+		}
+
+		// A bookmark changed several times by the operation goes back to its first state
+		var ids []string
+		var lastRevision int64
+		before := map[string]*models.BookmarkState{}
+		owners := map[string]string{}
+		for _, r := range revisions {
+			if _, ok := before[r.BookmarkID]; !ok {
+				ids = append(ids, r.BookmarkID)
+				before[r.BookmarkID] = r.Before
+				owners[r.BookmarkID] = r.UserID
+			}
+			lastRevision = r.ID
+		}
+
+		changed := map[string]bool{}
+		for start := 0; start < len(ids); start += bulkBatchSize {
+			var later []string
+			err := tx.Model(&models.Revision{}).
+				Where("bookmark_id IN ? AND id > ?", ids[start:minInt(start+bulkBatchSize, len(ids))], lastRevision).
+				Distinct().Pluck("bookmark_id", &later).Error
+			if err != nil {
+				return err
+			}
+			for _, id := range later {
+				changed[id] = true
+			}
+		}
+		taken, err := urlsTaken(tx, ids, before, owners)
+		if err != nil {
+			return err
+		}
+		var revert []string
+		for _, id := range ids {
+			changed[id] = changed[id] || taken[id]
+			// Bookmarks of other users are only reverted while the user may still edit them
+			if !changed[id] && owners[id] != userID {
+				editable, err := canEditBookmark(tx, id, userID)
+				if err != nil {
+					return err
+				}
+				changed[id] = !editable
+			}
+			if changed[id] {
+				result.Conflicts = append(result.Conflicts, id)
+			} else {
+				revert = append(revert, id)
+			}
+		}
+
+		undo, err := beginOperation(tx, userID, models.OperationUndo)
+		if err != nil {
+			return err
+		}
+		result.OperationID = undo.ID
+		// Bookmarks giving up their URL go first, so it is free for those going back to it
+		sort.SliceStable(revert, func(i, j int) bool {
+			return !holdsURL(before[revert[i]]) && holdsURL(before[revert[j]])
+		})
+		err = trackChanges(tx, undo, revert, func() error {
+			for _, id := range revert {
+				if err := revertBookmark(tx, owners[id], id, before[id]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		result.Reverted = len(revert)
+
+		return tx.Model(&op).Update("undone_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// revertBookmark puts a bookmark of a user back in a recorded state. Without a state the
+// bookmark did not exist, so it is purged; a purged bookmark is saved again from its state.
+func revertBookmark(tx *gorm.DB, userID string, bookmarkID string, state *models.BookmarkState) error {
+	if state == nil {
+		return tx.Unscoped().Where("id = ? AND user_id = ?", bookmarkID, userID).Delete(&models.Bookmark{}).Error
+	}
+
+	result := tx.Unscoped().Model(&models.Bookmark{}).
+		Where("id = ? AND user_id = ?", bookmarkID, userID).
+		Updates(stateColumns(*state))
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+
+	bookmark := models.Bookmark{
+		ID:           bookmarkID,
+		UserID:       userID,
+		Version:      1,
+		Folder:       state.Folder,
+		URL:          state.URL,
+		CanonicalURL: state.CanonicalURL,
+		Duplicate:    state.Duplicate,
+		AddDate:      state.AddDate,
+		LastModified: state.LastModified,
+		Icon:         state.Icon,
+		IconHash:     state.IconHash,
+		Name:         state.Name,
+		Tags:         state.Tags,
+		Keyword:      state.Keyword,
+		Description:  state.Description,
+		Notes:        state.Notes,
+	}
+	if state.DeletedAt != nil {
+		bookmark.DeletedAt = gorm.DeletedAt{Time: *state.DeletedAt, Valid: true}
+	}
+	// Skip the hooks so the bookmark keeps its ID
+	return tx.Session(&gorm.Session{SkipHooks: true}).Create(&bookmark).Error
+}
+
+// urlsTaken returns the bookmarks among ids whose recorded state holds a URL their owner
+// has since saved in a bookmark outside of ids, so they cannot go back to that state.
+func urlsTaken(tx *gorm.DB, ids []string, states map[string]*models.BookmarkState, owners map[string]string) (map[string]bool, error) {
+	reverted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		reverted[id] = true
+	}
+
+	taken := map[string]bool{}
+	for _, id := range ids {
+		state := states[id]
+		if !holdsURL(state) {
+			continue
+		}
+		canonical := state.CanonicalURL
+		if canonical == "" {
+			canonical = canonicalURL(state.URL)
+		}
+		saved, err := savedBookmarkID(tx, owners[id], canonical, id)
+		if err != nil {
+			return nil, err
+		}
+		taken[id] = saved != "" && !reverted[saved]
+	}
+	return taken, nil
+}
+
+// holdsURL reports whether a bookmark in a recorded state is the one bookmark of its owner
+// with its canonical URL: it exists, is outside the trash and is not a duplicate.
+func holdsURL(state *models.BookmarkState) bool {
+	return state != nil && state.DeletedAt == nil && !state.Duplicate
+}
+
+// stateColumns maps a recorded state to the bookmark columns it is stored in.
+func stateColumns(state models.BookmarkState) map[string]interface{} {
+	return map[string]interface{}{
+		"folder":        state.Folder,
+		"url":           state.URL,
+		"canonical_url": state.CanonicalURL,
+		"duplicate":     state.Duplicate,
+		"add_date":      state.AddDate,
+		"last_modified": state.LastModified,
+		"icon":          state.Icon,
+		"icon_hash":     state.IconHash,
+		"name":          state.Name,
+		"tags":          state.Tags,
+		"keyword":       state.Keyword,
+		"description":   state.Description,
+		"notes":         state.Notes,
+		"deleted_at":    state.DeletedAt,
+	}
+}
+
+// beginOperation starts an operation of a user to group the revisions recorded within tx.
+// The revisions belong to the owners of the bookmarks, who may be other users when the
+// bookmarks are in a shared folder.
+func beginOperation(tx *gorm.DB, userID string, kind string) (models.Operation, error) {
+	op := models.Operation{UserID: userID, Kind: kind}
+	if err := tx.Create(&op).Error; err != nil {
+		return op, err
+	}
+	return op, nil
+}
+
+// trackChanges runs change and records a revision, as part of the operation, for every
+// bookmark in ids that it created, changed or deleted.
+func trackChanges(tx *gorm.DB, op models.Operation, ids []string, change func() error) error {
+	before, owners, err := bookmarkStates(tx, ids)
+	if err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	after, created, err := bookmarkStates(tx, ids)
+	if err != nil {
+		return err
+	}
+	for id, owner := range created {
+		if _, ok := owners[id]; !ok {
+			owners[id] = owner
+		}
+	}
+
+	var revisions []models.Revision
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		action := revisionAction(before[id], after[id])
+		if action == "" {
+			continue
+		}
+		revisions = append(revisions, models.Revision{
+			OperationID: op.ID,
+			UserID:      owners[id],
+			BookmarkID:  id,
+			Action:      action,
+			Before:      before[id],
+			After:       after[id],
+		})
+	}
+	return recordRevisions(tx, revisions)
+}
+
+// recordCreated records a revision, as part of the operation, for every created bookmark.
+func recordCreated(tx *gorm.DB, op models.Operation, bookmarks []models.Bookmark) error {
+	revisions := make([]models.Revision, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		state := b.State()
+		revisions = append(revisions, models.Revision{
+			OperationID: op.ID,
+			UserID:      b.UserID,
+			BookmarkID:  b.ID,
+			Action:      models.RevisionCreate,
+			After:       &state,
+		})
+	}
+	return recordRevisions(tx, revisions)
+}
+
+func recordRevisions(tx *gorm.DB, revisions []models.Revision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(&revisions, bulkBatchSize).Error
+}
+
+// bookmarkStates loads the current state of bookmarks, including deleted ones, and their
+// owners. Bookmarks that do not exist are missing from the result.
+func bookmarkStates(tx *gorm.DB, ids []string) (map[string]*models.BookmarkState, map[string]string, error) {
+	states := make(map[string]*models.BookmarkState, len(ids))
+	owners := make(map[string]string, len(ids))
+	for start := 0; start < len(ids); start += bulkBatchSize {
+		var bookmarks []models.Bookmark
+		err := tx.Unscoped().Where("id IN ?", ids[start:minInt(start+bulkBatchSize, len(ids))]).Find(&bookmarks).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, b := range bookmarks {
+			state := b.State()
+			states[b.ID] = &state
+			owners[b.ID] = b.UserID
+		}
+	}
+	return states, owners, nil
+}
+
+// revisionAction names the change between two states of a bookmark, or returns an empty
+// string when the recorded state did not change.
+func revisionAction(before, after *models.BookmarkState) string {
+	switch {
+	case before == nil && after == nil:
+		return ""
+	case before == nil:
+		return models.RevisionCreate
+	case after == nil:
+		return models.RevisionPurge
+	case before.DeletedAt == nil && after.DeletedAt != nil:
+		return models.RevisionDelete
+	case before.DeletedAt != nil && after.DeletedAt == nil:
+		return models.RevisionRestore
+	}
+
+	b, a := *before, *after
+	b.DeletedAt, a.DeletedAt = nil, nil
+	if b == a {
+		return ""
+	}
+	b.Folder, b.LastModified = a.Folder, a.LastModified
+	if b == a {
+		return models.RevisionMove
+	}
+	return models.RevisionUpdate
+}
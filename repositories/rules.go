@@ -0,0 +1,285 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// ErrRuleNotFound is returned when a rule does not exist or belongs to another user.
+var ErrRuleNotFound = errors.New("rule not found")
+
+// RuleFields are the bookmark fields rules change.
+type RuleFields struct {
+	Name   string `json:"name"`
+	Folder string `json:"folder"`
+	Tags   string `json:"tags"`
+}
+
+// RuleChange is the change rules make to one bookmark.
+type RuleChange struct {
+	ID     string     `json:"id"`
+	URL    string     `json:"url"`
+	Rules  []string   `json:"rules"`
+	Before RuleFields `json:"before"`
+	After  RuleFields `json:"after"`
+}
+
+// RuleRunResult reports what running rules changed, or would change in a preview.
+type RuleRunResult struct {
+	Preview     bool         `json:"preview"`
+	OperationID string       `json:"operation_id,omitempty"`
+	Checked     int          `json:"checked"`
+	Changed     int          `json:"changed"`
+	Changes     []RuleChange `json:"changes"`
+}
+
+// GetUsersRules retrieves the rules of a user in the order they apply.
+func GetUsersRules(userID string) ([]models.Rule, error) {
+	return usersRules(config.Cfg.GormDB, userID, false)
+}
+
+// usersRules retrieves the rules of a user in the order they apply, prepared for matching,
+// only the enabled ones when enabledOnly is set.
+func usersRules(db *gorm.DB, userID string, enabledOnly bool) ([]models.Rule, error) {
+	query := db.Where("user_id = ?", userID)
+	if enabledOnly {
+		query = query.Where("enabled = ?", true)
+	}
+
+	var rules []models.Rule
+	result := query.Order("position, created_at").Find(&rules)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for i := range rules {
+		rules[i].Prepare()
+	}
+
+	return rules, nil
+}
+
+// GetUsersRule retrieves a rule of a user.
+func GetUsersRule(ruleID string, userID string) (models.Rule, error) {
+	db := config.Cfg.GormDB
+
+	var rule models.Rule
+	result := db.Where("id = ? AND user_id = ?", ruleID, userID).First(&rule)
+	if result.Error == gorm.ErrRecordNotFound {
+		return rule, ErrRuleNotFound
+	}
+	if result.Error != nil {
+		return rule, result.Error
+	}
+
+	return rule, nil
+}
+
+// SaveRule saves a new rule of a user. Without a position it applies after the user's
+// other rules.
+func SaveRule(rule *models.Rule) error {
+	db := config.Cfg.GormDB
+
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if rule.Position == 0 {
+			var last int
+			err := tx.Model(&models.Rule{}).Where("user_id = ?", rule.UserID).Select("COALESCE(MAX(position), 0)").Scan(&last).Error
+			if err != nil {
+				return err
+			}
+			rule.Position = last + 1
+		}
+		return tx.Create(rule).Error
+	})
+}
+
+// UpdateRule replaces the conditions and actions of a rule of a user.
+func UpdateRule(rule models.Rule) error {
+	db := config.Cfg.GormDB
+
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	result := db.Model(&models.Rule{}).
+		Where("id = ? AND user_id = ?", rule.ID, rule.UserID).
+		Select("name", "position", "enabled", "domain", "url_pattern", "title_contains", "folder", "add_tags", "name_template").
+		Updates(&rule)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRuleNotFound
+	}
+
+	return nil
+}
+
+// DeleteRule deletes a rule of a user.
+func DeleteRule(ruleID string, userID string) error {
+	db := config.Cfg.GormDB
+
+	result := db.Where("id = ? AND user_id = ?", ruleID, userID).Delete(&models.Rule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRuleNotFound
+	}
+
+	return nil
+}
+
+// ApplyUsersRules applies the enabled rules of a user to bookmarks that are about to be
+// imported for them. Nothing is saved; ImportBookmarks saves the folders the rules move
+// them to along with the bookmarks.
+func ApplyUsersRules(userID string, bookmarks []models.Bookmark) error {
+	db := config.Cfg.GormDB
+
+	rules, err := usersRules(db, userID, true)
+	if err != nil {
+		return err
+	}
+	for i := range bookmarks {
+		models.ApplyRules(rules, &bookmarks[i])
+	}
+	return nil
+}
+
+// applyRules applies the enabled rules of a user to a bookmark about to be created for them
+// within tx.
+func applyRules(tx *gorm.DB, userID string, bookmark *models.Bookmark) error {
+	rules, err := usersRules(tx, userID, true)
+	if err != nil {
+		return err
+	}
+	models.ApplyRules(rules, bookmark)
+	return nil
+}
+
+// RunRules applies rules to the saved bookmarks of a user: those in ruleIDs, enabled or not,
+// or all enabled rules when ruleIDs is empty. In a preview nothing is saved and the result
+// shows what would change; otherwise the bookmarks are read and changed in one transaction,
+// and the changes are recorded as one operation, so they can be undone together.
+func RunRules(userID string, ruleIDs []string, preview bool) (*RuleRunResult, error) {
+	db := config.Cfg.GormDB
+
+	var rules []models.Rule
+	var err error
+	if len(ruleIDs) == 0 {
+		rules, err = usersRules(db, userID, true)
+	} else {
+		rules, err = usersRules(db.Where("id IN ?", ruleIDs), userID, false)
+		if err == nil && len(rules) != len(uniqueStrings(ruleIDs)) {
+			err = ErrRuleNotFound
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if preview {
+		result, _, err := planRules(db, userID, rules)
+		if err != nil {
+			return nil, err
+		}
+		result.Preview = true
+		return result, nil
+	}
+
+	var result *RuleRunResult
+	err = db.Transaction(func(tx *gorm.DB) error {
+		planned, changed, err := planRules(tx, userID, rules)
+		if err != nil {
+			return err
+		}
+		result = planned
+		if len(changed) == 0 {
+			return nil
+		}
+
+		op, err := beginOperation(tx, userID, models.OperationRules)
+		if err != nil {
+			return err
+		}
+		result.OperationID = op.ID
+
+		for start := 0; start < len(changed); start += bulkBatchSize {
+			batch := changed[start:minInt(start+bulkBatchSize, len(changed))]
+			ids := make([]string, 0, len(batch))
+			for _, b := range batch {
+				ids = append(ids, b.ID)
+			}
+			err := trackChanges(tx, op, ids, func() error {
+				for _, b := range batch {
+					if err := ensureFolder(tx, userID, b.Folder); err != nil {
+						return err
+					}
+					err := tx.Model(&models.Bookmark{}).Where("id = ?", b.ID).Updates(map[string]interface{}{
+						"name":          b.Name,
+						"folder":        b.Folder,
+						"tags":          b.Tags,
+						"last_modified": time.Now().Unix(),
+					}).Error
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// planRules applies rules to the saved bookmarks of a user as read from db, and returns
+// what they change with the changed bookmarks.
+func planRules(db *gorm.DB, userID string, rules []models.Rule) (*RuleRunResult, []models.Bookmark, error) {
+	result := &RuleRunResult{Changes: []RuleChange{}}
+	var changed []models.Bookmark
+	err := scanUsersBookmarks(db, userID, func(b models.Bookmark) error {
+		result.Checked++
+		before := RuleFields{Name: b.Name, Folder: b.Folder, Tags: b.Tags}
+		applied := models.ApplyRules(rules, &b)
+		after := RuleFields{Name: b.Name, Folder: b.Folder, Tags: b.Tags}
+		if len(applied) == 0 || after == before {
+			return nil
+		}
+		result.Changes = append(result.Changes, RuleChange{ID: b.ID, URL: b.URL, Rules: applied, Before: before, After: after})
+		changed = append(changed, b)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Changed = len(changed)
+	return result, changed, nil
+}
+
+// uniqueStrings returns the distinct strings of a list, in order.
+func uniqueStrings(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	unique := make([]string, 0, len(list))
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSavedSearchNotFound is returned when a saved search does not exist or belongs to another user.
+	ErrSavedSearchNotFound = errors.New("saved search not found")
+	// ErrSavedSearchExists is returned when a user already has a saved search with the same name.
+	ErrSavedSearchExists = errors.New("a saved search with this name already exists")
+	// ErrInvalidSearch is wrapped by the errors returned for search queries that cannot be
+	// understood, which are *library.QueryError.
+	ErrInvalidSearch = library.ErrInvalidQuery
+)
+
+// SaveSavedSearch saves a new saved search of a user.
+func SaveSavedSearch(search *models.SavedSearch) error {
+	db := config.Cfg.GormDB
+
+	if _, err := SearchScope(search.Query); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := savedSearchNameTaken(tx, *search); err != nil {
+			return err
+		}
+		return tx.Create(search).Error
+	})
+}
+
+// UpdateSavedSearch renames a saved search of a user or changes its query.
+func UpdateSavedSearch(search models.SavedSearch) error {
+	db := config.Cfg.GormDB
+
+	if _, err := SearchScope(search.Query); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := savedSearchNameTaken(tx, search); err != nil {
+			return err
+		}
+		result := tx.Model(&models.SavedSearch{}).
+			Where("id = ? AND user_id = ?", search.ID, search.UserID).
+			Updates(map[string]interface{}{"name": search.Name, "query": search.Query})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSavedSearchNotFound
+		}
+		return nil
+	})
+}
+
+// savedSearchNameTaken returns ErrSavedSearchExists when another saved search of the user
+// has the name of search.
+func savedSearchNameTaken(tx *gorm.DB, search models.SavedSearch) error {
+	var count int64
+	err := tx.Model(&models.SavedSearch{}).
+		Where("user_id = ? AND name = ? AND id <> ?", search.UserID, search.Name, search.ID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSavedSearchExists
+	}
+	return nil
+}
+
+// GetUsersSavedSearches retrieves the saved searches of a user by name, each with the number
+// of bookmarks the user can see that it matches.
+func GetUsersSavedSearches(userID string) ([]models.SavedSearch, error) {
+	db := config.Cfg.GormDB
+
+	var searches []models.SavedSearch
+	result := db.Where("user_id = ?", userID).Order("name").Find(&searches)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for i := range searches {
+		scope, err := SearchScope(searches[i].Query)
+		if err != nil {
+			// Queries are checked when saved, so this one predates a change of the syntax
+			continue
+		}
+		var count int64
+		err = db.Model(&models.Bookmark{}).Scopes(scope, AccessibleBy(userID, models.RoleViewer)).Count(&count).Error
+		if err != nil {
+			return nil, err
+		}
+		searches[i].Count = &count
+	}
+
+	return searches, nil
+}
+
+// GetUsersSavedSearch retrieves a saved search of a user.
+func GetUsersSavedSearch(searchID string, userID string) (models.SavedSearch, error) {
+	db := config.Cfg.GormDB
+
+	var search models.SavedSearch
+	result := db.Where("id = ? AND user_id = ?", searchID, userID).First(&search)
+	if result.Error == gorm.ErrRecordNotFound {
+		return search, ErrSavedSearchNotFound
+	}
+	if result.Error != nil {
+		return search, result.Error
+	}
+
+	return search, nil
+}
+
+// DeleteSavedSearch deletes a saved search of a user, revoking the share links and deleting
+// the feeds that publish it.
+func DeleteSavedSearch(searchID string, userID string) error {
+	db := config.Cfg.GormDB
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", searchID, userID).Delete(&models.SavedSearch{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSavedSearchNotFound
+		}
+		err := tx.Model(&models.Share{}).
+			Where("user_id = ? AND kind = ? AND target = ? AND revoked_at IS NULL", userID, models.ShareSearch, searchID).
+			Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND kind = ? AND target = ?", userID, models.FeedSearch, searchID).Delete(&models.Feed{}).Error
+	})
+}
+
+// SavedSearchScope limits a bookmark query to the bookmarks matched by a saved search of a user.
+func SavedSearchScope(searchID string, userID string) (func(*gorm.DB) *gorm.DB, error) {
+	search, err := GetUsersSavedSearch(searchID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return SearchScope(search.Query)
+}
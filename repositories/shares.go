@@ -0,0 +1,160 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// ErrShareNotFound is returned when a share does not exist, belongs to another user or was revoked.
+var ErrShareNotFound = errors.New("share not found")
+
+// SaveShare saves a new share link.
+func SaveShare(share *models.Share) error {
+	db := config.Cfg.GormDB
+
+	if _, err := ShareScope(*share); err != nil {
+		return err
+	}
+
+	result := db.Create(share)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// GetUsersShares retrieves the share links of a user, newest first, including revoked ones.
+func GetUsersShares(userID string) ([]models.Share, error) {
+	db := config.Cfg.GormDB
+
+	var shares []models.Share
+	result := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&shares)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return shares, nil
+}
+
+// RevokeShare revokes a share link of a user, so its token no longer gives access.
+func RevokeShare(shareID string, userID string) error {
+	db := config.Cfg.GormDB
+
+	result := db.Model(&models.Share{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", shareID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareNotFound
+	}
+
+	return nil
+}
+
+// GetShareByToken retrieves the share link with a token, unless it was revoked.
+// Expiry is left to the caller, so that expired links can be told apart.
+func GetShareByToken(token string) (models.Share, error) {
+	db := config.Cfg.GormDB
+
+	var share models.Share
+	result := db.Where("token = ? AND revoked_at IS NULL", token).First(&share)
+	if result.Error == gorm.ErrRecordNotFound {
+		return share, ErrShareNotFound
+	}
+	if result.Error != nil {
+		return share, result.Error
+	}
+
+	return share, nil
+}
+
+// RecordShareAccess counts a view of a share link.
+func RecordShareAccess(shareID string) error {
+	db := config.Cfg.GormDB
+
+	result := db.Model(&models.Share{}).Where("id = ?", shareID).UpdateColumns(map[string]interface{}{
+		"access_count":     gorm.Expr("access_count + 1"),
+		"last_accessed_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// ShareScope limits a bookmark query to the bookmarks a share link gives access to.
+func ShareScope(share models.Share) (func(*gorm.DB) *gorm.DB, error) {
+	switch share.Kind {
+	case models.ShareFolder:
+		return InFolder(share.Target), nil
+	case models.ShareTag:
+		return WithTag(share.Target), nil
+	case models.ShareSearch:
+		return SavedSearchScope(share.Target, share.UserID)
+	}
+	return nil, fmt.Errorf("unknown share kind %q", share.Kind)
+}
+
+// GetSharedBookmarks retrieves the bookmarks a share link gives access to, in folder order.
+func GetSharedBookmarks(share models.Share) ([]models.Bookmark, error) {
+	scope, err := ShareScope(share)
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarks := []models.Bookmark{}
+	err = ScanUsersBookmarks(share.UserID, func(b models.Bookmark) error {
+		bookmarks = append(bookmarks, b)
+		return nil
+	}, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookmarks, nil
+}
+
+// Wrong passwords sent for a share link are counted in Redis per window of
+// SharePasswordWindow. Once MaxSharePasswordAttempts is reached, the link refuses passwords
+// until the window ends.
+const (
+	MaxSharePasswordAttempts = 10
+	SharePasswordWindow      = 15 * time.Minute
+)
+
+// SharePasswordBlocked reports whether a share link had too many wrong passwords in the
+// current window.
+func SharePasswordBlocked(shareID string, now time.Time) (bool, error) {
+	attempts, err := config.Cfg.RedisClient.Get(sharePasswordAttemptsKey(shareID, now)).Int()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return attempts >= MaxSharePasswordAttempts, nil
+}
+
+// RecordSharePasswordFailure counts a wrong password sent for a share link.
+func RecordSharePasswordFailure(shareID string, now time.Time) error {
+	key := sharePasswordAttemptsKey(shareID, now)
+	pipe := config.Cfg.RedisClient.TxPipeline()
+	pipe.Incr(key)
+	pipe.Expire(key, SharePasswordWindow)
+	_, err := pipe.Exec()
+	return err
+}
+
+func sharePasswordAttemptsKey(shareID string, now time.Time) string {
+	return fmt.Sprintf("share:%v:password:%v", shareID, now.Unix()/int64(SharePasswordWindow/time.Second))
+}
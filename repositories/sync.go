@@ -0,0 +1,512 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// Sync change actions.
+const (
+	SyncCreate = "create"
+	SyncUpdate = "update"
+	SyncDelete = "delete"
+)
+
+// Outcomes of applying a client change.
+const (
+	SyncApplied  = "applied"
+	SyncConflict = "conflict"
+	SyncNotFound = "not_found"
+	SyncInvalid  = "invalid"
+	// SyncForbidden is the outcome of changing a bookmark in a shared folder the user may only
+	// view, or moving one out of the shared folder.
+	SyncForbidden = "forbidden"
+)
+
+// syncColumns are the bookmark columns a sync client may change.
+var syncColumns = []string{"folder", "url", "name", "tags", "keyword", "description", "notes"}
+
+// SyncChanges are the changes to the bookmarks of a user since a sync cursor. Cursor is the
+// cursor to ask for the next changes with, and More is set when there are more changes.
+type SyncChanges struct {
+	Cursor  int64             `json:"cursor"`
+	More    bool              `json:"more"`
+	Created []models.Bookmark `json:"created"`
+	Updated []models.Bookmark `json:"updated"`
+	Deleted []SyncTombstone   `json:"deleted"`
+}
+
+// SyncTombstone marks a bookmark that was deleted since the sync cursor.
+type SyncTombstone struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SyncChange is a change made by a sync client. Fields holds the changed bookmark fields by
+// column name, see syncColumns. ClientID is echoed back so clients can match the bookmarks
+// they created.
+type SyncChange struct {
+	Action   string            `json:"action"`
+	ID       string            `json:"id,omitempty"`
+	ClientID string            `json:"client_id,omitempty"`
+	Fields   map[string]string `json:"bookmark,omitempty"`
+}
+
+// SyncResult is the outcome of one client change. On conflicts, Conflicts names the fields
+// that kept the server value, and Bookmark is the server copy.
+type SyncResult struct {
+	ID        string           `json:"id,omitempty"`
+	ClientID  string           `json:"client_id,omitempty"`
+	Status    string           `json:"status"`
+	Error     string           `json:"error,omitempty"`
+	Conflicts []string         `json:"conflicts,omitempty"`
+	Bookmark  *models.Bookmark `json:"bookmark,omitempty"`
+}
+
+// SyncReport reports the outcome of a batch of client changes, in the order they were sent.
+type SyncReport struct {
+	OperationID string       `json:"operation_id"`
+	Results     []SyncResult `json:"results"`
+}
+
+// GetUsersSnapshot retrieves all bookmarks of a user, including those in folders shared with
+// them, with the cursor to sync from afterwards.
+func GetUsersSnapshot(userID string) (*SyncChanges, error) {
+	db := config.Cfg.GormDB
+
+	changes := &SyncChanges{Updated: []models.Bookmark{}, Deleted: []SyncTombstone{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		memberships, err := usersMemberships(tx, userID, "")
+		if err != nil {
+			return err
+		}
+		var cursor *int64
+		err = tx.Model(&models.Revision{}).Where("user_id IN ?", syncOwners(userID, memberships)).Select("MAX(id)").Scan(&cursor).Error
+		if err != nil {
+			return err
+		}
+		if cursor != nil {
+			changes.Cursor = *cursor
+		}
+		return tx.Scopes(AccessibleBy(userID, models.RoleViewer)).Order("created_at").Find(&changes.Created).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// GetUsersChanges retrieves the bookmarks of a user, including those in folders shared with
+// them, created, updated or deleted after the sync cursor, reading at most limit revisions.
+// Changed bookmarks are returned as they are now, so a bookmark changed several times is
+// returned once. Bookmarks moved out of a shared folder are reported as deleted; those of a
+// folder the user is no longer a member of are not, clients find out with a new snapshot.
+func GetUsersChanges(userID string, since int64, limit int) (*SyncChanges, error) {
+	db := config.Cfg.GormDB
+
+	changes := &SyncChanges{Cursor: since, Created: []models.Bookmark{}, Updated: []models.Bookmark{}, Deleted: []SyncTombstone{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		memberships, err := usersMemberships(tx, userID, "")
+		if err != nil {
+			return err
+		}
+		var revisions []models.Revision
+		err = tx.Select("id", "user_id", "bookmark_id", "action", "before_state", "after_state", "created_at").
+			Where("user_id IN ? AND id > ?", syncOwners(userID, memberships), since).
+			Order("id").Limit(limit + 1).Find(&revisions).Error
+		if err != nil {
+			return err
+		}
+		if len(revisions) > limit {
+			changes.More = true
+			revisions = revisions[:limit]
+		}
+		if len(revisions) == 0 {
+			return nil
+		}
+		changes.Cursor = revisions[len(revisions)-1].ID
+
+		var ids []string
+		created := map[string]bool{}
+		lastChanged := map[string]time.Time{}
+		for _, r := range revisions {
+			if r.UserID != userID && !sharedRevision(memberships, r) {
+				continue
+			}
+			if _, ok := lastChanged[r.BookmarkID]; !ok {
+				ids = append(ids, r.BookmarkID)
+			}
+			lastChanged[r.BookmarkID] = r.CreatedAt
+			if r.Action == models.RevisionCreate {
+				created[r.BookmarkID] = true
+			}
+		}
+
+		current := map[string]models.Bookmark{}
+		for start := 0; start < len(ids); start += bulkBatchSize {
+			var bookmarks []models.Bookmark
+			err := tx.Unscoped().Where("id IN ?", ids[start:minInt(start+bulkBatchSize, len(ids))]).
+				Scopes(AccessibleBy(userID, models.RoleViewer)).Find(&bookmarks).Error
+			if err != nil {
+				return err
+			}
+			for _, b := range bookmarks {
+				current[b.ID] = b
+			}
+		}
+
+		for _, id := range ids {
+			b, ok := current[id]
+			switch {
+			case !ok:
+				changes.Deleted = append(changes.Deleted, SyncTombstone{ID: id, DeletedAt: lastChanged[id]})
+			case b.DeletedAt.Valid:
+				changes.Deleted = append(changes.Deleted, SyncTombstone{ID: id, DeletedAt: b.DeletedAt.Time})
+			case created[id]:
+				changes.Created = append(changes.Created, b)
+			default:
+				changes.Updated = append(changes.Updated, b)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// ApplySyncChanges applies a batch of changes made by a sync client of a user, which last
+// synced at the cursor, as one operation. Bookmarks in shared folders can be changed by
+// editors of the folder, within it; created bookmarks are always the user's own.
+//
+// A field changed both on the server since the cursor and by the client keeps the server
+// value and is reported as a conflict; the other fields of the change are applied. Server
+// edits win over client deletes, and bookmarks deleted on the server are not updated. Creating
+// a bookmark whose URL is already saved, or changing its URL to one saved in another bookmark,
+// is a conflict on the URL, and creating one whose URL is in the trash restores it.
+func ApplySyncChanges(userID string, cursor int64, changes []SyncChange) (*SyncReport, error) {
+	db := config.Cfg.GormDB
+
+	report := &SyncReport{Results: make([]SyncResult, 0, len(changes))}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		op, err := beginOperation(tx, userID, models.OperationSync)
+		if err != nil {
+			return err
+		}
+		report.OperationID = op.ID
+
+		for _, change := range changes {
+			result := SyncResult{ID: change.ID, ClientID: change.ClientID}
+			if err := validateSyncChange(change); err != nil {
+				result.Status, result.Error = SyncInvalid, err.Error()
+				report.Results = append(report.Results, result)
+				continue
+			}
+
+			switch change.Action {
+			case SyncCreate:
+				err = applySyncCreate(tx, op, change, &result)
+			default:
+				err = applySyncChange(tx, op, cursor, change, &result)
+			}
+			if err != nil {
+				return err
+			}
+			report.Results = append(report.Results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// validateSyncChange checks that a client change can be applied.
+func validateSyncChange(change SyncChange) error {
+	switch change.Action {
+	case SyncCreate:
+		if reason := invalidBookmarkURL(change.Fields["url"]); reason != "" {
+			return errors.New(reason)
+		}
+	case SyncUpdate, SyncDelete:
+		if change.ID == "" {
+			return fmt.Errorf("%v needs the bookmark id", change.Action)
+		}
+	default:
+		return fmt.Errorf("unknown sync action %q", change.Action)
+	}
+
+	for column, value := range change.Fields {
+		if !isSyncColumn(column) {
+			return fmt.Errorf("unknown bookmark field %q", column)
+		}
+		if column == "url" {
+			if reason := invalidBookmarkURL(value); reason != "" {
+				return errors.New(reason)
+			}
+		}
+	}
+	return nil
+}
+
+// applySyncCreate saves a bookmark created by a sync client, filed by the user's rules like
+// bookmarks created in the API.
+func applySyncCreate(tx *gorm.DB, op models.Operation, change SyncChange, result *SyncResult) error {
+	canonical := canonicalURL(change.Fields["url"])
+
+	var saved []models.Bookmark
+	err := tx.Unscoped().Where("user_id = ? AND canonical_url = ?", op.UserID, canonical).Order("deleted_at IS NOT NULL").Limit(1).Find(&saved).Error
+	if err != nil {
+		return err
+	}
+	if len(saved) > 0 && !saved[0].DeletedAt.Valid {
+		result.ID, result.Status, result.Conflicts = saved[0].ID, SyncConflict, []string{"url"}
+		result.Bookmark = &saved[0]
+		return nil
+	}
+
+	if len(saved) > 0 {
+		// Restore the bookmark from the trash with the client fields
+		result.ID = saved[0].ID
+		err := trackChanges(tx, op, []string{result.ID}, func() error {
+			if err := ensureFolder(tx, op.UserID, change.Fields["folder"]); err != nil {
+				return err
+			}
+			columns := syncUpdates(change.Fields)
+			columns["deleted_at"] = nil
+			return tx.Unscoped().Model(&models.Bookmark{}).Where("id = ?", result.ID).Updates(columns).Error
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		now := time.Now().Unix()
+		bookmark := models.Bookmark{
+			UserID:       op.UserID,
+			Folder:       change.Fields["folder"],
+			URL:          change.Fields["url"],
+			CanonicalURL: canonical,
+			AddDate:      now,
+			LastModified: now,
+			Name:         change.Fields["name"],
+			Tags:         models.JoinTags([]string{change.Fields["tags"]}),
+			Keyword:      change.Fields["keyword"],
+			Description:  change.Fields["description"],
+			Notes:        change.Fields["notes"],
+		}
+		if err := applyRules(tx, op.UserID, &bookmark); err != nil {
+			return err
+		}
+		if err := ensureFolder(tx, op.UserID, bookmark.Folder); err != nil {
+			return err
+		}
+		if err := tx.Create(&bookmark).Error; err != nil {
+			return err
+		}
+		if err := recordCreated(tx, op, []models.Bookmark{bookmark}); err != nil {
+			return err
+		}
+		result.ID = bookmark.ID
+	}
+
+	result.Status = SyncApplied
+	return loadSyncBookmark(tx, op.UserID, result)
+}
+
+// applySyncChange applies an update or delete made by a sync client that last synced at the
+// cursor.
+func applySyncChange(tx *gorm.DB, op models.Operation, cursor int64, change SyncChange, result *SyncResult) error {
+	var bookmark models.Bookmark
+	err := tx.Unscoped().Where("id = ?", change.ID).Scopes(AccessibleBy(op.UserID, models.RoleViewer)).First(&bookmark).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		result.Status = SyncNotFound
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	editable, err := canEditFolder(tx, op.UserID, bookmark.UserID, bookmark.Folder)
+	if err != nil {
+		return err
+	}
+	if folder, ok := change.Fields["folder"]; ok && editable {
+		editable, err = canEditFolder(tx, op.UserID, bookmark.UserID, folder)
+		if err != nil {
+			return err
+		}
+	}
+	if !editable {
+		result.Status, result.Error, result.Bookmark = SyncForbidden, ErrPermissionDenied.Error(), &bookmark
+		return nil
+	}
+
+	if bookmark.DeletedAt.Valid {
+		result.Status = SyncApplied
+		if change.Action == SyncUpdate {
+			result.Status, result.Bookmark = SyncConflict, &bookmark
+		}
+		return nil
+	}
+
+	// The fields changed on the server since the client last synced
+	current := syncFields(bookmark.State())
+	synced := current
+	var first models.Revision
+	err = tx.Where("bookmark_id = ? AND id > ?", bookmark.ID, cursor).Order("id").Limit(1).Find(&first).Error
+	if err != nil {
+		return err
+	}
+	if first.ID != 0 {
+		synced = map[string]string{}
+		if first.Before != nil {
+			synced = syncFields(*first.Before)
+		}
+	}
+	serverChanged := map[string]bool{}
+	for _, column := range syncColumns {
+		serverChanged[column] = synced[column] != current[column]
+	}
+
+	if change.Action == SyncDelete {
+		for _, column := range syncColumns {
+			if serverChanged[column] {
+				result.Conflicts = append(result.Conflicts, column)
+			}
+		}
+		if len(result.Conflicts) > 0 {
+			result.Status, result.Bookmark = SyncConflict, &bookmark
+			return nil
+		}
+		result.Status = SyncApplied
+		return trackChanges(tx, op, []string{bookmark.ID}, func() error {
+			return tx.Where("id = ?", bookmark.ID).Delete(&models.Bookmark{}).Error
+		})
+	}
+
+	fields := map[string]string{}
+	for column, value := range change.Fields {
+		if column == "tags" {
+			value = models.JoinTags([]string{value})
+		}
+		if value == current[column] {
+			continue
+		}
+		if serverChanged[column] {
+			result.Conflicts = append(result.Conflicts, column)
+			continue
+		}
+		fields[column] = value
+	}
+	if url, ok := fields["url"]; ok && !bookmark.Duplicate {
+		saved, err := savedBookmarkID(tx, bookmark.UserID, canonicalURL(url), bookmark.ID)
+		if err != nil {
+			return err
+		}
+		if saved != "" {
+			delete(fields, "url")
+			result.Conflicts = append(result.Conflicts, "url")
+		}
+	}
+
+	result.Status = SyncApplied
+	if len(result.Conflicts) > 0 {
+		result.Status = SyncConflict
+	}
+	if len(fields) > 0 {
+		err := trackChanges(tx, op, []string{bookmark.ID}, func() error {
+			if err := ensureFolder(tx, bookmark.UserID, fields["folder"]); err != nil {
+				return err
+			}
+			return tx.Model(&models.Bookmark{}).Where("id = ?", bookmark.ID).Updates(syncUpdates(fields)).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return loadSyncBookmark(tx, op.UserID, result)
+}
+
+// syncUpdates maps client fields to the bookmark columns they update.
+func syncUpdates(fields map[string]string) map[string]interface{} {
+	columns := map[string]interface{}{"last_modified": time.Now().Unix()}
+	for column, value := range fields {
+		switch column {
+		case "url":
+			columns["canonical_url"] = canonicalURL(value)
+		case "tags":
+			value = models.JoinTags([]string{value})
+		}
+		columns[column] = value
+	}
+	return columns
+}
+
+// loadSyncBookmark fills in the server copy of the bookmark of a result.
+func loadSyncBookmark(tx *gorm.DB, userID string, result *SyncResult) error {
+	var bookmark models.Bookmark
+	if err := tx.Where("id = ?", result.ID).Scopes(AccessibleBy(userID, models.RoleViewer)).First(&bookmark).Error; err != nil {
+		return err
+	}
+	result.Bookmark = &bookmark
+	return nil
+}
+
+// syncFields returns the values of the sync columns in a bookmark state.
+func syncFields(state models.BookmarkState) map[string]string {
+	return map[string]string{
+		"folder":      state.Folder,
+		"url":         state.URL,
+		"name":        state.Name,
+		"tags":        state.Tags,
+		"keyword":     state.Keyword,
+		"description": state.Description,
+		"notes":       state.Notes,
+	}
+}
+
+// syncOwners returns the users whose revisions a user syncs: the user and the owners of the
+// folders they are a member of.
+func syncOwners(userID string, memberships []membership) []string {
+	owners := []string{userID}
+	seen := map[string]bool{userID: true}
+	for _, m := range memberships {
+		if !seen[m.OwnerID] {
+			seen[m.OwnerID] = true
+			owners = append(owners, m.OwnerID)
+		}
+	}
+	return owners
+}
+
+// sharedRevision reports whether a revision of another user's bookmark changed it in a
+// folder shared through one of the memberships, before or after the change.
+func sharedRevision(memberships []membership, r models.Revision) bool {
+	for _, m := range memberships {
+		if m.OwnerID != r.UserID {
+			continue
+		}
+		if (r.Before != nil && folderContains(m.Path, r.Before.Folder)) || (r.After != nil && folderContains(m.Path, r.After.Folder)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSyncColumn(column string) bool {
+	for _, c := range syncColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+)
+
+// GetUsersTrash retrieves the deleted bookmarks of a user, most recently deleted first.
+func GetUsersTrash(userID string) ([]models.Bookmark, error) {
+	db := config.Cfg.GormDB
+
+	var bookmarks []models.Bookmark
+	result := db.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").
+		Find(&bookmarks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return bookmarks, nil
+}
+
+// RestoreBookmark moves a deleted bookmark of a user out of the trash. When the user saved
+// its URL again in the meantime, ErrBookmarkExists is returned.
+func RestoreBookmark(bookmarkID string, userID string) error {
+	db := config.Cfg.GormDB
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		op, err := beginOperation(tx, userID, models.OperationTrash)
+		if err != nil {
+			return err
+		}
+		return trackChanges(tx, op, []string{bookmarkID}, func() error {
+			if err := checkURLNotSaved(tx, bookmarkID, ""); err != nil {
+				return err
+			}
+			result := tx.Unscoped().Model(&models.Bookmark{}).
+				Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", bookmarkID, userID).
+				Update("deleted_at", nil)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrBookmarkNotFound
+			}
+			return nil
+		})
+	})
+}
+
+// PurgeBookmark permanently deletes a bookmark of a user that is in the trash, with its visit
+// statistics. Its archive is left for jobs.RemoveOrphanedArchives.
+func PurgeBookmark(bookmarkID string, userID string) error {
+	db := config.Cfg.GormDB
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		op, err := beginOperation(tx, userID, models.OperationTrash)
+		if err != nil {
+			return err
+		}
+		return trackChanges(tx, op, []string{bookmarkID}, func() error {
+			result := tx.Unscoped().
+				Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", bookmarkID, userID).
+				Delete(&models.Bookmark{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrBookmarkNotFound
+			}
+			return tx.Where("bookmark_id = ?", bookmarkID).Delete(&models.BookmarkVisit{}).Error
+		})
+	})
+}
+
+// EmptyTrash permanently deletes every bookmark in a user's trash, with their visit
+// statistics, and returns how many were deleted. Their archives are left for
+// jobs.RemoveOrphanedArchives.
+func EmptyTrash(userID string) (int64, error) {
+	db := config.Cfg.GormDB
+
+	var purged int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Unscoped().Model(&models.Bookmark{}).Where("user_id = ? AND deleted_at IS NOT NULL", userID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		op, err := beginOperation(tx, userID, models.OperationTrash)
+		if err != nil {
+			return err
+		}
+		return trackChanges(tx, op, ids, func() error {
+			result := tx.Unscoped().Where("id IN ? AND user_id = ?", ids, userID).Delete(&models.Bookmark{})
+			if result.Error != nil {
+				return result.Error
+			}
+			purged = result.RowsAffected
+			return tx.Where("bookmark_id IN ?", ids).Delete(&models.BookmarkVisit{}).Error
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// PurgeTrash permanently deletes the bookmarks of every user that were deleted before
+// the given time, with their visit statistics, and returns how many were deleted. Their
+// history is kept, but purging them is not recorded as an operation of the user. Their
+// archives are left for jobs.RemoveOrphanedArchives.
+func PurgeTrash(deletedBefore time.Time) (int64, error) {
+	db := config.Cfg.GormDB
+
+	var purged int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&models.Bookmark{}).Select("id").Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore)
+		if err := tx.Where("bookmark_id IN (?)", expired).Delete(&models.BookmarkVisit{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).Delete(&models.Bookmark{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
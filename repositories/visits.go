@@ -0,0 +1,193 @@
+package repositories
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Visits are counted in Redis hashes keyed by bookmark ID, one with the number of visits and
+// one with the Unix time of the last visit, until they are flushed to the database. While a
+// flush runs, the counters it works on are kept under the flushing keys.
+const (
+	visitCountsKey         = "visits:counts"
+	visitTimesKey          = "visits:times"
+	flushingVisitCountsKey = "visits:flushing:counts"
+	flushingVisitTimesKey  = "visits:flushing:times"
+)
+
+// GetBookmark retrieves a bookmark by its ID.
+func GetBookmark(bookmarkID string) (models.Bookmark, error) {
+	db := config.Cfg.GormDB
+
+	var bookmark models.Bookmark
+	result := db.Where("id = ?", bookmarkID).First(&bookmark)
+	if result.Error == gorm.ErrRecordNotFound {
+		return bookmark, ErrBookmarkNotFound
+	}
+	if result.Error != nil {
+		return bookmark, result.Error
+	}
+
+	return bookmark, nil
+}
+
+// RecordVisit counts a visit to a bookmark. The count reaches the database with the next
+// FlushVisits.
+func RecordVisit(bookmarkID string, at time.Time) error {
+	pipe := config.Cfg.RedisClient.TxPipeline()
+	pipe.HIncrBy(visitCountsKey, bookmarkID, 1)
+	pipe.HSet(visitTimesKey, bookmarkID, at.Unix())
+	_, err := pipe.Exec()
+	return err
+}
+
+// FlushVisits adds the visits counted in Redis to the visit statistics of the bookmarks and
+// returns the number of bookmarks updated. Visits to bookmarks that no longer exist are
+// dropped, as are the statistics of purged bookmarks.
+//
+// Counters that failed to reach the database are retried by the next flush. Should Redis
+// fail after the database was updated, those visits are counted twice.
+func FlushVisits(halfLife time.Duration) (int, error) {
+	db := config.Cfg.GormDB
+	rdb := config.Cfg.RedisClient
+
+	flushing, err := rdb.Exists(flushingVisitCountsKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	if flushing == 0 {
+		// Take the counters over, so visits recorded meanwhile start new ones
+		pipe := rdb.TxPipeline()
+		pipe.Rename(visitCountsKey, flushingVisitCountsKey)
+		pipe.Rename(visitTimesKey, flushingVisitTimesKey)
+		if _, err := pipe.Exec(); err != nil {
+			if strings.Contains(err.Error(), "no such key") {
+				return 0, nil
+			}
+			return 0, err
+		}
+	}
+
+	counts, err := rdb.HGetAll(flushingVisitCountsKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	times, err := rdb.HGetAll(flushingVisitTimesKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+
+	updated := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(ids); start += bulkBatchSize {
+			batch := ids[start:minInt(start+bulkBatchSize, len(ids))]
+
+			var existing []string
+			if err := tx.Unscoped().Model(&models.Bookmark{}).Where("id IN ?", batch).Pluck("id", &existing).Error; err != nil {
+				return err
+			}
+			var saved []models.BookmarkVisit
+			if err := tx.Where("bookmark_id IN ?", existing).Find(&saved).Error; err != nil {
+				return err
+			}
+			visits := make(map[string]*models.BookmarkVisit, len(existing))
+			for i := range saved {
+				visits[saved[i].BookmarkID] = &saved[i]
+			}
+
+			changed := make([]models.BookmarkVisit, 0, len(existing))
+			for _, id := range existing {
+				count, err := strconv.ParseInt(counts[id], 10, 64)
+				if err != nil {
+					continue
+				}
+				at := time.Now()
+				if unix, err := strconv.ParseInt(times[id], 10, 64); err == nil {
+					at = time.Unix(unix, 0)
+				}
+				visit, ok := visits[id]
+				if !ok {
+					visit = &models.BookmarkVisit{BookmarkID: id}
+				}
+				visit.AddVisits(count, at, halfLife)
+				changed = append(changed, *visit)
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&changed).Error; err != nil {
+				return err
+			}
+			updated += len(changed)
+		}
+
+		return tx.Where("bookmark_id NOT IN (SELECT id FROM bookmarks)").Delete(&models.BookmarkVisit{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := rdb.Del(flushingVisitCountsKey, flushingVisitTimesKey).Err(); err != nil {
+		return updated, err
+	}
+
+	return updated, nil
+}
+
+// GetMostUsedBookmarks retrieves the visited bookmarks a user can see, highest frecency first.
+func GetMostUsedBookmarks(userID string, limit int) ([]models.Bookmark, error) {
+	return GetUsersBookmarks(userID, Visited(), OrderByFrecency(), limitScope(limit))
+}
+
+// GetRecentlyVisitedBookmarks retrieves the visited bookmarks a user can see, most recently
+// visited first.
+func GetRecentlyVisitedBookmarks(userID string, limit int) ([]models.Bookmark, error) {
+	return GetUsersBookmarks(userID, Visited(), OrderByLastVisit(), limitScope(limit))
+}
+
+// WithVisits adds the visit statistics to the bookmarks loaded by a bookmark query. The
+// other visit scopes rely on it.
+func WithVisits() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Select("bookmarks.*, COALESCE(bookmark_visits.visit_count, 0) AS visit_count, bookmark_visits.last_visited_at, COALESCE(bookmark_visits.frecency, 0) AS frecency").
+			Joins("LEFT JOIN bookmark_visits ON bookmark_visits.bookmark_id = bookmarks.id")
+	}
+}
+
+// Visited limits a bookmark query to bookmarks that were visited.
+func Visited() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("bookmark_visits.visit_count > 0")
+	}
+}
+
+// OrderByFrecency sorts a bookmark query by frecency, highest first, then newest first.
+func OrderByFrecency() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order("COALESCE(bookmark_visits.frecency, 0) DESC, bookmarks.created_at DESC")
+	}
+}
+
+// OrderByLastVisit sorts a bookmark query by the time of the last visit, most recent first.
+// Bookmarks never visited come last.
+func OrderByLastVisit() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order("bookmark_visits.last_visited_at IS NULL, bookmark_visits.last_visited_at DESC, bookmarks.created_at DESC")
+	}
+}
+
+func limitScope(limit int) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Limit(limit)
+	}
+}
@@ -12,13 +12,248 @@ CREATE TABLE bookmarks (
     user_id string,
     folder TEXT,
     url TEXT,
+    canonical_url TEXT,
+    duplicate BOOLEAN DEFAULT 0,
     add_date INTEGER,
+    last_modified INTEGER,
     icon TEXT,
+    icon_hash TEXT DEFAULT '',
     name TEXT,
+    tags TEXT,
+    keyword TEXT,
+    notes TEXT DEFAULT '',
+    description TEXT DEFAULT '',
+    image TEXT DEFAULT '',
+    lang TEXT DEFAULT '',
+    metadata TEXT DEFAULT '',
+    metadata_fetched_at DATETIME,
+    http_status INTEGER DEFAULT 0,
+    final_url TEXT DEFAULT '',
+    permanent_redirect BOOLEAN DEFAULT 0,
+    last_checked_at DATETIME,
+    check_failures INTEGER DEFAULT 0,
+    read_state TEXT DEFAULT '',
+    queue_position INTEGER DEFAULT 0,
+    read_at DATETIME,
+    reading_minutes INTEGER DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 1,
     created_at DATETIME,
     updated_at DATETIME,
     deleted_at DATETIME,
     FOREIGN KEY (user_id) REFERENCES users (id)
 );
 
-CREATE UNIQUE INDEX "bookmark_user_id_url" ON "bookmarks" ("user_id", "url");
\ No newline at end of file
+CREATE INDEX "bookmark_user_id_url" ON "bookmarks" ("user_id", "url");
+CREATE INDEX "bookmark_user_id_canonical_url" ON "bookmarks" ("user_id", "canonical_url");
+-- One bookmark per canonical URL outside the trash, apart from the duplicates imports keep
+CREATE UNIQUE INDEX "bookmark_user_id_canonical_url_saved" ON "bookmarks" ("user_id", "canonical_url")
+    WHERE deleted_at IS NULL AND NOT duplicate AND canonical_url <> '';
+CREATE INDEX "bookmark_last_checked_at" ON "bookmarks" ("last_checked_at");
+CREATE INDEX "bookmark_metadata_fetched_at" ON "bookmarks" ("metadata_fetched_at");
+CREATE INDEX "bookmark_user_id_read_state" ON "bookmarks" ("user_id", "read_state");
+
+-- Every write to the columns users edit increments the version, unless the write sets it
+CREATE TRIGGER bookmark_version
+AFTER UPDATE OF folder, url, name, tags, keyword, description, notes, deleted_at ON bookmarks
+FOR EACH ROW WHEN NEW.version = OLD.version
+BEGIN
+    UPDATE bookmarks SET version = OLD.version + 1 WHERE id = NEW.id;
+END;
+
+CREATE TABLE folders (
+    id string PRIMARY KEY,
+    user_id string,
+    path TEXT NOT NULL,
+    add_date INTEGER,
+    last_modified INTEGER,
+    toolbar BOOLEAN DEFAULT 0,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX "folder_user_id_path" ON "folders" ("user_id", "path");
+
+CREATE TABLE jobs (
+    id string PRIMARY KEY,
+    user_id string,
+    kind TEXT NOT NULL,
+    status TEXT NOT NULL,
+    params TEXT,
+    result TEXT,
+    error TEXT,
+    processed INTEGER DEFAULT 0,
+    total INTEGER DEFAULT 0,
+    started_at DATETIME,
+    finished_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "job_user_id_kind" ON "jobs" ("user_id", "kind");
+CREATE INDEX "job_status" ON "jobs" ("status");
+
+CREATE TABLE icons (
+    hash TEXT PRIMARY KEY,
+    content_type TEXT NOT NULL,
+    data BLOB NOT NULL,
+    size INTEGER,
+    created_at DATETIME
+);
+
+CREATE TABLE archives (
+    id string PRIMARY KEY,
+    user_id string,
+    bookmark_id string,
+    url TEXT,
+    status TEXT NOT NULL,
+    title TEXT,
+    error TEXT,
+    html_key TEXT,
+    text_key TEXT,
+    size INTEGER DEFAULT 0,
+    archived_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id),
+    FOREIGN KEY (bookmark_id) REFERENCES bookmarks (id)
+);
+
+CREATE UNIQUE INDEX "archive_bookmark_id" ON "archives" ("bookmark_id");
+CREATE INDEX "archive_user_id" ON "archives" ("user_id");
+CREATE INDEX "archive_status" ON "archives" ("status");
+
+CREATE TABLE operations (
+    id string PRIMARY KEY,
+    user_id string,
+    kind TEXT NOT NULL,
+    undone_at DATETIME,
+    created_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "operation_user_id" ON "operations" ("user_id");
+
+CREATE TABLE revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    operation_id string,
+    user_id string,
+    bookmark_id string,
+    action TEXT NOT NULL,
+    before_state TEXT,
+    after_state TEXT,
+    created_at DATETIME,
+    FOREIGN KEY (operation_id) REFERENCES operations (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "revision_operation_id" ON "revisions" ("operation_id");
+CREATE INDEX "revision_bookmark_id" ON "revisions" ("bookmark_id");
+CREATE INDEX "revision_user_id" ON "revisions" ("user_id");
+
+CREATE TABLE shares (
+    id string PRIMARY KEY,
+    user_id string,
+    token TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    title TEXT DEFAULT '',
+    password_hash TEXT DEFAULT '',
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    access_count INTEGER DEFAULT 0,
+    last_accessed_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX "share_token" ON "shares" ("token");
+CREATE INDEX "share_user_id" ON "shares" ("user_id");
+
+CREATE TABLE folder_members (
+    id string PRIMARY KEY,
+    folder_id string,
+    user_id string,
+    role TEXT NOT NULL,
+    invited_by string,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (folder_id) REFERENCES folders (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX "folder_member_folder_id_user_id" ON "folder_members" ("folder_id", "user_id");
+CREATE INDEX "folder_member_user_id" ON "folder_members" ("user_id");
+
+CREATE TABLE folder_invitations (
+    id string PRIMARY KEY,
+    folder_id string,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    status TEXT NOT NULL,
+    invited_by string,
+    responded_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (folder_id) REFERENCES folders (id)
+);
+
+CREATE INDEX "folder_invitation_folder_id" ON "folder_invitations" ("folder_id");
+CREATE INDEX "folder_invitation_email" ON "folder_invitations" ("email");
+
+CREATE TABLE feeds (
+    id string PRIMARY KEY,
+    user_id string,
+    token TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    public BOOLEAN DEFAULT 0,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "feed_user_id" ON "feeds" ("user_id");
+
+CREATE TABLE bookmark_visits (
+    bookmark_id string PRIMARY KEY,
+    visit_count INTEGER DEFAULT 0,
+    last_visited_at DATETIME,
+    frecency REAL DEFAULT 0,
+    FOREIGN KEY (bookmark_id) REFERENCES bookmarks (id)
+);
+
+CREATE TABLE saved_searches (
+    id string PRIMARY KEY,
+    user_id string,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX "saved_search_user_id_name" ON "saved_searches" ("user_id", "name");
+
+CREATE TABLE rules (
+    id string PRIMARY KEY,
+    user_id string,
+    name TEXT NOT NULL DEFAULT '',
+    position INTEGER DEFAULT 0,
+    enabled BOOLEAN DEFAULT 1,
+    domain TEXT NOT NULL DEFAULT '',
+    url_pattern TEXT NOT NULL DEFAULT '',
+    title_contains TEXT NOT NULL DEFAULT '',
+    folder TEXT NOT NULL DEFAULT '',
+    add_tags TEXT NOT NULL DEFAULT '',
+    name_template TEXT NOT NULL DEFAULT '',
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "rule_user_id" ON "rules" ("user_id");
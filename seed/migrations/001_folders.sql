@@ -0,0 +1,18 @@
+ALTER TABLE bookmarks ADD COLUMN last_modified INTEGER;
+ALTER TABLE bookmarks ADD COLUMN tags TEXT;
+ALTER TABLE bookmarks ADD COLUMN keyword TEXT;
+
+CREATE TABLE folders (
+    id string PRIMARY KEY,
+    user_id string,
+    path TEXT NOT NULL,
+    add_date INTEGER,
+    last_modified INTEGER,
+    toolbar BOOLEAN DEFAULT 0,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX "folder_user_id_path" ON "folders" ("user_id", "path");
@@ -0,0 +1,3 @@
+-- Imports can keep both copies of a URL, so the URL index is no longer unique.
+DROP INDEX IF EXISTS "bookmark_user_id_url";
+CREATE INDEX "bookmark_user_id_url" ON "bookmarks" ("user_id", "url");
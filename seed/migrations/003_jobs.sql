@@ -0,0 +1,19 @@
+CREATE TABLE jobs (
+    id string PRIMARY KEY,
+    user_id string,
+    kind TEXT NOT NULL,
+    status TEXT NOT NULL,
+    params TEXT,
+    result TEXT,
+    error TEXT,
+    processed INTEGER DEFAULT 0,
+    total INTEGER DEFAULT 0,
+    started_at DATETIME,
+    finished_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "job_user_id_kind" ON "jobs" ("user_id", "kind");
+CREATE INDEX "job_status" ON "jobs" ("status");
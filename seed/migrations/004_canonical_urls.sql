@@ -0,0 +1,3 @@
+-- Existing rows are filled in by the CanonicalURLs cron job.
+ALTER TABLE bookmarks ADD COLUMN canonical_url TEXT;
+CREATE INDEX "bookmark_user_id_canonical_url" ON "bookmarks" ("user_id", "canonical_url");
@@ -0,0 +1,6 @@
+ALTER TABLE bookmarks ADD COLUMN http_status INTEGER DEFAULT 0;
+ALTER TABLE bookmarks ADD COLUMN final_url TEXT DEFAULT '';
+ALTER TABLE bookmarks ADD COLUMN permanent_redirect BOOLEAN DEFAULT 0;
+ALTER TABLE bookmarks ADD COLUMN last_checked_at DATETIME;
+ALTER TABLE bookmarks ADD COLUMN check_failures INTEGER DEFAULT 0;
+CREATE INDEX "bookmark_last_checked_at" ON "bookmarks" ("last_checked_at");
@@ -0,0 +1,6 @@
+ALTER TABLE bookmarks ADD COLUMN description TEXT DEFAULT '';
+ALTER TABLE bookmarks ADD COLUMN image TEXT DEFAULT '';
+ALTER TABLE bookmarks ADD COLUMN lang TEXT DEFAULT '';
+ALTER TABLE bookmarks ADD COLUMN metadata TEXT DEFAULT '';
+ALTER TABLE bookmarks ADD COLUMN metadata_fetched_at DATETIME;
+CREATE INDEX "bookmark_metadata_fetched_at" ON "bookmarks" ("metadata_fetched_at");
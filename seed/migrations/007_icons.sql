@@ -0,0 +1,8 @@
+CREATE TABLE icons (
+    hash TEXT PRIMARY KEY,
+    content_type TEXT NOT NULL,
+    data BLOB NOT NULL,
+    size INTEGER,
+    created_at DATETIME
+);
+ALTER TABLE bookmarks ADD COLUMN icon_hash TEXT DEFAULT '';
@@ -0,0 +1,21 @@
+CREATE TABLE archives (
+    id string PRIMARY KEY,
+    user_id string,
+    bookmark_id string,
+    url TEXT,
+    status TEXT NOT NULL,
+    title TEXT,
+    error TEXT,
+    html_key TEXT,
+    text_key TEXT,
+    size INTEGER DEFAULT 0,
+    archived_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id),
+    FOREIGN KEY (bookmark_id) REFERENCES bookmarks (id)
+);
+
+CREATE UNIQUE INDEX "archive_bookmark_id" ON "archives" ("bookmark_id");
+CREATE INDEX "archive_user_id" ON "archives" ("user_id");
+CREATE INDEX "archive_status" ON "archives" ("status");
@@ -0,0 +1 @@
+ALTER TABLE bookmarks ADD COLUMN notes TEXT DEFAULT '';
@@ -0,0 +1,27 @@
+CREATE TABLE operations (
+    id string PRIMARY KEY,
+    user_id string,
+    kind TEXT NOT NULL,
+    undone_at DATETIME,
+    created_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "operation_user_id" ON "operations" ("user_id");
+
+CREATE TABLE revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    operation_id string,
+    user_id string,
+    bookmark_id string,
+    action TEXT NOT NULL,
+    before_state TEXT,
+    after_state TEXT,
+    created_at DATETIME,
+    FOREIGN KEY (operation_id) REFERENCES operations (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "revision_operation_id" ON "revisions" ("operation_id");
+CREATE INDEX "revision_bookmark_id" ON "revisions" ("bookmark_id");
+CREATE INDEX "revision_user_id" ON "revisions" ("user_id");
@@ -0,0 +1,8 @@
+ALTER TABLE bookmarks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- Every write to a bookmark increments its version, unless the write sets it
+CREATE TRIGGER bookmark_version AFTER UPDATE ON bookmarks
+FOR EACH ROW WHEN NEW.version = OLD.version
+BEGIN
+    UPDATE bookmarks SET version = OLD.version + 1 WHERE id = NEW.id;
+END;
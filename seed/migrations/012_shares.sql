@@ -0,0 +1,19 @@
+CREATE TABLE shares (
+    id string PRIMARY KEY,
+    user_id string,
+    token TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    title TEXT DEFAULT '',
+    password_hash TEXT DEFAULT '',
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    access_count INTEGER DEFAULT 0,
+    last_accessed_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX "share_token" ON "shares" ("token");
+CREATE INDEX "share_user_id" ON "shares" ("user_id");
@@ -0,0 +1,30 @@
+CREATE TABLE folder_members (
+    id string PRIMARY KEY,
+    folder_id string,
+    user_id string,
+    role TEXT NOT NULL,
+    invited_by string,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (folder_id) REFERENCES folders (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX "folder_member_folder_id_user_id" ON "folder_members" ("folder_id", "user_id");
+CREATE INDEX "folder_member_user_id" ON "folder_members" ("user_id");
+
+CREATE TABLE folder_invitations (
+    id string PRIMARY KEY,
+    folder_id string,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    status TEXT NOT NULL,
+    invited_by string,
+    responded_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (folder_id) REFERENCES folders (id)
+);
+
+CREATE INDEX "folder_invitation_folder_id" ON "folder_invitations" ("folder_id");
+CREATE INDEX "folder_invitation_email" ON "folder_invitations" ("email");
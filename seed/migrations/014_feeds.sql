@@ -0,0 +1,14 @@
+CREATE TABLE feeds (
+    id string PRIMARY KEY,
+    user_id string,
+    token TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    public BOOLEAN DEFAULT 0,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "feed_user_id" ON "feeds" ("user_id");
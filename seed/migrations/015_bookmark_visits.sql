@@ -0,0 +1,7 @@
+CREATE TABLE bookmark_visits (
+    bookmark_id string PRIMARY KEY,
+    visit_count INTEGER DEFAULT 0,
+    last_visited_at DATETIME,
+    frecency REAL DEFAULT 0,
+    FOREIGN KEY (bookmark_id) REFERENCES bookmarks (id)
+);
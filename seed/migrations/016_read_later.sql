@@ -0,0 +1,6 @@
+ALTER TABLE bookmarks ADD COLUMN read_state TEXT DEFAULT '';
+ALTER TABLE bookmarks ADD COLUMN queue_position INTEGER DEFAULT 0;
+ALTER TABLE bookmarks ADD COLUMN read_at DATETIME;
+ALTER TABLE bookmarks ADD COLUMN reading_minutes INTEGER DEFAULT 0;
+
+CREATE INDEX "bookmark_user_id_read_state" ON "bookmarks" ("user_id", "read_state");
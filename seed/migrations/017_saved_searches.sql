@@ -0,0 +1,11 @@
+CREATE TABLE saved_searches (
+    id string PRIMARY KEY,
+    user_id string,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL,
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX "saved_search_user_id_name" ON "saved_searches" ("user_id", "name");
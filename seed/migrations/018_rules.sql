@@ -0,0 +1,18 @@
+CREATE TABLE rules (
+    id string PRIMARY KEY,
+    user_id string,
+    name TEXT NOT NULL DEFAULT '',
+    position INTEGER DEFAULT 0,
+    enabled BOOLEAN DEFAULT 1,
+    domain TEXT NOT NULL DEFAULT '',
+    url_pattern TEXT NOT NULL DEFAULT '',
+    title_contains TEXT NOT NULL DEFAULT '',
+    folder TEXT NOT NULL DEFAULT '',
+    add_tags TEXT NOT NULL DEFAULT '',
+    name_template TEXT NOT NULL DEFAULT '',
+    created_at DATETIME,
+    updated_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX "rule_user_id" ON "rules" ("user_id");
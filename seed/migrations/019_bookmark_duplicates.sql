@@ -0,0 +1,17 @@
+-- Imports that keep both copies of a URL mark the imported copy as a duplicate, so a user
+-- otherwise has one bookmark per canonical URL outside the trash.
+ALTER TABLE bookmarks ADD COLUMN duplicate BOOLEAN DEFAULT 0;
+
+-- Of the bookmarks already sharing a canonical URL, the oldest one is kept as the original
+UPDATE bookmarks SET duplicate = 1
+WHERE deleted_at IS NULL AND canonical_url <> '' AND EXISTS (
+    SELECT 1 FROM bookmarks original
+    WHERE original.user_id = bookmarks.user_id
+        AND original.canonical_url = bookmarks.canonical_url
+        AND original.deleted_at IS NULL
+        AND (original.created_at < bookmarks.created_at
+            OR (original.created_at = bookmarks.created_at AND original.id < bookmarks.id))
+);
+
+CREATE UNIQUE INDEX "bookmark_user_id_canonical_url_saved" ON "bookmarks" ("user_id", "canonical_url")
+    WHERE deleted_at IS NULL AND NOT duplicate AND canonical_url <> '';
@@ -0,0 +1,10 @@
+-- Only writes to the columns users edit increment the version. Link checks, metadata,
+-- reading time and the reading queue no longer make synced clients see a conflict.
+DROP TRIGGER bookmark_version;
+
+CREATE TRIGGER bookmark_version
+AFTER UPDATE OF folder, url, name, tags, keyword, description, notes, deleted_at ON bookmarks
+FOR EACH ROW WHEN NEW.version = OLD.version
+BEGIN
+    UPDATE bookmarks SET version = OLD.version + 1 WHERE id = NEW.id;
+END;
@@ -0,0 +1,141 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/config"
+	"github.com/jasonbronson/kwikportal-api/jobs"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// archiveCSP keeps archived pages from running scripts or loading anything but images.
+const archiveCSP = "default-src 'none'; img-src http: https: data:; style-src 'unsafe-inline'; sandbox allow-popups allow-popups-to-escape-sandbox"
+
+// requestArchive queues a bookmarked page to be archived, or archived again.
+// The response is 202 Accepted with the archive, which is fetched by a background job.
+func requestArchive(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	bookmark, err := repositories.GetUsersBookmark(g.Param("id"), userID)
+	if err == nil && bookmark.UserID != userID {
+		// Archives count against their owner's quota, so only owners archive bookmarks
+		err = repositories.ErrBookmarkNotFound
+	}
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmark: %v", err))
+		return
+	}
+
+	archive, err := repositories.RequestArchive(bookmark)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to request archive: %v", err))
+		return
+	}
+
+	g.JSON(http.StatusAccepted, archive)
+}
+
+// getArchive serves the archived snapshot of a bookmark. With format=text the plain text
+// is returned instead, and with format=json the archive status.
+//
+// While the first snapshot is still being fetched, or when fetching it failed, the archive
+// status is returned with 202 Accepted or 404 Not Found.
+func getArchive(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	archive, err := repositories.GetUsersArchive(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrArchiveNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load archive: %v", err))
+		return
+	}
+
+	format := g.DefaultQuery("format", "html")
+	if format == "json" {
+		responseData(g, archive)
+		return
+	}
+	if archive.HTMLKey == "" {
+		status := http.StatusAccepted
+		if archive.Status == models.ArchiveFailed {
+			status = http.StatusNotFound
+		}
+		g.JSON(status, archive)
+		return
+	}
+
+	key, contentType := archive.HTMLKey, "text/html; charset=utf-8"
+	switch format {
+	case "html":
+	case "text":
+		key, contentType = archive.TextKey, "text/plain; charset=utf-8"
+	default:
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown archive format %q", format)})
+		return
+	}
+
+	data, err := config.Cfg.Archive.Storage.Get(g.Request.Context(), key)
+	if errors.Is(err, library.ErrObjectNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": "archive snapshot is missing"})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to read archive: %v", err))
+		return
+	}
+
+	g.Header("Content-Security-Policy", archiveCSP)
+	g.Header("X-Content-Type-Options", "nosniff")
+	g.Data(http.StatusOK, contentType, data)
+}
+
+// deleteArchive removes the archive of a bookmark and its stored snapshot.
+func deleteArchive(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	archive, err := repositories.GetUsersArchive(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrArchiveNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load archive: %v", err))
+		return
+	}
+
+	if err := jobs.RemoveArchive(g.Request.Context(), archive); err != nil {
+		responseError(g, fmt.Errorf("Failed to delete archive: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"success": "Archive deleted successfully"})
+}
+
+// getArchiveUsage returns the storage used by the user's archives and the quota.
+func getArchiveUsage(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	usage, err := repositories.GetArchiveUsage(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load archive usage: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{
+		"archives":    usage.Archives,
+		"bytes":       usage.Bytes,
+		"quota_bytes": config.Cfg.Archive.QuotaBytes,
+	})
+}
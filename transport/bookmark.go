@@ -1,18 +1,26 @@
 package transport
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"math/rand"
+	"mime/multipart"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/formats"
+	"github.com/jasonbronson/kwikportal-api/jobs"
+	"github.com/jasonbronson/kwikportal-api/library"
 	"github.com/jasonbronson/kwikportal-api/models"
 	"github.com/jasonbronson/kwikportal-api/repositories"
-	"golang.org/x/net/html"
+	"gorm.io/gorm"
 )
 
 const (
@@ -24,6 +32,10 @@ const (
 //
 // It extracts the user data from the bearer token passed in the request header.
 // Using the user ID, it fetches the bookmarks associated with that user from the database.
+// The q parameter searches with the query language of repositories.SearchScope, answering
+// errors in the query with 400 and their position. The status query parameter limits the
+// list to "broken" or "redirected" links, and the sort parameter orders it by "frecency" or
+// by "recent" visits.
 // The bookmarks are then returned as a JSON response.
 //
 // If any error occurs during the retrieval process, an error response is returned instead.
@@ -31,23 +43,257 @@ func getBookmarks(g *gin.Context) {
 
 	userID := GetUserIDFromRequest(g)
 
-	bookmarks, err := repositories.GetUsersBookmarks(userID)
+	var filter bookmarkFilter
+	if err := g.ShouldBindQuery(&filter); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scopes, err := filter.scopes()
+	if err != nil {
+		g.JSON(http.StatusBadRequest, queryErrorBody(err))
+		return
+	}
+	if sort := g.Query("sort"); sort != "" {
+		order, ok := bookmarkSorts[sort]
+		if !ok {
+			g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown sort %q, expected frecency or recent", sort)})
+			return
+		}
+		scopes = append(scopes, order)
+	}
+
+	bookmarks, err := repositories.GetUsersBookmarks(userID, scopes...)
 	if err != nil {
 		responseError(g, err)
 		return
 	}
 	log.Println(bookmarks)
-	responseData(g, bookmarks)
+	renderNotes(bookmarks)
+	responseDataWithETag(g, bookmarks)
+}
+
+// getBookmark retrieves a bookmark of the authenticated user, or one in a folder shared with
+// them. The ETag header carries its version, to send back in If-Match when updating or
+// deleting it.
+func getBookmark(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	bookmark, err := repositories.GetUsersBookmark(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmark: %v", err))
+		return
+	}
+
+	etag := bookmarkETag(bookmark)
+	g.Header("ETag", etag)
+	g.Header("Cache-Control", "private, no-cache")
+	if etagMatches(g.GetHeader("If-None-Match"), etag) {
+		g.Status(http.StatusNotModified)
+		return
+	}
+	renderBookmarkNotes(&bookmark)
+	responseData(g, bookmark)
+}
+
+// bookmarkETag is the entity tag of a bookmark, which changes with its version.
+func bookmarkETag(bookmark models.Bookmark) string {
+	return fmt.Sprintf(`"%d"`, bookmark.Version)
+}
+
+// ifMatchVersion returns the bookmark version required by the If-Match header, or 0 when
+// the request does not require one. ok is false when the header lists no usable version.
+func ifMatchVersion(g *gin.Context) (version int64, ok bool) {
+	header := strings.TrimSpace(g.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// responsePreconditionFailed tells the client its version of a bookmark is out of date and
+// sends the current server copy.
+func responsePreconditionFailed(g *gin.Context, bookmarkID string, userID string) {
+	bookmark, err := repositories.GetUsersBookmark(bookmarkID, userID)
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmark: %v", err))
+		return
+	}
+
+	renderBookmarkNotes(&bookmark)
+	g.Header("ETag", bookmarkETag(bookmark))
+	g.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":    repositories.ErrVersionMismatch.Error(),
+		"bookmark": bookmark,
+	})
+}
+
+// bookmarkSorts are the orders the bookmark list can be sorted in.
+var bookmarkSorts = map[string]func(*gorm.DB) *gorm.DB{
+	"frecency": repositories.OrderByFrecency(),
+	"recent":   repositories.OrderByLastVisit(),
+}
+
+// bookmarkFilter selects bookmarks by search query (see repositories.SearchScope), folder
+// (including subfolders), tag, link status and read state, either from the query string or
+// from a JSON body.
+type bookmarkFilter struct {
+	Q         string `form:"q" json:"q"`
+	Folder    string `form:"folder" json:"folder"`
+	Tag       string `form:"tag" json:"tag"`
+	Status    string `form:"status" json:"status"`
+	ReadState string `form:"read_state" json:"read_state"`
+}
+
+// scopes returns the query scopes selecting the bookmarks that match the filter.
+func (f bookmarkFilter) scopes() ([]func(*gorm.DB) *gorm.DB, error) {
+	var scopes []func(*gorm.DB) *gorm.DB
+	if f.Q != "" {
+		scope, err := repositories.SearchScope(f.Q)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	if f.Folder != "" {
+		scopes = append(scopes, repositories.InFolder(f.Folder))
+	}
+	if f.Tag != "" {
+		scopes = append(scopes, repositories.WithTag(f.Tag))
+	}
+	switch f.Status {
+	case "":
+	case "broken":
+		scopes = append(scopes, repositories.IsBroken())
+	case "redirected":
+		scopes = append(scopes, repositories.IsRedirected())
+	default:
+		return nil, fmt.Errorf("Unknown status %q, expected broken or redirected", f.Status)
+	}
+	if f.ReadState != "" {
+		if !validReadState(f.ReadState) {
+			return nil, fmt.Errorf("Unknown read state %q, expected one of %v", f.ReadState, models.ReadStates)
+		}
+		scopes = append(scopes, repositories.InReadState(f.ReadState))
+	}
+	return scopes, nil
+}
+
+// renderNotes fills in the rendered HTML of the notes of bookmarks returned by the API.
+func renderNotes(bookmarks []models.Bookmark) {
+	for i := range bookmarks {
+		renderBookmarkNotes(&bookmarks[i])
+	}
+}
+
+// renderBookmarkNotes fills in the rendered HTML of the notes of a bookmark.
+func renderBookmarkNotes(bookmark *models.Bookmark) {
+	notes, err := library.RenderMarkdown(bookmark.Notes)
+	if err != nil {
+		log.Printf("renderNotes: failed to render notes of %v %v", bookmark.ID, err)
+		return
+	}
+	bookmark.NotesHTML = notes
+}
+
+// applyRedirects replaces the URL of every bookmark of the authenticated user that
+// permanently redirects with the URL it redirects to.
+func applyRedirects(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	updated, err := repositories.ApplyPermanentRedirects(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to update redirected bookmarks: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"updated": updated})
+}
+
+// refreshMetadata fetches the page metadata of a bookmark again and returns the updated
+// bookmark. Fields the user edited are kept.
+func refreshMetadata(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	bookmark, err := repositories.GetUsersBookmark(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmark: %v", err))
+		return
+	}
+	editable, err := repositories.CanEditBookmark(bookmark.ID, userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmark: %v", err))
+		return
+	}
+	if !editable {
+		g.JSON(http.StatusForbidden, gin.H{"error": repositories.ErrPermissionDenied.Error()})
+		return
+	}
+
+	bookmark, err = jobs.RefreshMetadata(g.Request.Context(), bookmark)
+	if err != nil {
+		g.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to fetch page metadata: %v", err)})
+		return
+	}
+
+	renderBookmarkNotes(&bookmark)
+	responseData(g, bookmark)
 }
 
 // UploadBookmarks handles the upload of bookmark data from a file.
 //
 // It expects the bookmark file to be included in the request as a form file parameter.
-// The file is saved to a temporary location and then parsed to extract the bookmark data.
-// The parsed bookmarks are then processed or saved as needed.
+// The optional format parameter names the file format (see formats.ImporterNames); when it
+// is missing the format is detected from the file contents.
+//
+// The mode parameter decides what happens to bookmarks that are already saved (see
+// repositories.ImportModes), skipping them by default. With dry_run=true nothing is saved
+// and the import report describes what the import would do.
 //
-// If any error occurs during the upload or parsing process, an error response is returned.
+// The file is stored and imported by a background job, so large files do not hold up the
+// request. The response is 202 Accepted with the job ID, which can be followed with
+// GET /members/imports/:id. If the upload itself fails, an error response is returned.
 func uploadBookmarks(g *gin.Context) {
+	params := jobs.ImportParams{
+		Format: g.PostForm("format"),
+		ImportOptions: repositories.ImportOptions{
+			Mode: g.DefaultPostForm("mode", repositories.ImportSkipExisting),
+		},
+	}
+	if !repositories.IsImportMode(params.Mode) {
+		g.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Unknown import mode %q", params.Mode),
+			"modes": repositories.ImportModes,
+		})
+		return
+	}
+	if params.Format != "" {
+		if _, err := formats.ImporterFor(params.Format); err != nil {
+			g.JSON(http.StatusBadRequest, gin.H{
+				"error":   err.Error(),
+				"formats": formats.ImporterNames(),
+			})
+			return
+		}
+	}
+	params.DryRun, _ = strconv.ParseBool(g.DefaultPostForm("dry_run", g.Query("dry_run")))
+
 	// Get the uploaded file from the form data
 	file, err := g.FormFile("bookmarkFile")
 	if err != nil {
@@ -55,38 +301,56 @@ func uploadBookmarks(g *gin.Context) {
 		return
 	}
 
-	// Generate a random filename
-	fileName := generateRandomFileName()
-
-	// Save the uploaded file to /tmp
-	if err := g.SaveUploadedFile(file, "/tmp/"+fileName); err != nil {
+	// Store the uploaded file under a random name until the import job has read it
+	data, err := readUploadedFile(file)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to read uploaded file"))
+		return
+	}
+	params.FileName = file.Filename
+	params.FileKey, err = jobs.SaveImportFile(g.Request.Context(), generateRandomFileName(), data)
+	if err != nil {
+		log.Printf("uploadBookmarks: failed to store upload %v", err)
 		responseError(g, fmt.Errorf("Failed to save uploaded file"))
 		return
 	}
 
-	// Parse the uploaded file and inject user_id into the rows as well
-	bookmarks, err := ParseBookmarks(g, "/tmp/"+fileName)
-	if err != nil {
-		responseError(g, fmt.Errorf("Failed to parse bookmarks"))
+	data, _ = json.Marshal(params)
+	job := models.Job{
+		UserID: GetUserIDFromRequest(g),
+		Kind:   models.JobKindImport,
+		Status: models.JobQueued,
+		Params: string(data),
+	}
+	if err := repositories.SaveJob(&job); err != nil {
+		removeImportFile(params.FileKey)
+		responseError(g, fmt.Errorf("Failed to create import job: %v", err))
 		return
 	}
 
-	log.Println("Attempting to save filename ", fileName)
-	var bookmarksUnique []models.Bookmark
-	for _, b := range bookmarks {
-		if !bookmarkExist(b.URL, bookmarksUnique) {
-			bookmarksUnique = append(bookmarksUnique, b)
+	log.Println("Queued import of file ", params.FileKey, " as job ", job.ID)
+	if err := jobs.EnqueueImport(job.ID); err != nil {
+		// Nothing will run the job, so it is not left queued with its file
+		job.Status = models.JobFailed
+		job.Error = fmt.Sprintf("failed to queue import: %v", err)
+		if err := repositories.FinishJob(&job); err != nil {
+			log.Printf("uploadBookmarks: failed to mark import %v failed %v", job.ID, err)
 		}
-	}
-	err = repositories.SaveAllBookmarks(bookmarksUnique)
-	if err != nil {
-		responseError(g, fmt.Errorf("Failed to save all bookmarks"))
+		removeImportFile(params.FileKey)
+		responseError(g, fmt.Errorf("Failed to queue import job: %v", err))
 		return
 	}
 
-	responseSuccess(g, "success", "ok")
+	g.JSON(http.StatusAccepted, importJobResponse(job))
 }
 
+// saveBookmark updates a bookmark of the authenticated user, or one in a folder they are an
+// editor of.
+//
+// The version to update is taken from the If-Match header, or else from the Version of the
+// bookmark in the body. When the bookmark has changed since, nothing is saved and
+// 412 Precondition Failed is returned with the current bookmark. Changing the URL to one
+// saved in another bookmark is a conflict.
 func saveBookmark(g *gin.Context) {
 	var bookmark models.Bookmark
 
@@ -97,13 +361,40 @@ func saveBookmark(g *gin.Context) {
 		responseError(g, fmt.Errorf("Failed to parse JSON body: %v", err))
 		return
 	}
+	if g.GetHeader("If-Match") != "" {
+		version, ok := ifMatchVersion(g)
+		if !ok {
+			responsePreconditionFailed(g, bookmark.ID, userID)
+			return
+		}
+		bookmark.Version = version
+	}
 
 	err := repositories.SaveBookmark(bookmark, userID)
+	if errors.Is(err, repositories.ErrVersionMismatch) {
+		responsePreconditionFailed(g, bookmark.ID, userID)
+		return
+	}
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrPermissionDenied) {
+		g.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrBookmarkExists) {
+		g.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		responseError(g, fmt.Errorf("Failed to save bookmark: %v", err))
 		return
 	}
 
+	if saved, err := repositories.GetUsersBookmark(bookmark.ID, userID); err == nil {
+		g.Header("ETag", bookmarkETag(saved))
+	}
 	responseSuccess(g, "success", "Bookmark saved successfully")
 }
 
@@ -123,8 +414,27 @@ func deleteBookmark(g *gin.Context) {
 		return
 	}
 
+	// Only delete the version the client has seen, when it says which one that is
+	version, ok := ifMatchVersion(g)
+	if !ok {
+		responsePreconditionFailed(g, bookmarkID, userID)
+		return
+	}
+
 	// Delete the bookmark
-	err := repositories.DeleteBookmark(bookmarkID, userID)
+	err := repositories.DeleteBookmark(bookmarkID, userID, version)
+	if errors.Is(err, repositories.ErrVersionMismatch) {
+		responsePreconditionFailed(g, bookmarkID, userID)
+		return
+	}
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrPermissionDenied) {
+		g.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		responseError(g, fmt.Errorf("Failed to delete bookmark: %v", err))
 		return
@@ -133,70 +443,21 @@ func deleteBookmark(g *gin.Context) {
 	responseSuccess(g, "success", "Bookmark deleted successfully")
 }
 
-// ParseBookmarks parses the bookmark data from the given file and returns a list of bookmarks.
-//
-// It reads the contents of the file, parses the HTML structure to extract the bookmark data,
-// and returns a list of structured bookmark objects.
-//
-// If any error occurs during the parsing process, an error is returned along with an empty list of bookmarks.
-func ParseBookmarks(g *gin.Context, filename string) ([]models.Bookmark, error) {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
-
-	doc, err := html.Parse(strings.NewReader(string(data)))
+// readUploadedFile reads the whole contents of an uploaded file.
+func readUploadedFile(file *multipart.FileHeader) ([]byte, error) {
+	f, err := file.Open()
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
 
-	var parse func(*html.Node) []models.Bookmark
-	parse = func(n *html.Node) []models.Bookmark {
-		var bookmarks []models.Bookmark
-
-		if n.Type == html.ElementNode && n.Data == "a" {
-			bookmark := models.Bookmark{}
-
-			bookmark.UserID = GetUserIDFromRequest(g)
-			for _, attr := range n.Attr {
-				switch attr.Key {
-				case "href":
-					var url string
-					if attr.Val == "" {
-						url = fmt.Sprintf("#%v", generateRandomFileName())
-					} else {
-						url = attr.Val
-					}
-					bookmark.URL = url
-				case "add_date":
-					addDate, err := strconv.ParseInt(attr.Val, 10, 64)
-					if err != nil {
-						return nil
-					}
-					bookmark.AddDate = addDate
-				case "icon":
-					bookmark.Icon = attr.Val
-				}
-			}
-
-			for c := n.FirstChild; c != nil; c = c.NextSibling {
-				if c.Type == html.TextNode {
-					bookmark.Name = c.Data
-					break
-				}
-			}
-
-			bookmarks = append(bookmarks, bookmark)
-		}
-
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			bookmarks = append(bookmarks, parse(c)...)
-		}
-
-		return bookmarks
+// removeImportFile deletes the stored upload of an import that will not run.
+func removeImportFile(key string) {
+	if err := jobs.RemoveImportFile(context.Background(), key); err != nil {
+		log.Printf("removeImportFile: failed to remove upload %v %v", key, err)
 	}
-
-	return parse(doc), nil
 }
 
 func generateRandomFileName() string {
@@ -209,12 +470,3 @@ func generateRandomFileName() string {
 
 	return string(b)
 }
-
-func bookmarkExist(url string, bookmarks []models.Bookmark) bool {
-	for _, b := range bookmarks {
-		if b.URL == url {
-			return true
-		}
-	}
-	return false
-}
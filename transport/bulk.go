@@ -0,0 +1,168 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/jobs"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+	"gorm.io/gorm"
+)
+
+// bulkJobThreshold is the number of bookmarks above which a bulk action runs as a
+// background job instead of within the request.
+const bulkJobThreshold = 500
+
+// bulkRequest selects bookmarks by ID or by filter and names the action to apply.
+type bulkRequest struct {
+	IDs    []string        `json:"ids"`
+	Filter *bookmarkFilter `json:"filter"`
+	repositories.BulkOperation
+}
+
+// bulkJob is the API representation of a bulk job.
+type bulkJob struct {
+	ID         string                   `json:"id"`
+	Status     string                   `json:"status"`
+	Action     string                   `json:"action"`
+	Processed  int                      `json:"processed"`
+	Total      int                      `json:"total"`
+	Error      string                   `json:"error,omitempty"`
+	Result     *repositories.BulkResult `json:"result,omitempty"`
+	CreatedAt  time.Time                `json:"created_at"`
+	StartedAt  *time.Time               `json:"started_at,omitempty"`
+	FinishedAt *time.Time               `json:"finished_at,omitempty"`
+}
+
+// bulkBookmarks applies one action to many bookmarks of the authenticated user.
+//
+// Bookmarks are selected by a list of ids or by a filter (see bookmarkFilter); restoring
+// with a filter selects among deleted bookmarks. The action is one of
+// repositories.BulkActions, with the destination folder for move and the tags for
+// add_tags and remove_tags.
+//
+// Small selections are applied in a single transaction and the per-item results are
+// returned. Larger selections are applied by a background job: the response is 202 Accepted
+// with the job, which can be followed with GET /members/bookmarks/bulk/:id.
+func bulkBookmarks(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	var request bulkRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+	if err := request.Validate(); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "actions": repositories.BulkActions})
+		return
+	}
+	if (len(request.IDs) > 0) == (request.Filter != nil) {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "Either ids or filter is required"})
+		return
+	}
+
+	ids := request.IDs
+	if request.Filter != nil {
+		scopes, err := request.Filter.scopes()
+		if err != nil {
+			g.JSON(http.StatusBadRequest, queryErrorBody(err))
+			return
+		}
+		ids, err = repositories.GetUsersBookmarkIDs(userID, request.Action == repositories.BulkRestore, scopes...)
+		if err != nil {
+			responseError(g, fmt.Errorf("Failed to select bookmarks: %v", err))
+			return
+		}
+	}
+
+	if len(ids) <= bulkJobThreshold {
+		result, err := repositories.ApplyBulk(userID, ids, request.BulkOperation, nil)
+		if err != nil {
+			responseError(g, fmt.Errorf("Failed to apply %v: %v", request.Action, err))
+			return
+		}
+		responseData(g, result)
+		return
+	}
+
+	data, err := json.Marshal(jobs.BulkParams{IDs: ids, BulkOperation: request.BulkOperation})
+	if err != nil {
+		responseError(g, err)
+		return
+	}
+	job := models.Job{
+		UserID: userID,
+		Kind:   models.JobKindBulk,
+		Status: models.JobQueued,
+		Params: string(data),
+		Total:  len(ids),
+	}
+	if err := repositories.SaveJob(&job); err != nil {
+		responseError(g, fmt.Errorf("Failed to create bulk job: %v", err))
+		return
+	}
+
+	log.Println("Queued bulk", request.Action, "of", len(ids), "bookmarks as job", job.ID)
+	if err := jobs.EnqueueBulk(job.ID); err != nil {
+		responseError(g, fmt.Errorf("Failed to queue bulk job: %v", err))
+		return
+	}
+
+	g.JSON(http.StatusAccepted, bulkJobResponse(job))
+}
+
+// getBulkJob reports the status, progress and results of a bulk job.
+func getBulkJob(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	job, err := repositories.GetUsersJob(g.Param("id"), userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && job.Kind != models.JobKindBulk) {
+		g.JSON(http.StatusNotFound, gin.H{"error": "Bulk job not found"})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bulk job: %v", err))
+		return
+	}
+
+	responseData(g, bulkJobResponse(job))
+}
+
+// bulkJobResponse converts a bulk job into its API representation.
+func bulkJobResponse(job models.Job) bulkJob {
+	var params jobs.BulkParams
+	json.Unmarshal([]byte(job.Params), &params)
+
+	response := bulkJob{
+		ID:         job.ID,
+		Status:     job.Status,
+		Action:     params.Action,
+		Processed:  job.Processed,
+		Total:      job.Total,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+	}
+
+	if job.Status == models.JobRunning {
+		if processed, total, ok := repositories.GetJobProgress(job.ID); ok {
+			response.Processed, response.Total = processed, total
+		}
+	}
+
+	if job.Result != "" {
+		var result repositories.BulkResult
+		if json.Unmarshal([]byte(job.Result), &result) == nil {
+			response.Result = &result
+		}
+	}
+
+	return response
+}
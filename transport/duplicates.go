@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// mergeRequest is the body of a duplicate merge request.
+type mergeRequest struct {
+	Keep string   `json:"keep"`
+	IDs  []string `json:"ids"`
+}
+
+// getDuplicates lists the bookmarks of the authenticated user that point to the same page,
+// grouped by their canonical URL.
+func getDuplicates(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	groups, err := repositories.GetUsersDuplicates(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to find duplicates: %v", err))
+		return
+	}
+
+	for i := range groups {
+		renderNotes(groups[i].Bookmarks)
+	}
+	responseData(g, groups)
+}
+
+// mergeDuplicates merges duplicate bookmarks into one.
+//
+// The body lists the bookmark IDs to merge and optionally the ID of the bookmark to keep;
+// the oldest bookmark is kept otherwise. The merged bookmark is returned.
+func mergeDuplicates(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	var request mergeRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+
+	bookmark, err := repositories.MergeBookmarks(userID, request.Keep, request.IDs)
+	if errors.Is(err, repositories.ErrBookmarkNotFound) || errors.Is(err, repositories.ErrNotDuplicates) {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to merge bookmarks: %v", err))
+		return
+	}
+
+	renderBookmarkNotes(&bookmark)
+	responseData(g, bookmark)
+}
@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/formats"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+	"gorm.io/gorm"
+)
+
+// exportBookmarks streams the bookmarks of the authenticated user as a downloadable file.
+//
+// The format query parameter selects the file format (see formats.ExporterNames). Without it
+// the format is negotiated from the Accept header, defaulting to a Netscape bookmark file.
+// An unknown format parameter is a bad request, while an Accept header that matches no
+// format is not acceptable.
+// The CSV export takes a comma separated list of columns in the columns parameter.
+// The export can be limited to a folder (including its subfolders) with the folder
+// parameter, to a single tag with the tag parameter, and to the bookmarks matching a saved
+// search with the search parameter, its ID.
+// Only bookmarks owned by the user are exported. Bookmarks in folders shared with the user
+// belong to the export of their owner.
+//
+// Bookmarks are written to the response while they are read from the database, so
+// errors after the first row can only be logged.
+func exportBookmarks(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	exporter, err := exporterFromRequest(g)
+	if err != nil {
+		status := http.StatusNotAcceptable
+		if g.Query("format") != "" {
+			status = http.StatusBadRequest
+		}
+		g.JSON(status, gin.H{
+			"error":   err.Error(),
+			"formats": formats.ExporterNames(),
+		})
+		return
+	}
+
+	var options formats.ExportOptions
+	if columns := g.Query("columns"); columns != "" {
+		options.Columns = strings.Split(columns, ",")
+	}
+
+	var scopes []func(*gorm.DB) *gorm.DB
+	var folderScopes []func(*gorm.DB) *gorm.DB
+	if folder := g.Query("folder"); folder != "" {
+		scopes = append(scopes, repositories.InFolder(folder))
+		folderScopes = append(folderScopes, repositories.FolderWithin(folder))
+	}
+	if tag := g.Query("tag"); tag != "" {
+		scopes = append(scopes, repositories.WithTag(tag))
+	}
+	if searchID := g.Query("search"); searchID != "" {
+		search, ok := savedSearchTarget(g, searchID, userID)
+		if !ok {
+			return
+		}
+		scope, err := repositories.SearchScope(search.Query)
+		if err != nil {
+			g.JSON(http.StatusBadRequest, queryErrorBody(err))
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	// Empty folders are only part of the export when it is not limited to a tag or search
+	var folders []models.Folder
+	if g.Query("tag") == "" && g.Query("search") == "" {
+		folders, err = repositories.GetUsersFolders(userID, folderScopes...)
+		if err != nil {
+			responseError(g, fmt.Errorf("Failed to load folders: %v", err))
+			return
+		}
+	}
+
+	writer, err := exporter.NewWriter(g.Writer, folders, options)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	g.Header("Content-Type", exporter.ContentType()+"; charset=UTF-8")
+	g.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="bookmarks.%v"`, exporter.Extension()))
+	g.Status(http.StatusOK)
+
+	// Icons are written inline, as data URIs, so the export stands on its own
+	err = repositories.ScanUsersBookmarksWithIcons(userID, writer.Write, scopes...)
+	if err != nil {
+		log.Printf("exportBookmarks: failed to stream bookmarks %v", err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("exportBookmarks: failed to finish export %v", err)
+	}
+}
+
+// exporterFromRequest picks the exporter named by the format parameter, or the one
+// matching the Accept header.
+func exporterFromRequest(g *gin.Context) (formats.Exporter, error) {
+	if format := g.Query("format"); format != "" {
+		return formats.ExporterFor(format)
+	}
+	contentType := g.NegotiateFormat(formats.ExporterContentTypes()...)
+	if contentType == "" {
+		return nil, fmt.Errorf("%w %q", formats.ErrUnknownFormat, g.GetHeader("Accept"))
+	}
+	return formats.ExporterForContentType(contentType)
+}
@@ -0,0 +1,304 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/formats"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// feedItemLimit is the number of newest bookmarks a feed publishes.
+const feedItemLimit = 50
+
+// feedRequest describes a feed to create.
+type feedRequest struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Title  string `json:"title"`
+	Public bool   `json:"public"`
+}
+
+// createFeed creates a feed of the newest bookmarks of the authenticated user: all of them,
+// those in a folder, those with a tag or those matching a saved search. The feed is read at /feeds/{id}/{format}, with
+// format one of formats.FeedWriterNames; private feeds also need ?token={token}.
+func createFeed(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	var request feedRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+	if request.Kind == "" {
+		request.Kind = models.FeedCollection
+	}
+	if request.Kind == models.FeedCollection {
+		request.Target = ""
+	} else if request.Target == "" {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "target is required"})
+		return
+	}
+
+	token, err := library.RandomToken(shareTokenBytes)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to create feed token: %v", err))
+		return
+	}
+	feed := models.Feed{
+		UserID: userID,
+		Token:  token,
+		Kind:   request.Kind,
+		Target: request.Target,
+		Title:  request.Title,
+		Public: request.Public,
+	}
+	if feed.Kind == models.FeedSearch {
+		search, ok := savedSearchTarget(g, feed.Target, userID)
+		if !ok {
+			return
+		}
+		if feed.Title == "" {
+			feed.Title = search.Name
+		}
+	}
+	if feed.Title == "" {
+		feed.Title = feed.Target
+	}
+	if feed.Title == "" {
+		feed.Title = "Bookmarks"
+	}
+
+	if _, err := repositories.FeedScope(feed); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := repositories.SaveFeed(&feed); err != nil {
+		responseError(g, fmt.Errorf("Failed to save feed: %v", err))
+		return
+	}
+
+	g.JSON(http.StatusCreated, feed)
+}
+
+// getFeeds lists the feeds of the authenticated user.
+func getFeeds(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	feeds, err := repositories.GetUsersFeeds(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load feeds: %v", err))
+		return
+	}
+
+	responseData(g, feeds)
+}
+
+// rotateFeedToken gives a feed of the authenticated user a new secret token, so readers
+// subscribed with the old one lose access.
+func rotateFeedToken(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	token, err := library.RandomToken(shareTokenBytes)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to create feed token: %v", err))
+		return
+	}
+
+	err = repositories.SetFeedToken(g.Param("id"), userID, token)
+	if errors.Is(err, repositories.ErrFeedNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to update feed: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"token": token})
+}
+
+// deleteFeed deletes a feed of the authenticated user.
+func deleteFeed(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	err := repositories.DeleteFeed(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrFeedNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to delete feed: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"success": "Feed deleted successfully"})
+}
+
+// getFeed serves a feed to feed readers. Private feeds need their secret token in the token
+// parameter; without it they are not found.
+func getFeed(g *gin.Context) {
+	writer, err := formats.FeedWriterFor(g.Param("format"))
+	if err != nil {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "formats": formats.FeedWriterNames()})
+		return
+	}
+
+	feed, err := repositories.GetFeed(g.Param("id"))
+	if err == nil && !feed.Public && subtle.ConstantTimeCompare([]byte(g.Query("token")), []byte(feed.Token)) != 1 {
+		err = repositories.ErrFeedNotFound
+	}
+	if errors.Is(err, repositories.ErrFeedNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load feed: %v", err))
+		return
+	}
+
+	scope, err := repositories.FeedScope(feed)
+	if err != nil {
+		responseError(g, err)
+		return
+	}
+	bookmarks, err := repositories.GetNewestBookmarks(feed.UserID, feedItemLimit, scope)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmarks: %v", err))
+		return
+	}
+
+	if feed.Public {
+		g.Header("Cache-Control", "public, no-cache")
+	} else {
+		g.Header("Cache-Control", "private, no-cache")
+		g.Header("Referrer-Policy", "no-referrer")
+		g.Header("X-Robots-Tag", "noindex")
+	}
+	writeFeed(g, writer, formats.Feed{
+		ID:      "urn:uuid:" + feed.ID,
+		Title:   feed.Title,
+		FeedURL: requestURL(g),
+		Updated: feed.UpdatedAt,
+		Items:   feedItems(bookmarks),
+	})
+}
+
+// getShareFeed serves the newest bookmarks behind a share link as a feed. Expired, revoked
+// and password protected links are refused as on the share page.
+func getShareFeed(g *gin.Context) {
+	writer, err := formats.FeedWriterFor(g.Param("format"))
+	if err != nil {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "formats": formats.FeedWriterNames()})
+		return
+	}
+
+	share, status, page, err := openShare(g)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load share: %v", err))
+		return
+	}
+	if status != http.StatusOK {
+		g.JSON(status, gin.H{"error": page.Message})
+		return
+	}
+
+	scope, err := repositories.ShareScope(share)
+	if err != nil {
+		responseError(g, err)
+		return
+	}
+	bookmarks, err := repositories.GetNewestBookmarks(share.UserID, feedItemLimit, scope)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load shared bookmarks: %v", err))
+		return
+	}
+	if err := repositories.RecordShareAccess(share.ID); err != nil {
+		log.Printf("getShareFeed: failed to record access to %v %v", share.ID, err)
+	}
+
+	g.Header("Cache-Control", "private, no-cache")
+	g.Header("Referrer-Policy", "no-referrer")
+	g.Header("X-Robots-Tag", "noindex")
+	writeFeed(g, writer, formats.Feed{
+		ID:      "urn:uuid:" + share.ID,
+		Title:   share.Title,
+		Link:    requestBaseURL(g) + "/share/" + share.Token,
+		FeedURL: requestURL(g),
+		Updated: share.CreatedAt,
+		Items:   feedItems(bookmarks),
+	})
+}
+
+// writeFeed renders a feed with an ETag and a Last-Modified date from its newest item.
+// Conditional requests whose If-None-Match still matches get 304 Not Modified.
+// If-Modified-Since is not answered: removing or moving a bookmark out of the feed changes
+// it without leaving a newer item behind, which only the content ETag reflects.
+func writeFeed(g *gin.Context, writer formats.FeedWriter, feed formats.Feed) {
+	for _, item := range feed.Items {
+		if item.Updated.After(feed.Updated) {
+			feed.Updated = item.Updated
+		}
+	}
+
+	var body bytes.Buffer
+	if err := writer.Write(&body, feed); err != nil {
+		responseError(g, fmt.Errorf("Failed to write feed: %v", err))
+		return
+	}
+
+	etag := contentETag(body.Bytes())
+	g.Header("ETag", etag)
+	g.Header("Last-Modified", feed.Updated.UTC().Format(http.TimeFormat))
+	if etagMatches(g.GetHeader("If-None-Match"), etag) {
+		g.Status(http.StatusNotModified)
+		return
+	}
+	g.Data(http.StatusOK, writer.ContentType()+"; charset=utf-8", body.Bytes())
+}
+
+// feedItems converts bookmarks into feed items. Notes are left out, as feeds can be public.
+func feedItems(bookmarks []models.Bookmark) []formats.FeedItem {
+	items := make([]formats.FeedItem, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		item := formats.FeedItem{
+			ID:        "urn:uuid:" + b.ID,
+			Title:     b.Name,
+			URL:       b.URL,
+			Summary:   b.Description,
+			Tags:      b.TagList(),
+			Published: b.CreatedAt,
+			Updated:   b.UpdatedAt,
+		}
+		if item.Title == "" {
+			item.Title = b.URL
+		}
+		if b.AddDate != 0 {
+			item.Published = time.Unix(b.AddDate, 0)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// requestBaseURL is the scheme and host the client used to reach the API.
+func requestBaseURL(g *gin.Context) string {
+	scheme := "http"
+	if g.Request.TLS != nil || g.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + g.Request.Host
+}
+
+// requestURL is the absolute URL of the request.
+func requestURL(g *gin.Context) string {
+	return requestBaseURL(g) + g.Request.URL.RequestURI()
+}
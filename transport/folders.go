@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// getFolders lists the folder tree of the authenticated user, including the folders other
+// users share with them. Every folder carries the user's role in it.
+func getFolders(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	folders, err := repositories.GetUsersFolderTree(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load folders: %v", err))
+		return
+	}
+
+	responseData(g, folders)
+}
+
+// createFolderBookmark adds a bookmark to a folder the authenticated user owns or is an
+// editor of. The bookmark belongs to the owner of the folder. Its folder defaults to the
+// folder itself and may name one of its subfolders. A URL the owner already saved is a
+// conflict.
+func createFolderBookmark(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	folder, ok := folderWithRole(g, userID, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var bookmark models.Bookmark
+	if err := g.ShouldBindJSON(&bookmark); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+	if strings.TrimSpace(bookmark.URL) == "" {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+
+	err := repositories.SaveFolderBookmark(folder, userID, &bookmark)
+	if errors.Is(err, repositories.ErrPermissionDenied) {
+		g.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("folder must be within %q", folder.Path)})
+		return
+	}
+	if errors.Is(err, repositories.ErrBookmarkExists) {
+		g.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to save bookmark: %v", err))
+		return
+	}
+
+	g.Header("ETag", bookmarkETag(bookmark))
+	g.JSON(http.StatusCreated, bookmark)
+}
+
+// folderWithRole loads the folder named by the id parameter when the user has at least the
+// required role in it. Otherwise it writes 404 Not Found, or 403 Forbidden when the user
+// can see the folder, and returns false.
+func folderWithRole(g *gin.Context, userID string, role string) (models.Folder, bool) {
+	folder, err := repositories.GetFolderRole(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrFolderNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return folder, false
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load folder: %v", err))
+		return folder, false
+	}
+	if !models.HasRole(folder.Role, role) {
+		g.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("%v: requires the %v role", repositories.ErrPermissionDenied, role)})
+		return folder, false
+	}
+	return folder, true
+}
@@ -0,0 +1,38 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// getIcon serves a bookmark icon from the icon store.
+//
+// Icons are addressed by the hash of their content, so a hash always serves the same bytes
+// and responses can be cached indefinitely.
+func getIcon(g *gin.Context) {
+	hash := g.Param("hash")
+
+	if g.GetHeader("If-None-Match") == `"`+hash+`"` {
+		g.Status(http.StatusNotModified)
+		return
+	}
+
+	icon, err := repositories.GetIcon(hash)
+	if errors.Is(err, repositories.ErrIconNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load icon: %v", err))
+		return
+	}
+
+	g.Header("Cache-Control", "public, max-age=31536000, immutable")
+	g.Header("ETag", `"`+icon.Hash+`"`)
+	g.Header("X-Content-Type-Options", "nosniff")
+	g.Data(http.StatusOK, icon.ContentType, icon.Data)
+}
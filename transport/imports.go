@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/jobs"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+	"gorm.io/gorm"
+)
+
+// importJob is the API representation of an import job.
+type importJob struct {
+	ID          string                     `json:"id"`
+	Status      string                     `json:"status"`
+	Format      string                     `json:"format,omitempty"`
+	FileName    string                     `json:"file_name,omitempty"`
+	Mode        string                     `json:"mode"`
+	DryRun      bool                       `json:"dry_run"`
+	Processed   int                        `json:"processed"`
+	Total       int                        `json:"total"`
+	New         int                        `json:"new"`
+	Updated     int                        `json:"updated"`
+	Skipped     int                        `json:"skipped"`
+	Invalid     int                        `json:"invalid"`
+	Deleted     int                        `json:"deleted"`
+	Restored    int                        `json:"restored"`
+	OperationID string                     `json:"operation_id,omitempty"`
+	Error       string                     `json:"error,omitempty"`
+	Errors      []repositories.ImportEntry `json:"errors"`
+	Entries     []repositories.ImportEntry `json:"entries,omitempty"`
+	CreatedAt   time.Time                  `json:"created_at"`
+	StartedAt   *time.Time                 `json:"started_at,omitempty"`
+	FinishedAt  *time.Time                 `json:"finished_at,omitempty"`
+}
+
+// getImports lists the imports of the authenticated user, newest first.
+func getImports(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	list, err := repositories.GetUsersJobs(userID, models.JobKindImport)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load imports: %v", err))
+		return
+	}
+
+	imports := make([]importJob, 0, len(list))
+	for _, job := range list {
+		response := importJobResponse(job)
+		response.Entries = nil
+		imports = append(imports, response)
+	}
+	responseData(g, imports)
+}
+
+// getImport reports the status, progress, counts and errors of one import.
+// With entries=true the action taken for every imported entry is included as well.
+func getImport(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	job, err := repositories.GetUsersJob(g.Param("id"), userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && job.Kind != models.JobKindImport) {
+		g.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load import: %v", err))
+		return
+	}
+
+	response := importJobResponse(job)
+	if g.Query("entries") != "true" {
+		response.Entries = nil
+	}
+	responseData(g, response)
+}
+
+// importJobResponse converts an import job into its API representation.
+// The list of entries is only filled in for completed imports.
+func importJobResponse(job models.Job) importJob {
+	var params jobs.ImportParams
+	json.Unmarshal([]byte(job.Params), &params)
+
+	response := importJob{
+		ID:         job.ID,
+		Status:     job.Status,
+		Format:     params.Format,
+		FileName:   params.FileName,
+		Mode:       params.Mode,
+		DryRun:     params.DryRun,
+		Processed:  job.Processed,
+		Total:      job.Total,
+		Error:      job.Error,
+		Errors:     []repositories.ImportEntry{},
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+	}
+
+	if job.Status == models.JobRunning {
+		if processed, total, ok := repositories.GetJobProgress(job.ID); ok {
+			response.Processed, response.Total = processed, total
+		}
+	}
+
+	var report repositories.ImportReport
+	if job.Result != "" && json.Unmarshal([]byte(job.Result), &report) == nil {
+		response.New = report.New
+		response.Updated = report.Updated
+		response.Skipped = report.Skipped
+		response.Invalid = report.Invalid
+		response.Deleted = report.Deleted
+		response.Restored = report.Restored
+		response.OperationID = report.OperationID
+		response.Entries = report.Entries
+		for _, entry := range report.Entries {
+			if entry.Action == repositories.ImportActionInvalid {
+				response.Errors = append(response.Errors, entry)
+			}
+		}
+	}
+
+	return response
+}
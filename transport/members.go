@@ -0,0 +1,176 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// invitationRequest describes an invitation to a folder.
+type invitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// memberRequest describes a new role for a folder member.
+type memberRequest struct {
+	Role string `json:"role"`
+}
+
+// getFolderMembers lists the members of a folder the authenticated user has a role in.
+func getFolderMembers(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	folder, ok := folderWithRole(g, userID, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := repositories.GetFolderMembers(folder)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load folder members: %v", err))
+		return
+	}
+
+	responseData(g, members)
+}
+
+// inviteToFolder invites a user by email address to a folder the authenticated user owns.
+// The invitation is listed for the user with that address, who accepts or declines it;
+// it also waits for users who sign up with the address later.
+func inviteToFolder(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	folder, ok := folderWithRole(g, userID, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var request invitationRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+	if !strings.Contains(request.Email, "@") {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "a valid email is required"})
+		return
+	}
+	if request.Role == "" {
+		request.Role = models.RoleViewer
+	}
+	if !models.HasRole(request.Role, models.RoleViewer) {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("role must be one of %v", strings.Join(models.Roles, ", "))})
+		return
+	}
+
+	invitation, err := repositories.InviteToFolder(folder, userID, request.Email, request.Role)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to save invitation: %v", err))
+		return
+	}
+
+	g.JSON(http.StatusCreated, invitation)
+}
+
+// updateFolderMember changes the role of a member of a folder the authenticated user owns.
+func updateFolderMember(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	folder, ok := folderWithRole(g, userID, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var request memberRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+	if !models.HasRole(request.Role, models.RoleViewer) {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("role must be one of %v", strings.Join(models.Roles, ", "))})
+		return
+	}
+
+	err := repositories.SetMemberRole(folder.ID, g.Param("user"), request.Role)
+	if errors.Is(err, repositories.ErrMemberNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to update folder member: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"success": "Member updated successfully"})
+}
+
+// removeFolderMember removes a member from a folder. Owners remove any member, and every
+// member can remove themselves to leave the folder.
+func removeFolderMember(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	role := models.RoleOwner
+	if g.Param("user") == userID {
+		role = models.RoleViewer
+	}
+	folder, ok := folderWithRole(g, userID, role)
+	if !ok {
+		return
+	}
+
+	err := repositories.RemoveMember(folder.ID, g.Param("user"))
+	if errors.Is(err, repositories.ErrMemberNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to remove folder member: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"success": "Member removed successfully"})
+}
+
+// getInvitations lists the pending folder invitations addressed to the authenticated user.
+func getInvitations(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	invitations, err := repositories.GetUsersInvitations(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load invitations: %v", err))
+		return
+	}
+
+	responseData(g, invitations)
+}
+
+// acceptInvitation makes the authenticated user a member of the folder they were invited to.
+func acceptInvitation(g *gin.Context) {
+	respondToInvitation(g, true)
+}
+
+// declineInvitation declines an invitation to a folder.
+func declineInvitation(g *gin.Context) {
+	respondToInvitation(g, false)
+}
+
+func respondToInvitation(g *gin.Context, accept bool) {
+	userID := GetUserIDFromRequest(g)
+
+	invitation, err := repositories.RespondToInvitation(g.Param("id"), userID, accept)
+	if errors.Is(err, repositories.ErrInvitationNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to answer invitation: %v", err))
+		return
+	}
+
+	responseData(g, invitation)
+}
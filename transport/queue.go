@@ -0,0 +1,169 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// queueRequest is a URL to save straight into the read-later queue.
+type queueRequest struct {
+	URL     string `json:"url"`
+	Name    string `json:"name"`
+	Tags    string `json:"tags"`
+	Folder  string `json:"folder"`
+	Archive bool   `json:"archive"`
+}
+
+// readStateRequest moves a bookmark to a read state; an empty state takes it out of the queue.
+type readStateRequest struct {
+	State string `json:"state"`
+}
+
+// queueOrderRequest lists queued bookmark IDs in their new order.
+type queueOrderRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// getQueue lists the read-later queue of the authenticated user. The state parameter picks
+// the unread items, in queue order, or the read or archived ones, most recently read first.
+func getQueue(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	state := g.DefaultQuery("state", models.ReadStateUnread)
+	if !validReadState(state) {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown read state %q, expected one of %v", state, models.ReadStates)})
+		return
+	}
+
+	bookmarks, err := repositories.GetUsersQueue(userID, state)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load queue: %v", err))
+		return
+	}
+
+	renderNotes(bookmarks)
+	responseData(g, bookmarks)
+}
+
+// queueURL saves a URL to the end of the read-later queue of the authenticated user. A URL
+// already bookmarked is queued again instead of saved twice. With archive set, the page is
+// archived as well, which also estimates its reading time.
+func queueURL(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	var request queueRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+	link, err := url.Parse(request.URL)
+	if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http or https URL"})
+		return
+	}
+
+	bookmark := models.Bookmark{
+		UserID: userID,
+		URL:    request.URL,
+		Name:   request.Name,
+		Tags:   request.Tags,
+		Folder: request.Folder,
+	}
+	if err := repositories.QueueBookmark(&bookmark); err != nil {
+		responseError(g, fmt.Errorf("Failed to queue bookmark: %v", err))
+		return
+	}
+	if request.Archive {
+		if _, err := repositories.RequestArchive(bookmark); err != nil {
+			log.Printf("queueURL: failed to request archive of %v %v", bookmark.ID, err)
+		}
+	}
+
+	g.JSON(http.StatusCreated, bookmark)
+}
+
+// setReadState moves a bookmark of the authenticated user to the read state in the body.
+func setReadState(g *gin.Context) {
+	var request readStateRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+	if request.State != "" && !validReadState(request.State) {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown read state %q, expected one of %v", request.State, models.ReadStates)})
+		return
+	}
+
+	updateReadState(g, request.State)
+}
+
+// markRead marks a bookmark of the authenticated user as read.
+func markRead(g *gin.Context) {
+	updateReadState(g, models.ReadStateRead)
+}
+
+// updateReadState moves the bookmark in the id parameter to a read state and responds with
+// the updated bookmark.
+func updateReadState(g *gin.Context, state string) {
+	userID := GetUserIDFromRequest(g)
+
+	err := repositories.SetReadState(g.Param("id"), userID, state)
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to update read state: %v", err))
+		return
+	}
+
+	bookmark, err := repositories.GetUsersBookmark(g.Param("id"), userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmark: %v", err))
+		return
+	}
+	renderBookmarkNotes(&bookmark)
+	responseData(g, bookmark)
+}
+
+// reorderQueue puts the unread items of the authenticated user's queue in the order given.
+// Items left out follow the listed ones in their current order.
+func reorderQueue(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	var request queueOrderRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+
+	if err := repositories.ReorderQueue(userID, request.IDs); err != nil {
+		responseError(g, fmt.Errorf("Failed to reorder queue: %v", err))
+		return
+	}
+
+	bookmarks, err := repositories.GetUsersQueue(userID, models.ReadStateUnread)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load queue: %v", err))
+		return
+	}
+	renderNotes(bookmarks)
+	responseData(g, bookmarks)
+}
+
+// validReadState reports whether state is one of models.ReadStates.
+func validReadState(state string) bool {
+	for _, s := range models.ReadStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,12 @@
 package transport
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"reflect"
+	"strings"
 
 	"log"
 
@@ -44,6 +47,46 @@ func responseData(g *gin.Context, data interface{}) {
 	)
 }
 
+// responseDataWithETag sends a response with data to the client, tagged with a hash of the
+// JSON. When the request's If-None-Match lists that tag, 304 Not Modified is sent instead.
+func responseDataWithETag(g *gin.Context, data interface{}) {
+	d, err := json.Marshal(data)
+	if err != nil {
+		responseError(g, err)
+		return
+	}
+	if isEmptyArray(data) {
+		d = []byte("[]")
+	}
+
+	etag := contentETag(d)
+	g.Header("ETag", etag)
+	g.Header("Cache-Control", "private, no-cache")
+	if etagMatches(g.GetHeader("If-None-Match"), etag) {
+		g.Status(http.StatusNotModified)
+		return
+	}
+	g.Data(http.StatusOK, "application/json", d)
+}
+
+// contentETag is a strong entity tag derived from a response body.
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists the entity tag.
+// Tags are compared ignoring the weak prefix.
+func etagMatches(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
 // isEmptyArray checks if the given data is an empty array.
 func isEmptyArray(data interface{}) bool {
 	value := reflect.ValueOf(data)
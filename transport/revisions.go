@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// getBookmarkHistory lists the revisions of a bookmark of the authenticated user, newest
+// first. The history of deleted and purged bookmarks is kept.
+func getBookmarkHistory(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	revisions, err := repositories.GetUsersBookmarkHistory(g.Param("id"), userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmark history: %v", err))
+		return
+	}
+	if len(revisions) == 0 {
+		g.JSON(http.StatusNotFound, gin.H{"error": repositories.ErrBookmarkNotFound.Error()})
+		return
+	}
+
+	responseData(g, revisions)
+}
+
+// undoOperation reverts all changes made by an operation, such as a whole import or bulk
+// action. Bookmarks changed again since are left as they are and reported as conflicts.
+// Undoing is itself an operation, whose ID is returned so it can be undone in turn.
+func undoOperation(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	result, err := repositories.UndoOperation(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrOperationNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrOperationUndone) {
+		g.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to undo operation: %v", err))
+		return
+	}
+
+	responseData(g, result)
+}
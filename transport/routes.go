@@ -34,6 +34,12 @@ func Router(newRelicApp *newrelic.Application) http.Handler {
 
 	router.GET("/", HealthCheck)
 	router.GET("/healthz", HealthCheck)
+	router.GET("/icons/:hash", getIcon)
+	router.GET("/share/:token", getSharedCollection)
+	router.POST("/share/:token", getSharedCollection)
+	router.GET("/share/:token/feed/:format", getShareFeed)
+	router.GET("/feeds/:id/:format", getFeed)
+	router.GET("/go/:id", visitBookmark)
 
 	//Performance verify key on load forge
 	loaderVerification := os.Getenv("LOAD_FORGE")
@@ -51,13 +57,71 @@ func Router(newRelicApp *newrelic.Application) http.Handler {
 		api.POST("/signup", handleSignup)
 
 		members := api.Group("/members")
+		members.Use(AuthMiddleware())
 		{
-			members.Use(AuthMiddleware()).POST("/bookmarks", uploadBookmarks)
-			members.Use(AuthMiddleware()).POST("/bookmark", saveBookmark)
-			members.Use(AuthMiddleware()).DELETE("/bookmark/:id", deleteBookmark)
-			members.Use(AuthMiddleware()).POST("/settings")
-			members.Use(AuthMiddleware()).GET("/settings")
-			members.Use(AuthMiddleware()).GET("/bookmarks", getBookmarks)
+			members.POST("/bookmarks", uploadBookmarks)
+			members.POST("/bookmark", saveBookmark)
+			members.GET("/bookmark/:id", getBookmark)
+			members.DELETE("/bookmark/:id", deleteBookmark)
+			members.POST("/bookmark/:id/metadata", refreshMetadata)
+			members.GET("/bookmark/:id/history", getBookmarkHistory)
+			members.POST("/settings")
+			members.GET("/settings")
+			members.GET("/bookmarks", getBookmarks)
+			members.GET("/bookmarks/export", exportBookmarks)
+			members.GET("/bookmarks/duplicates", getDuplicates)
+			members.GET("/bookmarks/most-used", getMostUsedBookmarks)
+			members.GET("/bookmarks/recent", getRecentBookmarks)
+			members.POST("/bookmarks/duplicates/merge", mergeDuplicates)
+			members.POST("/bookmarks/redirects/apply", applyRedirects)
+			members.POST("/bookmarks/bulk", bulkBookmarks)
+			members.GET("/bookmarks/bulk/:id", getBulkJob)
+			members.POST("/bookmarks/:id/archive", requestArchive)
+			members.GET("/bookmarks/:id/archive", getArchive)
+			members.DELETE("/bookmarks/:id/archive", deleteArchive)
+			members.GET("/archives/usage", getArchiveUsage)
+			members.GET("/queue", getQueue)
+			members.POST("/queue", queueURL)
+			members.PUT("/queue/order", reorderQueue)
+			members.PUT("/queue/:id", setReadState)
+			members.POST("/queue/:id/read", markRead)
+			members.GET("/trash", getTrash)
+			members.POST("/trash/:id/restore", restoreTrash)
+			members.DELETE("/trash/:id", purgeTrash)
+			members.DELETE("/trash", emptyTrash)
+			members.POST("/operations/:id/undo", undoOperation)
+			members.GET("/sync", getSyncChanges)
+			members.GET("/shares", getShares)
+			members.POST("/shares", createShare)
+			members.DELETE("/shares/:id", revokeShare)
+			members.POST("/sync", applySyncChanges)
+			members.GET("/feeds", getFeeds)
+			members.POST("/feeds", createFeed)
+			members.POST("/feeds/:id/token", rotateFeedToken)
+			members.DELETE("/feeds/:id", deleteFeed)
+			members.GET("/collections", getCollections)
+			members.GET("/folders", getFolders)
+			members.GET("/searches", getSavedSearches)
+			members.POST("/searches", createSavedSearch)
+			members.PUT("/searches/:id", updateSavedSearch)
+			members.DELETE("/searches/:id", deleteSavedSearch)
+			members.GET("/searches/:id/bookmarks", getSavedSearchBookmarks)
+			members.POST("/folders/:id/bookmarks", createFolderBookmark)
+			members.GET("/folders/:id/members", getFolderMembers)
+			members.POST("/folders/:id/invitations", inviteToFolder)
+			members.PUT("/folders/:id/members/:user", updateFolderMember)
+			members.DELETE("/folders/:id/members/:user", removeFolderMember)
+			members.GET("/invitations", getInvitations)
+			members.POST("/invitations/:id/accept", acceptInvitation)
+			members.POST("/invitations/:id/decline", declineInvitation)
+			members.GET("/rules", getRules)
+			members.POST("/rules", createRule)
+			members.POST("/rules/run", runRules)
+			members.PUT("/rules/:id", updateRule)
+			members.DELETE("/rules/:id", deleteRule)
+			members.POST("/rules/:id/run", runRules)
+			members.GET("/imports", getImports)
+			members.GET("/imports/:id", getImport)
 
 		}
 
@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// ruleRequest describes a rule to create or update; see models.Rule. Rules are enabled
+// unless enabled is false.
+type ruleRequest struct {
+	Name          string `json:"name"`
+	Position      int    `json:"position"`
+	Enabled       *bool  `json:"enabled"`
+	Domain        string `json:"domain"`
+	URLPattern    string `json:"url_pattern"`
+	TitleContains string `json:"title_contains"`
+	Folder        string `json:"folder"`
+	AddTags       string `json:"add_tags"`
+	NameTemplate  string `json:"name_template"`
+}
+
+// getRules lists the rules of the authenticated user in the order they apply.
+func getRules(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	rules, err := repositories.GetUsersRules(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load rules: %v", err))
+		return
+	}
+
+	responseData(g, rules)
+}
+
+// createRule saves a rule of the authenticated user. It applies to the bookmarks they create
+// or import from then on, and to those already saved with runRules.
+func createRule(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	rule, ok := bindRuleRequest(g, userID)
+	if !ok {
+		return
+	}
+
+	if err := repositories.SaveRule(&rule); err != nil {
+		responseError(g, fmt.Errorf("Failed to save rule: %v", err))
+		return
+	}
+
+	g.JSON(http.StatusCreated, rule)
+}
+
+// updateRule replaces a rule of the authenticated user.
+func updateRule(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	rule, ok := bindRuleRequest(g, userID)
+	if !ok {
+		return
+	}
+	rule.ID = g.Param("id")
+
+	err := repositories.UpdateRule(rule)
+	if errors.Is(err, repositories.ErrRuleNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to save rule: %v", err))
+		return
+	}
+
+	rule, err = repositories.GetUsersRule(rule.ID, userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load rule: %v", err))
+		return
+	}
+	responseData(g, rule)
+}
+
+// deleteRule deletes a rule of the authenticated user.
+func deleteRule(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	err := repositories.DeleteRule(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrRuleNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to delete rule: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"success": "Rule deleted successfully"})
+}
+
+// runRules applies the enabled rules of the authenticated user, or the single rule in the id
+// parameter, to the bookmarks they already saved. With preview=true nothing is saved and
+// the response lists what would change; otherwise it lists what changed and the operation
+// that undoes it.
+func runRules(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	preview, err := strconv.ParseBool(g.DefaultQuery("preview", "false"))
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid preview %q, expected true or false", g.Query("preview"))})
+		return
+	}
+	var ruleIDs []string
+	if id := g.Param("id"); id != "" {
+		ruleIDs = []string{id}
+	}
+
+	result, err := repositories.RunRules(userID, ruleIDs, preview)
+	if errors.Is(err, repositories.ErrRuleNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to run rules: %v", err))
+		return
+	}
+
+	responseData(g, result)
+}
+
+// bindRuleRequest reads the rule in the request body and checks that it has a condition and
+// an action.
+func bindRuleRequest(g *gin.Context, userID string) (models.Rule, bool) {
+	var request ruleRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return models.Rule{}, false
+	}
+
+	rule := models.Rule{
+		UserID:        userID,
+		Name:          request.Name,
+		Position:      request.Position,
+		Enabled:       request.Enabled == nil || *request.Enabled,
+		Domain:        request.Domain,
+		URLPattern:    request.URLPattern,
+		TitleContains: request.TitleContains,
+		Folder:        request.Folder,
+		AddTags:       models.JoinTags([]string{request.AddTags}),
+		NameTemplate:  request.NameTemplate,
+	}
+	if err := rule.Validate(); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return rule, false
+	}
+	return rule, true
+}
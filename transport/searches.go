@@ -0,0 +1,210 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// savedSearchRequest describes a saved search to create or update.
+type savedSearchRequest struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// getSavedSearches lists the saved searches of the authenticated user, each with the number
+// of bookmarks it currently matches.
+func getSavedSearches(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	searches, err := repositories.GetUsersSavedSearches(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load saved searches: %v", err))
+		return
+	}
+
+	responseData(g, searches)
+}
+
+// getCollections lists the folders of the authenticated user, as getFolders does, together
+// with their saved searches and counts, for navigation that shows both side by side.
+func getCollections(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	folders, err := repositories.GetUsersFolderTree(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load folders: %v", err))
+		return
+	}
+	searches, err := repositories.GetUsersSavedSearches(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load saved searches: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"folders": folders, "searches": searches})
+}
+
+// createSavedSearch saves a named search query of the authenticated user. See
+// repositories.SearchScope for the query syntax; a query with an error in it gets a 400
+// response with its position.
+func createSavedSearch(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	request, ok := bindSavedSearchRequest(g)
+	if !ok {
+		return
+	}
+
+	search := models.SavedSearch{
+		UserID: userID,
+		Name:   request.Name,
+		Query:  request.Query,
+	}
+	if !saveSavedSearch(g, repositories.SaveSavedSearch(&search)) {
+		return
+	}
+
+	g.JSON(http.StatusCreated, search)
+}
+
+// updateSavedSearch renames a saved search of the authenticated user or changes its query.
+func updateSavedSearch(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	request, ok := bindSavedSearchRequest(g)
+	if !ok {
+		return
+	}
+
+	search := models.SavedSearch{
+		ID:     g.Param("id"),
+		UserID: userID,
+		Name:   request.Name,
+		Query:  request.Query,
+	}
+	if !saveSavedSearch(g, repositories.UpdateSavedSearch(search)) {
+		return
+	}
+
+	search, err := repositories.GetUsersSavedSearch(search.ID, userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load saved search: %v", err))
+		return
+	}
+	responseData(g, search)
+}
+
+// deleteSavedSearch deletes a saved search of the authenticated user. Share links to it are
+// revoked and its feeds deleted.
+func deleteSavedSearch(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	err := repositories.DeleteSavedSearch(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrSavedSearchNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to delete saved search: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"success": "Saved search deleted successfully"})
+}
+
+// getSavedSearchBookmarks lists the bookmarks the authenticated user can see that match one
+// of their saved searches.
+func getSavedSearchBookmarks(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	scope, err := repositories.SavedSearchScope(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrSavedSearchNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrInvalidSearch) {
+		g.JSON(http.StatusBadRequest, queryErrorBody(err))
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load saved search: %v", err))
+		return
+	}
+
+	bookmarks, err := repositories.GetUsersBookmarks(userID, scope)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmarks: %v", err))
+		return
+	}
+
+	renderNotes(bookmarks)
+	responseDataWithETag(g, bookmarks)
+}
+
+// bindSavedSearchRequest reads the saved search in the request body, which needs a name and
+// a query.
+func bindSavedSearchRequest(g *gin.Context) (savedSearchRequest, bool) {
+	var request savedSearchRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return request, false
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	request.Query = strings.TrimSpace(request.Query)
+	if request.Name == "" || request.Query == "" {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "name and query are required"})
+		return request, false
+	}
+	return request, true
+}
+
+// saveSavedSearch responds to the error of saving a saved search, if any, and reports
+// whether it was saved.
+func saveSavedSearch(g *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, repositories.ErrInvalidSearch):
+		g.JSON(http.StatusBadRequest, queryErrorBody(err))
+	case errors.Is(err, repositories.ErrSavedSearchExists):
+		g.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrSavedSearchNotFound):
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		responseError(g, fmt.Errorf("Failed to save saved search: %v", err))
+	}
+	return false
+}
+
+// queryErrorBody is the body of a 400 response to a request with an error in it. When the
+// error is in a search query, position tells where, counted in characters from 0.
+func queryErrorBody(err error) gin.H {
+	body := gin.H{"error": err.Error()}
+	var queryErr *library.QueryError
+	if errors.As(err, &queryErr) {
+		body["position"] = queryErr.Position
+	}
+	return body
+}
+
+// savedSearchTarget loads the saved search of the authenticated user that a share link, feed
+// or export is asked to use. An unknown ID is a bad request.
+func savedSearchTarget(g *gin.Context, searchID string, userID string) (models.SavedSearch, bool) {
+	search, err := repositories.GetUsersSavedSearch(searchID, userID)
+	if errors.Is(err, repositories.ErrSavedSearchNotFound) {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return search, false
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load saved search: %v", err))
+		return search, false
+	}
+	return search, true
+}
@@ -0,0 +1,322 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/library"
+	"github.com/jasonbronson/kwikportal-api/models"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// shareTokenBytes is the number of random bytes in a share token.
+const shareTokenBytes = 24
+
+// shareRequest describes a share link to create.
+type shareRequest struct {
+	Kind      string     `json:"kind"`
+	Target    string     `json:"target"`
+	Title     string     `json:"title"`
+	Password  string     `json:"password"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// sharedCollection is the public representation of the bookmarks behind a share link.
+type sharedCollection struct {
+	Title     string           `json:"title"`
+	Kind      string           `json:"kind"`
+	Target    string           `json:"target"`
+	Bookmarks []sharedBookmark `json:"bookmarks"`
+}
+
+// sharedBookmark is the public representation of a shared bookmark. It leaves out notes and
+// anything else only meant for its owner. Folder is relative to the shared folder.
+type sharedBookmark struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Description string   `json:"description,omitempty"`
+	Folder      string   `json:"folder,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Icon        string   `json:"icon,omitempty"`
+	AddDate     int64    `json:"add_date,omitempty"`
+}
+
+// sharePage is the data of the share HTML page. Without a collection it shows the message,
+// and the password form when NeedsPassword is set.
+type sharePage struct {
+	Title         string
+	Message       string
+	NeedsPassword bool
+	Collection    *sharedCollection
+}
+
+var shareTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if .Message}}
+<p>{{.Message}}</p>
+{{- end}}
+{{- if .NeedsPassword}}
+<form method="post">
+<input type="password" name="password" placeholder="Password" autofocus>
+<button type="submit">Open</button>
+</form>
+{{- end}}
+{{- with .Collection}}
+<ul>
+{{- range .Bookmarks}}
+<li>
+{{- if .Icon}}<img src="{{.Icon}}" width="16" height="16" alt=""> {{end -}}
+<a href="{{.URL}}" rel="noopener noreferrer nofollow">{{if .Name}}{{.Name}}{{else}}{{.URL}}{{end}}</a>
+{{- if .Folder}} <small>{{.Folder}}</small>{{end}}
+{{- if .Description}}<br>{{.Description}}{{end}}
+{{- if .Tags}}<br><small>{{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t}}{{end}}</small>{{end}}
+</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+// createShare creates a read-only share link to the authenticated user's bookmarks in a folder,
+// with a tag or matching a saved search, optionally protected by a password and expiring at
+// expires_at.
+func createShare(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	var request shareRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+	if request.Kind != models.ShareFolder && request.Kind != models.ShareTag && request.Kind != models.ShareSearch {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("kind must be %q, %q or %q", models.ShareFolder, models.ShareTag, models.ShareSearch)})
+		return
+	}
+	if strings.TrimSpace(request.Target) == "" {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "target is required"})
+		return
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	token, err := library.RandomToken(shareTokenBytes)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to create share token: %v", err))
+		return
+	}
+	share := models.Share{
+		UserID:    userID,
+		Token:     token,
+		Kind:      request.Kind,
+		Target:    request.Target,
+		Title:     request.Title,
+		ExpiresAt: request.ExpiresAt,
+	}
+	if share.Kind == models.ShareSearch {
+		search, ok := savedSearchTarget(g, share.Target, userID)
+		if !ok {
+			return
+		}
+		if share.Title == "" {
+			share.Title = search.Name
+		}
+	}
+	if share.Title == "" {
+		share.Title = request.Target
+	}
+	if request.Password != "" {
+		share.PasswordHash = library.GeneratePassword(request.Password)
+		if share.PasswordHash == "" {
+			responseError(g, fmt.Errorf("Failed to hash share password"))
+			return
+		}
+		share.HasPassword = true
+	}
+
+	if err := repositories.SaveShare(&share); err != nil {
+		responseError(g, fmt.Errorf("Failed to save share: %v", err))
+		return
+	}
+
+	g.JSON(http.StatusCreated, share)
+}
+
+// getShares lists the share links of the authenticated user with their access counts.
+func getShares(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	shares, err := repositories.GetUsersShares(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load shares: %v", err))
+		return
+	}
+
+	responseData(g, shares)
+}
+
+// revokeShare revokes a share link of the authenticated user.
+func revokeShare(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	err := repositories.RevokeShare(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrShareNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to revoke share: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"success": "Share revoked successfully"})
+}
+
+// getSharedCollection serves the bookmarks behind a share link to anonymous clients, as JSON
+// or as an HTML page depending on the format parameter or the Accept header.
+//
+// The password of a protected link is sent in the X-Share-Password header, or posted as
+// the password form field from the HTML page.
+func getSharedCollection(g *gin.Context) {
+	format := g.Query("format")
+	if format == "" {
+		format = "json"
+		if g.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+			format = "html"
+		}
+	}
+	if format != "json" && format != "html" {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown share format %q", format)})
+		return
+	}
+
+	g.Header("Cache-Control", "no-store")
+	g.Header("Referrer-Policy", "no-referrer")
+	g.Header("X-Robots-Tag", "noindex")
+
+	share, status, page, err := openShare(g)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load share: %v", err))
+		return
+	}
+	if status != http.StatusOK {
+		if format == "html" {
+			renderSharePage(g, status, page)
+			return
+		}
+		g.JSON(status, gin.H{"error": page.Message})
+		return
+	}
+
+	bookmarks, err := repositories.GetSharedBookmarks(share)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load shared bookmarks: %v", err))
+		return
+	}
+	if err := repositories.RecordShareAccess(share.ID); err != nil {
+		log.Printf("getSharedCollection: failed to record access to %v %v", share.ID, err)
+	}
+
+	collection := sharedCollectionResponse(share, bookmarks)
+	if format == "html" {
+		renderSharePage(g, http.StatusOK, sharePage{Title: share.Title, Collection: &collection})
+		return
+	}
+	g.JSON(http.StatusOK, collection)
+}
+
+// openShare loads the share link named by the token parameter and checks that it can be
+// viewed, with the password sent along when it has one. When it cannot, the status to
+// respond with is not 200 OK and the page explains why. Passwords are refused for a while
+// after too many wrong ones.
+func openShare(g *gin.Context) (models.Share, int, sharePage, error) {
+	share, err := repositories.GetShareByToken(g.Param("token"))
+	if errors.Is(err, repositories.ErrShareNotFound) {
+		return share, http.StatusNotFound, sharePage{Title: "Not found", Message: err.Error()}, nil
+	}
+	if err != nil {
+		return share, http.StatusInternalServerError, sharePage{}, err
+	}
+	if share.Expired(time.Now()) {
+		return share, http.StatusGone, sharePage{Title: share.Title, Message: "This share link has expired"}, nil
+	}
+	if share.PasswordHash != "" {
+		password := g.GetHeader("X-Share-Password")
+		if password == "" {
+			password = g.PostForm("password")
+		}
+		if password == "" {
+			return share, http.StatusUnauthorized, sharePage{Title: share.Title, Message: "A password is required", NeedsPassword: true}, nil
+		}
+		blocked, err := repositories.SharePasswordBlocked(share.ID, time.Now())
+		if err != nil {
+			return share, http.StatusInternalServerError, sharePage{}, err
+		}
+		if blocked {
+			g.Header("Retry-After", strconv.Itoa(int(repositories.SharePasswordWindow/time.Second)))
+			return share, http.StatusTooManyRequests, sharePage{Title: share.Title, Message: "Too many incorrect passwords, try again later"}, nil
+		}
+		if bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil {
+			if err := repositories.RecordSharePasswordFailure(share.ID, time.Now()); err != nil {
+				return share, http.StatusInternalServerError, sharePage{}, err
+			}
+			return share, http.StatusUnauthorized, sharePage{Title: share.Title, Message: "The password is incorrect", NeedsPassword: true}, nil
+		}
+	}
+	return share, http.StatusOK, sharePage{}, nil
+}
+
+// renderSharePage writes the share HTML page.
+func renderSharePage(g *gin.Context, status int, page sharePage) {
+	g.Header("Content-Type", "text/html; charset=utf-8")
+	g.Status(status)
+	if err := shareTemplate.Execute(g.Writer, page); err != nil {
+		log.Println(err)
+	}
+}
+
+// sharedCollectionResponse converts the bookmarks behind a share link into their public
+// representation.
+func sharedCollectionResponse(share models.Share, bookmarks []models.Bookmark) sharedCollection {
+	collection := sharedCollection{
+		Title:     share.Title,
+		Kind:      share.Kind,
+		Target:    share.Target,
+		Bookmarks: make([]sharedBookmark, 0, len(bookmarks)),
+	}
+	for _, b := range bookmarks {
+		shared := sharedBookmark{
+			Name:        b.Name,
+			URL:         b.URL,
+			Description: b.Description,
+			Tags:        b.TagList(),
+			AddDate:     b.AddDate,
+		}
+		if share.Kind == models.ShareFolder {
+			shared.Folder = strings.TrimPrefix(strings.TrimPrefix(b.Folder, share.Target), models.FolderSeparator)
+		}
+		if b.IconHash != "" {
+			shared.Icon = "/icons/" + b.IconHash
+		}
+		collection.Bookmarks = append(collection.Bookmarks, shared)
+	}
+	return collection
+}
@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// Limits on the size of sync requests.
+const (
+	syncDefaultLimit = 500
+	syncMaxLimit     = 1000
+	syncMaxChanges   = 1000
+)
+
+// syncRequest is a batch of changes made by a sync client since it last synced at Cursor.
+type syncRequest struct {
+	Cursor  *int64                    `json:"cursor"`
+	Changes []repositories.SyncChange `json:"changes"`
+}
+
+// getSyncChanges returns the bookmarks of the authenticated user changed since the cursor
+// in the since parameter, as created and updated bookmarks and tombstones of deleted ones.
+// Without since, all bookmarks are returned as created. Clients keep the returned cursor and
+// ask again while more is set.
+func getSyncChanges(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	since, ok := g.GetQuery("since")
+	if !ok {
+		changes, err := repositories.GetUsersSnapshot(userID)
+		if err != nil {
+			responseError(g, fmt.Errorf("Failed to load bookmarks: %v", err))
+			return
+		}
+		renderNotes(changes.Created)
+		responseData(g, changes)
+		return
+	}
+
+	cursor, err := strconv.ParseInt(since, 10, 64)
+	if err != nil || cursor < 0 {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "since must be a cursor returned by a previous sync"})
+		return
+	}
+	limit, err := strconv.Atoi(g.DefaultQuery("limit", strconv.Itoa(syncDefaultLimit)))
+	if err != nil || limit <= 0 || limit > syncMaxLimit {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %v", syncMaxLimit)})
+		return
+	}
+
+	changes, err := repositories.GetUsersChanges(userID, cursor, limit)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load changes: %v", err))
+		return
+	}
+
+	renderNotes(changes.Created)
+	renderNotes(changes.Updated)
+	responseData(g, changes)
+}
+
+// applySyncChanges applies a batch of changes made by a sync client of the authenticated
+// user and reports the outcome of every change.
+//
+// The cursor is the one returned by the client's last GET /members/sync, so clients pull
+// before they push. Fields changed on both sides since then keep the server value and are
+// reported as conflicts, with the server copy to update the client from.
+func applySyncChanges(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	var request syncRequest
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse JSON body: %v", err)})
+		return
+	}
+	if request.Cursor == nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "cursor is required"})
+		return
+	}
+	if len(request.Changes) > syncMaxChanges {
+		g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %v changes can be sent at once", syncMaxChanges)})
+		return
+	}
+
+	report, err := repositories.ApplySyncChanges(userID, *request.Cursor, request.Changes)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to apply changes: %v", err))
+		return
+	}
+
+	for i := range report.Results {
+		if report.Results[i].Bookmark != nil {
+			renderBookmarkNotes(report.Results[i].Bookmark)
+		}
+	}
+	responseData(g, report)
+}
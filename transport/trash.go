@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/jobs"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// getTrash lists the deleted bookmarks of the authenticated user, most recently deleted
+// first. Deleted bookmarks are purged permanently after the trash retention period.
+func getTrash(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	bookmarks, err := repositories.GetUsersTrash(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load trash: %v", err))
+		return
+	}
+
+	renderNotes(bookmarks)
+	responseData(g, bookmarks)
+}
+
+// restoreTrash moves a deleted bookmark out of the trash, unless its URL was saved again
+// since, which is a conflict.
+func restoreTrash(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	err := repositories.RestoreBookmark(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrBookmarkExists) {
+		g.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to restore bookmark: %v", err))
+		return
+	}
+
+	responseData(g, gin.H{"success": "Bookmark restored successfully"})
+}
+
+// purgeTrash permanently deletes a bookmark that is in the trash.
+func purgeTrash(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	err := repositories.PurgeBookmark(g.Param("id"), userID)
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to delete bookmark: %v", err))
+		return
+	}
+	removeOrphanedArchives(g, userID)
+
+	responseData(g, gin.H{"success": "Bookmark deleted permanently"})
+}
+
+// emptyTrash permanently deletes every bookmark in the trash of the authenticated user.
+func emptyTrash(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	purged, err := repositories.EmptyTrash(userID)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to empty trash: %v", err))
+		return
+	}
+	removeOrphanedArchives(g, userID)
+
+	responseData(g, gin.H{"purged": purged})
+}
+
+// removeOrphanedArchives removes the archives of the bookmarks a user deleted permanently.
+// The bookmarks are gone either way, so a failure is only logged and left to the archives job.
+func removeOrphanedArchives(g *gin.Context, userID string) {
+	if _, err := jobs.RemoveOrphanedArchives(g.Request.Context(), userID); err != nil {
+		log.Printf("removeOrphanedArchives: failed to remove archives of %v %v", userID, err)
+	}
+}
@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasonbronson/kwikportal-api/repositories"
+)
+
+// Limits of the most used and recent bookmark listings.
+const (
+	defaultVisitsLimit = 10
+	maxVisitsLimit     = 100
+)
+
+// visitBookmark counts a visit to a bookmark and redirects to its URL. The portal links to
+// /go/{id} instead of the URL itself so that visits feed the frecency ranking.
+//
+// Browsers follow the link without the API token, so the route is public; bookmark IDs are
+// random and only the bookmark URL is revealed. Only web URLs are redirected to.
+func visitBookmark(g *gin.Context) {
+	bookmark, err := repositories.GetBookmark(g.Param("id"))
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		g.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmark: %v", err))
+		return
+	}
+
+	target, err := url.Parse(bookmark.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "bookmark URL is not a web address"})
+		return
+	}
+
+	if err := repositories.RecordVisit(bookmark.ID, time.Now()); err != nil {
+		log.Printf("visitBookmark: failed to record visit to %v %v", bookmark.ID, err)
+	}
+
+	// Every visit must reach the API to be counted
+	g.Header("Cache-Control", "no-store")
+	g.Header("Referrer-Policy", "no-referrer")
+	g.Redirect(http.StatusFound, target.String())
+}
+
+// getMostUsedBookmarks lists the most used bookmarks of the authenticated user by frecency,
+// which weighs how often and how recently they were visited through /go. The limit
+// parameter sets the number of bookmarks, 10 by default.
+func getMostUsedBookmarks(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	limit, ok := visitsLimit(g)
+	if !ok {
+		return
+	}
+
+	bookmarks, err := repositories.GetMostUsedBookmarks(userID, limit)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmarks: %v", err))
+		return
+	}
+
+	renderNotes(bookmarks)
+	responseData(g, bookmarks)
+}
+
+// getRecentBookmarks lists the bookmarks of the authenticated user most recently visited
+// through /go. The limit parameter sets the number of bookmarks, 10 by default.
+func getRecentBookmarks(g *gin.Context) {
+	userID := GetUserIDFromRequest(g)
+
+	limit, ok := visitsLimit(g)
+	if !ok {
+		return
+	}
+
+	bookmarks, err := repositories.GetRecentlyVisitedBookmarks(userID, limit)
+	if err != nil {
+		responseError(g, fmt.Errorf("Failed to load bookmarks: %v", err))
+		return
+	}
+
+	renderNotes(bookmarks)
+	responseData(g, bookmarks)
+}
+
+// visitsLimit reads the limit parameter of the visit listings, writing 400 Bad Request when
+// it is invalid.
+func visitsLimit(g *gin.Context) (int, bool) {
+	limit := defaultVisitsLimit
+	if value := g.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxVisitsLimit {
+			g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %v", maxVisitsLimit)})
+			return 0, false
+		}
+		limit = n
+	}
+	return limit, true
+}